@@ -0,0 +1,462 @@
+package onvif
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/clbanning/mxj"
+)
+
+var advancedSecurityXMLNs = []string{
+	`xmlns:tas="http://www.onvif.org/ver10/advancedsecurity/wsdl"`,
+}
+
+// The statuses of a key pair in the keystore.
+const (
+	KeyStatusOK         = "ok"
+	KeyStatusGenerating = "generating"
+	KeyStatusCorrupt    = "corrupt"
+)
+
+// SignatureSHA256WithRSA is the object identifier of sha256WithRSAEncryption,
+// the default signature algorithm of CreatePKCS10CSR.
+const SignatureSHA256WithRSA = "1.2.840.113549.1.1.11"
+
+// ErrKeyCorrupt is returned by WaitForKey when the device failed to create
+// the key pair.
+var ErrKeyCorrupt = errors.New("onvif: key pair is corrupt")
+
+// CreateRSAKeyPair asks an ONVIF camera to create an RSA key pair of keyLength
+// bits in its keystore. The key is created in the background, in about the
+// estimated creation time, see WaitForKey
+func (device Device) CreateRSAKeyPair(keyLength int, alias string) (string, time.Duration, error) {
+	return device.CreateRSAKeyPairContext(context.Background(), keyLength, alias)
+}
+
+// CreateRSAKeyPairContext is like CreateRSAKeyPair but sends the request with ctx.
+func (device Device) CreateRSAKeyPairContext(ctx context.Context, keyLength int, alias string) (string, time.Duration, error) {
+	content := `<KeyLength>` + intToString(keyLength) + `</KeyLength>`
+	if alias != "" {
+		content += `<Alias>` + escapeXML(alias) + `</Alias>`
+	}
+
+	// send request
+	response, err := device.sendAdvancedSecurity(ctx, "CreateRSAKeyPair", content)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// parse response into interface
+	ifaceKey, err := response.ValueForPath("Envelope.Body.CreateRSAKeyPairResponse")
+	if err != nil {
+		return "", 0, err
+	}
+
+	// parse interface
+	mapKey, _ := ifaceKey.(map[string]interface{})
+	return interfaceToString(mapKey["KeyID"]), interfaceToDuration(mapKey["EstimatedCreationTime"]), nil
+}
+
+// GetKeyStatus fetch the status of a key pair of an ONVIF camera, one of
+// KeyStatusOK, KeyStatusGenerating and KeyStatusCorrupt
+func (device Device) GetKeyStatus(keyID string) (string, error) {
+	return device.GetKeyStatusContext(context.Background(), keyID)
+}
+
+// GetKeyStatusContext is like GetKeyStatus but sends the request with ctx.
+func (device Device) GetKeyStatusContext(ctx context.Context, keyID string) (string, error) {
+	// send request
+	response, err := device.sendAdvancedSecurity(ctx, "GetKeyStatus", `<KeyID>`+escapeXML(keyID)+`</KeyID>`)
+	if err != nil {
+		return "", err
+	}
+
+	// parse response
+	return response.ValueForPathString("Envelope.Body.GetKeyStatusResponse.KeyStatus")
+}
+
+// WaitForKey polls GetKeyStatus every interval until the key pair created by
+// CreateRSAKeyPair is ready. It returns ErrKeyCorrupt if the device failed to
+// create it.
+func (device Device) WaitForKey(ctx context.Context, keyID string, interval time.Duration) error {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status, err := device.GetKeyStatusContext(ctx, keyID)
+		if err != nil {
+			return err
+		}
+		switch status {
+		case KeyStatusOK:
+			return nil
+		case KeyStatusCorrupt:
+			return ErrKeyCorrupt
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetAllKeys fetch the key pairs in the keystore of an ONVIF camera
+func (device Device) GetAllKeys() ([]KeyAttribute, error) {
+	return device.GetAllKeysContext(context.Background())
+}
+
+// GetAllKeysContext is like GetAllKeys but sends the request with ctx.
+func (device Device) GetAllKeysContext(ctx context.Context) ([]KeyAttribute, error) {
+	result := []KeyAttribute{}
+
+	// send request
+	response, err := device.sendAdvancedSecurity(ctx, "GetAllKeys", "")
+	if err != nil {
+		return result, err
+	}
+
+	// parse response into interface
+	ifaceKeys, err := response.ValuesForPath("Envelope.Body.GetAllKeysResponse.KeyAttribute")
+	if err != nil {
+		return result, err
+	}
+
+	// parse interface into struct
+	for _, ifaceKey := range ifaceKeys {
+		if mapKey, ok := ifaceKey.(map[string]interface{}); ok {
+			result = append(result, KeyAttribute{
+				KeyID:               interfaceToString(mapKey["KeyID"]),
+				Alias:               interfaceToString(mapKey["Alias"]),
+				HasPrivateKey:       interfaceToBool(mapKey["hasPrivateKey"]),
+				KeyStatus:           interfaceToString(mapKey["KeyStatus"]),
+				ExternallyGenerated: interfaceToBool(mapKey["externallyGenerated"]),
+				SecurelyStored:      interfaceToBool(mapKey["securelyStored"]),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// DeleteKey deletes a key pair from the keystore of an ONVIF camera
+func (device Device) DeleteKey(keyID string) error {
+	return device.DeleteKeyContext(context.Background(), keyID)
+}
+
+// DeleteKeyContext is like DeleteKey but sends the request with ctx.
+func (device Device) DeleteKeyContext(ctx context.Context, keyID string) error {
+	_, err := device.sendAdvancedSecurity(ctx, "DeleteKey", `<KeyID>`+escapeXML(keyID)+`</KeyID>`)
+	return err
+}
+
+// CreatePKCS10CSR asks an ONVIF camera for a certification request of subject
+// signed with a key pair of its keystore, and returns it DER encoded. The
+// signature algorithm is an object identifier, SignatureSHA256WithRSA if
+// empty
+func (device Device) CreatePKCS10CSR(subject DistinguishedName, keyID, signatureAlgorithm string) ([]byte, error) {
+	return device.CreatePKCS10CSRContext(context.Background(), subject, keyID, signatureAlgorithm)
+}
+
+// CreatePKCS10CSRContext is like CreatePKCS10CSR but sends the request with ctx.
+func (device Device) CreatePKCS10CSRContext(ctx context.Context, subject DistinguishedName, keyID, signatureAlgorithm string) ([]byte, error) {
+	if signatureAlgorithm == "" {
+		signatureAlgorithm = SignatureSHA256WithRSA
+	}
+
+	// the schema fixes the order of the subject fields
+	content := `<Subject>`
+	for _, field := range []struct{ name, value string }{
+		{"Country", subject.Country},
+		{"Organization", subject.Organization},
+		{"OrganizationalUnit", subject.OrganizationalUnit},
+		{"StateOrProvinceName", subject.StateOrProvinceName},
+		{"CommonName", subject.CommonName},
+		{"Locality", subject.Locality},
+	} {
+		if field.value != "" {
+			content += `<` + field.name + `>` + escapeXML(field.value) + `</` + field.name + `>`
+		}
+	}
+	content += `</Subject>
+		<KeyID>` + escapeXML(keyID) + `</KeyID>
+		<SignatureAlgorithm><algorithm>` + escapeXML(signatureAlgorithm) + `</algorithm></SignatureAlgorithm>`
+
+	// send request
+	response, err := device.sendAdvancedSecurity(ctx, "CreatePKCS10CSR", content)
+	if err != nil {
+		return nil, err
+	}
+
+	// parse response
+	ifaceCSR, err := response.ValueForPath("Envelope.Body.CreatePKCS10CSRResponse.PKCS10CSR")
+	if err != nil {
+		return nil, err
+	}
+	return attachmentData(ifaceCSR)
+}
+
+// UploadCertificate uploads a DER encoded certificate to the keystore of an
+// ONVIF camera, and returns its certificate ID and the ID of its key pair.
+// When privateKeyRequired is true, the device refuses a certificate whose
+// private key it does not hold, such as one signed from CreatePKCS10CSR
+func (device Device) UploadCertificate(certificate []byte, alias string, privateKeyRequired bool) (string, string, error) {
+	return device.UploadCertificateContext(context.Background(), certificate, alias, privateKeyRequired)
+}
+
+// UploadCertificateContext is like UploadCertificate but sends the request with ctx.
+func (device Device) UploadCertificateContext(ctx context.Context, certificate []byte, alias string, privateKeyRequired bool) (string, string, error) {
+	content := `<Certificate>` + base64.StdEncoding.EncodeToString(certificate) + `</Certificate>`
+	if alias != "" {
+		content += `<Alias>` + escapeXML(alias) + `</Alias>`
+	}
+	content += `<PrivateKeyRequired>` + boolToString(privateKeyRequired) + `</PrivateKeyRequired>`
+
+	// send request
+	response, err := device.sendAdvancedSecurity(ctx, "UploadCertificate", content)
+	if err != nil {
+		return "", "", err
+	}
+
+	// parse response into interface
+	ifaceUpload, err := response.ValueForPath("Envelope.Body.UploadCertificateResponse")
+	if err != nil {
+		return "", "", err
+	}
+
+	// parse interface
+	mapUpload, _ := ifaceUpload.(map[string]interface{})
+	return interfaceToString(mapUpload["CertificateID"]), interfaceToString(mapUpload["KeyID"]), nil
+}
+
+// GetAllCertificates fetch the certificates in the keystore of an ONVIF camera
+func (device Device) GetAllCertificates() ([]SecurityCertificate, error) {
+	return device.GetAllCertificatesContext(context.Background())
+}
+
+// GetAllCertificatesContext is like GetAllCertificates but sends the request with ctx.
+func (device Device) GetAllCertificatesContext(ctx context.Context) ([]SecurityCertificate, error) {
+	result := []SecurityCertificate{}
+
+	// send request
+	response, err := device.sendAdvancedSecurity(ctx, "GetAllCertificates", "")
+	if err != nil {
+		return result, err
+	}
+
+	// parse response into interface
+	ifaceCertificates, err := response.ValuesForPath("Envelope.Body.GetAllCertificatesResponse.Certificate")
+	if err != nil {
+		return result, err
+	}
+
+	// parse interface into struct
+	for _, ifaceCertificate := range ifaceCertificates {
+		if mapCertificate, ok := ifaceCertificate.(map[string]interface{}); ok {
+			content, err := attachmentData(mapCertificate["CertificateContent"])
+			if err != nil {
+				return result, err
+			}
+			result = append(result, SecurityCertificate{
+				CertificateID: interfaceToString(mapCertificate["CertificateID"]),
+				KeyID:         interfaceToString(mapCertificate["KeyID"]),
+				Alias:         interfaceToString(mapCertificate["Alias"]),
+				Certificate:   content,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// DeleteCertificate deletes a certificate from the keystore of an ONVIF camera
+func (device Device) DeleteCertificate(certificateID string) error {
+	return device.DeleteCertificateContext(context.Background(), certificateID)
+}
+
+// DeleteCertificateContext is like DeleteCertificate but sends the request with ctx.
+func (device Device) DeleteCertificateContext(ctx context.Context, certificateID string) error {
+	_, err := device.sendAdvancedSecurity(ctx, "DeleteCertificate", `<CertificateID>`+escapeXML(certificateID)+`</CertificateID>`)
+	return err
+}
+
+// CreateCertificationPath chains certificates of the keystore of an ONVIF
+// camera, from the end entity certificate to the root, and returns the ID of
+// the path
+func (device Device) CreateCertificationPath(certificateIDs []string, alias string) (string, error) {
+	return device.CreateCertificationPathContext(context.Background(), certificateIDs, alias)
+}
+
+// CreateCertificationPathContext is like CreateCertificationPath but sends the request with ctx.
+func (device Device) CreateCertificationPathContext(ctx context.Context, certificateIDs []string, alias string) (string, error) {
+	content := `<CertificateIDs>`
+	for _, certificateID := range certificateIDs {
+		content += `<CertificateID>` + escapeXML(certificateID) + `</CertificateID>`
+	}
+	content += `</CertificateIDs>`
+	if alias != "" {
+		content += `<Alias>` + escapeXML(alias) + `</Alias>`
+	}
+
+	// send request
+	response, err := device.sendAdvancedSecurity(ctx, "CreateCertificationPath", content)
+	if err != nil {
+		return "", err
+	}
+
+	// parse response
+	return response.ValueForPathString("Envelope.Body.CreateCertificationPathResponse.CertificationPathID")
+}
+
+// GetCertificationPath fetch a certification path of an ONVIF camera
+func (device Device) GetCertificationPath(certificationPathID string) (CertificationPath, error) {
+	return device.GetCertificationPathContext(context.Background(), certificationPathID)
+}
+
+// GetCertificationPathContext is like GetCertificationPath but sends the request with ctx.
+func (device Device) GetCertificationPathContext(ctx context.Context, certificationPathID string) (CertificationPath, error) {
+	result := CertificationPath{CertificationPathID: certificationPathID}
+
+	// send request
+	response, err := device.sendAdvancedSecurity(ctx, "GetCertificationPath", `<CertificationPathID>`+escapeXML(certificationPathID)+`</CertificationPathID>`)
+	if err != nil {
+		return result, err
+	}
+
+	// parse response into interface
+	ifacePath, err := response.ValueForPath("Envelope.Body.GetCertificationPathResponse.CertificationPath")
+	if err != nil {
+		return result, err
+	}
+
+	// parse interface into struct
+	if mapPath, ok := ifacePath.(map[string]interface{}); ok {
+		result.Alias = interfaceToString(mapPath["Alias"])
+		ifaceIDs, _ := mxj.Map(mapPath).ValuesForPath("CertificateID")
+		for _, ifaceID := range ifaceIDs {
+			result.CertificateIDs = append(result.CertificateIDs, interfaceToString(ifaceID))
+		}
+	}
+
+	return result, nil
+}
+
+// GetAllCertificationPaths fetch the IDs of the certification paths of an
+// ONVIF camera
+func (device Device) GetAllCertificationPaths() ([]string, error) {
+	return device.GetAllCertificationPathsContext(context.Background())
+}
+
+// GetAllCertificationPathsContext is like GetAllCertificationPaths but sends the request with ctx.
+func (device Device) GetAllCertificationPathsContext(ctx context.Context) ([]string, error) {
+	return device.getCertificationPathIDs(ctx, "GetAllCertificationPaths")
+}
+
+// DeleteCertificationPath deletes a certification path of an ONVIF camera,
+// leaving its certificates in the keystore
+func (device Device) DeleteCertificationPath(certificationPathID string) error {
+	return device.DeleteCertificationPathContext(context.Background(), certificationPathID)
+}
+
+// DeleteCertificationPathContext is like DeleteCertificationPath but sends the request with ctx.
+func (device Device) DeleteCertificationPathContext(ctx context.Context, certificationPathID string) error {
+	_, err := device.sendAdvancedSecurity(ctx, "DeleteCertificationPath", `<CertificationPathID>`+escapeXML(certificationPathID)+`</CertificationPathID>`)
+	return err
+}
+
+// AddServerCertificateAssignment makes the HTTPS server of an ONVIF camera
+// present a certification path
+func (device Device) AddServerCertificateAssignment(certificationPathID string) error {
+	return device.AddServerCertificateAssignmentContext(context.Background(), certificationPathID)
+}
+
+// AddServerCertificateAssignmentContext is like AddServerCertificateAssignment but sends the request with ctx.
+func (device Device) AddServerCertificateAssignmentContext(ctx context.Context, certificationPathID string) error {
+	_, err := device.sendAdvancedSecurity(ctx, "AddServerCertificateAssignment", `<CertificationPathID>`+escapeXML(certificationPathID)+`</CertificationPathID>`)
+	return err
+}
+
+// RemoveServerCertificateAssignment stops the HTTPS server of an ONVIF camera
+// presenting a certification path
+func (device Device) RemoveServerCertificateAssignment(certificationPathID string) error {
+	return device.RemoveServerCertificateAssignmentContext(context.Background(), certificationPathID)
+}
+
+// RemoveServerCertificateAssignmentContext is like RemoveServerCertificateAssignment but sends the request with ctx.
+func (device Device) RemoveServerCertificateAssignmentContext(ctx context.Context, certificationPathID string) error {
+	_, err := device.sendAdvancedSecurity(ctx, "RemoveServerCertificateAssignment", `<CertificationPathID>`+escapeXML(certificationPathID)+`</CertificationPathID>`)
+	return err
+}
+
+// ReplaceServerCertificateAssignment swaps a certification path of the HTTPS
+// server of an ONVIF camera for another, without a moment where neither is
+// presented
+func (device Device) ReplaceServerCertificateAssignment(oldCertificationPathID, newCertificationPathID string) error {
+	return device.ReplaceServerCertificateAssignmentContext(context.Background(), oldCertificationPathID, newCertificationPathID)
+}
+
+// ReplaceServerCertificateAssignmentContext is like ReplaceServerCertificateAssignment but sends the request with ctx.
+func (device Device) ReplaceServerCertificateAssignmentContext(ctx context.Context, oldCertificationPathID, newCertificationPathID string) error {
+	_, err := device.sendAdvancedSecurity(ctx, "ReplaceServerCertificateAssignment",
+		`<OldCertificationPathID>`+escapeXML(oldCertificationPathID)+`</OldCertificationPathID>`+
+			`<NewCertificationPathID>`+escapeXML(newCertificationPathID)+`</NewCertificationPathID>`)
+	return err
+}
+
+// GetAssignedServerCertificates fetch the IDs of the certification paths the
+// HTTPS server of an ONVIF camera presents
+func (device Device) GetAssignedServerCertificates() ([]string, error) {
+	return device.GetAssignedServerCertificatesContext(context.Background())
+}
+
+// GetAssignedServerCertificatesContext is like GetAssignedServerCertificates but sends the request with ctx.
+func (device Device) GetAssignedServerCertificatesContext(ctx context.Context) ([]string, error) {
+	return device.getCertificationPathIDs(ctx, "GetAssignedServerCertificates")
+}
+
+// getCertificationPathIDs sends operation and reads the certification path
+// IDs of its response.
+func (device Device) getCertificationPathIDs(ctx context.Context, operation string) ([]string, error) {
+	result := []string{}
+
+	// send request
+	response, err := device.sendAdvancedSecurity(ctx, operation, "")
+	if err != nil {
+		return result, err
+	}
+
+	// parse response into interface
+	ifaceIDs, err := response.ValuesForPath("Envelope.Body." + operation + "Response.CertificationPathID")
+	if err != nil {
+		return result, err
+	}
+
+	for _, ifaceID := range ifaceIDs {
+		result = append(result, strings.TrimSpace(interfaceToString(ifaceID)))
+	}
+
+	return result, nil
+}
+
+// sendAdvancedSecurity sends operation of the advanced security service with
+// content as its elements.
+func (device Device) sendAdvancedSecurity(ctx context.Context, operation, content string) (mxj.Map, error) {
+	// create SOAP
+	soap := SOAP{
+		XMLNs:    advancedSecurityXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body:     `<` + operation + ` xmlns="http://www.onvif.org/ver10/advancedsecurity/wsdl">` + content + `</` + operation + `>`,
+	}
+
+	// send request
+	return device.sendRequest(ctx, soap, device.XAddr)
+}
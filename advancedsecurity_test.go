@@ -0,0 +1,154 @@
+package onvif
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const tasXMLNs = `xmlns:tas="http://www.onvif.org/ver10/advancedsecurity/wsdl"`
+
+func TestCreatePKCS10CSR(t *testing.T) {
+	var request string
+	server := newSOAPServer(t, `<tas:CreatePKCS10CSRResponse `+tasXMLNs+`><tas:PKCS10CSR>MIIB</tas:PKCS10CSR></tas:CreatePKCS10CSRResponse>`, &request)
+
+	csr, err := Device{XAddr: server.URL}.CreatePKCS10CSR(DistinguishedName{Country: "VN", CommonName: "cam-01.example"}, "key-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, _ := base64.StdEncoding.DecodeString("MIIB"); !reflect.DeepEqual(csr, expected) {
+		t.Fatalf("unexpected CSR %x", csr)
+	}
+
+	for path, expected := range map[string]string{
+		"Envelope.Body.CreatePKCS10CSR.Subject.Country":              "VN",
+		"Envelope.Body.CreatePKCS10CSR.Subject.CommonName":           "cam-01.example",
+		"Envelope.Body.CreatePKCS10CSR.KeyID":                        "key-1",
+		"Envelope.Body.CreatePKCS10CSR.SignatureAlgorithm.algorithm": SignatureSHA256WithRSA,
+	} {
+		if value := requestValue(t, request, path); value != expected {
+			t.Errorf("expected %s at %s, got %v", expected, path, value)
+		}
+	}
+}
+
+func TestCreatePKCS10CSRSubjectOrder(t *testing.T) {
+	var request string
+	server := newSOAPServer(t, `<tas:CreatePKCS10CSRResponse `+tasXMLNs+`><tas:PKCS10CSR>MIIB</tas:PKCS10CSR></tas:CreatePKCS10CSRResponse>`, &request)
+
+	subject := DistinguishedName{
+		Country:             "VN",
+		StateOrProvinceName: "Ha Noi",
+		Locality:            "Cau Giay",
+		Organization:        "Example",
+		OrganizationalUnit:  "Cameras",
+		CommonName:          "cam-01.example",
+	}
+	if _, err := (Device{XAddr: server.URL}).CreatePKCS10CSR(subject, "key-1", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	last := -1
+	for _, name := range []string{"Country", "Organization", "OrganizationalUnit", "StateOrProvinceName", "CommonName", "Locality"} {
+		index := strings.Index(request, "<"+name+">")
+		if index < 0 || index < last {
+			t.Fatalf("expected %s after the fields before it in %s", name, request)
+		}
+		last = index
+	}
+}
+
+func TestGetAllKeys(t *testing.T) {
+	server := newSOAPServer(t, `<tas:GetAllKeysResponse `+tasXMLNs+`>
+		<tas:KeyAttribute><tas:KeyID>key-1</tas:KeyID><tas:Alias>https</tas:Alias><tas:hasPrivateKey>true</tas:hasPrivateKey><tas:KeyStatus>ok</tas:KeyStatus></tas:KeyAttribute>
+	</tas:GetAllKeysResponse>`, nil)
+
+	keys, err := Device{XAddr: server.URL}.GetAllKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []KeyAttribute{{KeyID: "key-1", Alias: "https", HasPrivateKey: true, KeyStatus: KeyStatusOK}}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, keys)
+	}
+}
+
+func TestWaitForKey(t *testing.T) {
+	statuses := []string{KeyStatusGenerating, KeyStatusGenerating, KeyStatusOK}
+	requests := 0
+	server := newSOAPServer(t, "", nil, withHandler(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		status := statuses[requests]
+		requests++
+		writeSOAPResponse(w, http.StatusOK, `<tas:GetKeyStatusResponse `+tasXMLNs+`><tas:KeyStatus>`+status+`</tas:KeyStatus></tas:GetKeyStatusResponse>`, nil)
+		return true
+	}))
+
+	if err := (Device{XAddr: server.URL}).WaitForKey(context.Background(), "key-1", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if requests != len(statuses) {
+		t.Fatalf("expected %d requests, got %d", len(statuses), requests)
+	}
+
+	statuses, requests = []string{KeyStatusCorrupt}, 0
+	if err := (Device{XAddr: server.URL}).WaitForKey(context.Background(), "key-1", time.Millisecond); err != ErrKeyCorrupt {
+		t.Fatalf("expected ErrKeyCorrupt, got %v", err)
+	}
+}
+
+func TestServerCertificateAssignment(t *testing.T) {
+	var request string
+	server := newSOAPServer(t, `<tas:CreateCertificationPathResponse `+tasXMLNs+`><tas:CertificationPathID>path-1</tas:CertificationPathID></tas:CreateCertificationPathResponse>`, &request)
+	device := Device{XAddr: server.URL}
+
+	pathID, err := device.CreateCertificationPath([]string{"cert-1", "ca-1"}, "https")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pathID != "path-1" {
+		t.Fatalf("unexpected path ID %q", pathID)
+	}
+	if value := requestValues(t, request, "Envelope.Body.CreateCertificationPath.CertificateIDs.CertificateID"); !reflect.DeepEqual(value, []interface{}{"cert-1", "ca-1"}) {
+		t.Fatalf("unexpected certificate IDs %v", value)
+	}
+
+	if err := device.ReplaceServerCertificateAssignment("path-0", "path-1"); err != nil {
+		t.Fatal(err)
+	}
+	if value := requestValue(t, request, "Envelope.Body.ReplaceServerCertificateAssignment.NewCertificationPathID"); value != "path-1" {
+		t.Fatalf("unexpected path ID %v", value)
+	}
+
+	server = newSOAPServer(t, `<tas:GetAssignedServerCertificatesResponse `+tasXMLNs+`>
+		<tas:CertificationPathID>path-0</tas:CertificationPathID>
+		<tas:CertificationPathID>path-1</tas:CertificationPathID>
+	</tas:GetAssignedServerCertificatesResponse>`, nil)
+	pathIDs, err := Device{XAddr: server.URL}.GetAssignedServerCertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pathIDs, []string{"path-0", "path-1"}) {
+		t.Fatalf("unexpected path IDs %v", pathIDs)
+	}
+}
+
+func TestGetCertificationPath(t *testing.T) {
+	server := newSOAPServer(t, `<tas:GetCertificationPathResponse `+tasXMLNs+`><tas:CertificationPath>
+		<tas:CertificateID>cert-1</tas:CertificateID>
+		<tas:CertificateID>ca-1</tas:CertificateID>
+		<tas:Alias>https</tas:Alias>
+	</tas:CertificationPath></tas:GetCertificationPathResponse>`, nil)
+
+	path, err := Device{XAddr: server.URL}.GetCertificationPath("path-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := CertificationPath{CertificationPathID: "path-1", Alias: "https", CertificateIDs: []string{"cert-1", "ca-1"}}
+	if !reflect.DeepEqual(path, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, path)
+	}
+}
@@ -0,0 +1,82 @@
+package onvif
+
+// AuthMode selects how requests authenticate with a device.
+type AuthMode int
+
+const (
+	// AuthAuto lets a Device try the other modes in turn on its first call
+	// and keep using the first one the device accepts, starting with
+	// AuthWSUsernameTokenAndHTTPDigest. Modes that send the password in clear
+	// text are only tried over HTTPS. A SOAP sent on its own treats it as
+	// AuthWSUsernameTokenAndHTTPDigest.
+	AuthAuto AuthMode = iota
+	// AuthNone sends requests without credentials.
+	AuthNone
+	// AuthWSUsernameTokenDigest sends a WS-Security UsernameToken with a
+	// PasswordDigest, as required by the ONVIF core specification.
+	AuthWSUsernameTokenDigest
+	// AuthWSUsernameTokenText sends a WS-Security UsernameToken with the
+	// password in clear text.
+	AuthWSUsernameTokenText
+	// AuthHTTPDigest answers HTTP digest challenges.
+	AuthHTTPDigest
+	// AuthHTTPBasic sends HTTP basic credentials.
+	AuthHTTPBasic
+	// AuthWSUsernameTokenAndHTTPDigest sends a WS-Security UsernameToken
+	// with a PasswordDigest and also answers HTTP digest challenges.
+	AuthWSUsernameTokenAndHTTPDigest
+)
+
+// autoAuthModes are the modes AuthAuto tries, in order.
+var autoAuthModes = []AuthMode{
+	AuthWSUsernameTokenAndHTTPDigest,
+	AuthWSUsernameTokenDigest,
+	AuthHTTPDigest,
+	AuthWSUsernameTokenText,
+	AuthHTTPBasic,
+}
+
+func (mode AuthMode) String() string {
+	switch mode {
+	case AuthAuto:
+		return "Auto"
+	case AuthNone:
+		return "None"
+	case AuthWSUsernameTokenDigest:
+		return "WSUsernameTokenDigest"
+	case AuthWSUsernameTokenText:
+		return "WSUsernameTokenText"
+	case AuthHTTPDigest:
+		return "HTTPDigest"
+	case AuthHTTPBasic:
+		return "HTTPBasic"
+	case AuthWSUsernameTokenAndHTTPDigest:
+		return "WSUsernameTokenAndHTTPDigest"
+	}
+	return "AuthMode(" + intToString(int(mode)) + ")"
+}
+
+// usesUsernameToken reports whether the mode puts a WS-Security
+// UsernameToken in the request header.
+func (mode AuthMode) usesUsernameToken() bool {
+	switch mode {
+	case AuthAuto, AuthWSUsernameTokenAndHTTPDigest, AuthWSUsernameTokenDigest, AuthWSUsernameTokenText:
+		return true
+	}
+	return false
+}
+
+// usesHTTPDigest reports whether the mode answers HTTP digest challenges.
+func (mode AuthMode) usesHTTPDigest() bool {
+	switch mode {
+	case AuthAuto, AuthWSUsernameTokenAndHTTPDigest, AuthHTTPDigest:
+		return true
+	}
+	return false
+}
+
+// sendsPassword reports whether the mode puts the password on the wire in
+// clear text.
+func (mode AuthMode) sendsPassword() bool {
+	return mode == AuthWSUsernameTokenText || mode == AuthHTTPBasic
+}
@@ -0,0 +1,171 @@
+package onvif
+
+import (
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const notAuthorizedFault = `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:ter="http://www.onvif.org/ver10/error"><s:Body><s:Fault>
+	<s:Code><s:Value>s:Sender</s:Value><s:Subcode><s:Value>ter:NotAuthorized</s:Value></s:Subcode></s:Code>
+	<s:Reason><s:Text xml:lang="en">Sender not Authorized</s:Text></s:Reason>
+</s:Fault></s:Body></s:Envelope>`
+
+type authRequest struct {
+	authorization string
+	body          string
+}
+
+// acceptAuth answers as a device that accepts a request when accept says
+// so, and records every request it receives.
+func acceptAuth(accept func(r *http.Request, body string) bool) (soapServerOption, func() []authRequest) {
+	var mu sync.Mutex
+	var requests []authRequest
+	option := withHandler(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		mu.Lock()
+		requests = append(requests, authRequest{r.Header.Get("Authorization"), string(body)})
+		mu.Unlock()
+
+		if strings.Contains(string(body), "GetSystemDateAndTime") || accept(r, string(body)) {
+			return false
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(notAuthorizedFault))
+		return true
+	})
+
+	return option, func() []authRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]authRequest(nil), requests...)
+	}
+}
+
+func TestAuthAutoRemembersWorkingMode(t *testing.T) {
+	accept, requests := acceptAuth(func(r *http.Request, body string) bool {
+		user, password, ok := r.BasicAuth()
+		return ok && user == "admin" && password == "secret" && !strings.Contains(body, "UsernameToken")
+	})
+	server := newSOAPServer(t, testInformationResponse, nil, withRawResponse(), withTLS(), accept)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	device := Device{XAddr: server.URL + "/onvif/device_service", User: "admin", Password: "secret", TLS: &TLSConfig{RootCAs: roots}}
+
+	if _, err := device.GetInformation(); err != nil {
+		t.Fatal(err)
+	}
+	probed := len(requests())
+
+	if _, err := device.GetInformation(); err != nil {
+		t.Fatal(err)
+	}
+	all := requests()
+	if len(all) != probed+1 {
+		t.Fatalf("expected the second call to go straight through, got %d requests", len(all)-probed)
+	}
+	if last := all[len(all)-1]; !strings.HasPrefix(last.authorization, "Basic ") || strings.Contains(last.body, "UsernameToken") {
+		t.Fatalf("expected HTTP basic credentials only, got %+v", last)
+	}
+}
+
+func TestAuthAutoKeepsPasswordOffPlainHTTP(t *testing.T) {
+	accept, requests := acceptAuth(func(r *http.Request, body string) bool { return false })
+	server := newSOAPServer(t, testInformationResponse, nil, withRawResponse(), accept)
+	device := Device{XAddr: server.URL + "/onvif/device_service", User: "admin", Password: "secret"}
+
+	if _, err := device.GetInformation(); !errors.Is(err, ErrNotAuthorized) {
+		t.Fatalf("expected ErrNotAuthorized, got %v", err)
+	}
+	probes := requests()
+	if len(probes) == 0 || !strings.Contains(probes[0].body, "#PasswordDigest") {
+		t.Fatal("expected the first probe to carry a digest UsernameToken")
+	}
+	for _, request := range probes {
+		if strings.Contains(request.body, "#PasswordText") || strings.HasPrefix(request.authorization, "Basic ") {
+			t.Fatalf("expected no clear text password over HTTP, got %+v", request)
+		}
+	}
+
+	// The refusal is remembered, so the next call isn't probed again
+	if _, err := device.GetInformation(); !errors.Is(err, ErrNotAuthorized) {
+		t.Fatalf("expected ErrNotAuthorized, got %v", err)
+	}
+	sent := 0
+	for _, request := range requests()[len(probes):] {
+		if strings.Contains(request.body, "GetDeviceInformation") {
+			sent++
+		}
+	}
+	if sent != 1 {
+		t.Fatalf("expected one request after the refusal, got %d", sent)
+	}
+}
+
+func TestAuthModeSendsOnlySelectedCredentials(t *testing.T) {
+	cases := []struct {
+		mode          AuthMode
+		passwordType  string
+		authorization string
+	}{
+		{AuthNone, "", ""},
+		{AuthWSUsernameTokenAndHTTPDigest, "#PasswordDigest", ""},
+		{AuthWSUsernameTokenDigest, "#PasswordDigest", ""},
+		{AuthWSUsernameTokenText, "#PasswordText", ""},
+		{AuthHTTPBasic, "", "Basic "},
+	}
+
+	for _, c := range cases {
+		accept, requests := acceptAuth(func(r *http.Request, body string) bool { return true })
+		server := newSOAPServer(t, testInformationResponse, nil, withRawResponse(), accept)
+		device := Device{XAddr: server.URL, User: "admin", Password: "secret", AuthMode: c.mode}
+		if _, err := device.GetInformation(); err != nil {
+			t.Fatalf("%v: %v", c.mode, err)
+		}
+
+		request := requests()[0]
+		if c.passwordType == "" && strings.Contains(request.body, "UsernameToken") {
+			t.Errorf("%v: unexpected UsernameToken in request", c.mode)
+		}
+		if c.passwordType != "" && !strings.Contains(request.body, c.passwordType) {
+			t.Errorf("%v: expected %s token in request", c.mode, c.passwordType)
+		}
+		if !strings.HasPrefix(request.authorization, c.authorization) || (c.authorization == "" && request.authorization != "") {
+			t.Errorf("%v: unexpected Authorization header %q", c.mode, request.authorization)
+		}
+	}
+}
+
+func TestAuthHTTPDigestSendsNoUsernameToken(t *testing.T) {
+	accept, requests := acceptAuth(func(r *http.Request, body string) bool {
+		return strings.HasPrefix(r.Header.Get("Authorization"), "Digest ")
+	})
+	server := newSOAPServer(t, testInformationResponse, nil, withRawResponse(), accept)
+	server.Config.Handler = challengeFirst(server.Config.Handler)
+
+	device := Device{XAddr: server.URL, User: "admin", Password: "secret", AuthMode: AuthHTTPDigest}
+	if _, err := device.GetInformation(); err != nil {
+		t.Fatal(err)
+	}
+	for _, request := range requests() {
+		if strings.Contains(request.body, "UsernameToken") {
+			t.Fatal("unexpected UsernameToken in HTTP digest request")
+		}
+	}
+}
+
+// challengeFirst answers requests without credentials with a digest challenge.
+func challengeFirst(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			ioutil.ReadAll(r.Body)
+			w.Header().Set("WWW-Authenticate", `Digest realm="onvif", nonce="abc", qop="auth"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
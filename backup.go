@@ -0,0 +1,157 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// GetSystemBackup fetch the configuration backup files of an ONVIF camera,
+// in the vendor's format
+func (device Device) GetSystemBackup() ([]BackupFile, error) {
+	return device.GetSystemBackupContext(context.Background())
+}
+
+// GetSystemBackupContext is like GetSystemBackup but sends the request with ctx.
+func (device Device) GetSystemBackupContext(ctx context.Context) ([]BackupFile, error) {
+	// create SOAP
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body:     `<GetSystemBackup xmlns="http://www.onvif.org/ver10/device/wsdl"/>`,
+	}
+
+	result := []BackupFile{}
+
+	// send request
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
+	if err != nil {
+		return result, err
+	}
+
+	// parse response into interface
+	ifaceBackupFiles, err := response.ValuesForPath("Envelope.Body.GetSystemBackupResponse.BackupFiles")
+	if err != nil {
+		return result, err
+	}
+
+	// parse interface into struct, the attachments were put inline as base64
+	for _, ifaceBackupFile := range ifaceBackupFiles {
+		if mapBackupFile, ok := ifaceBackupFile.(map[string]interface{}); ok {
+			data, err := attachmentData(mapBackupFile["Data"])
+			if err != nil {
+				return result, err
+			}
+			result = append(result, BackupFile{
+				Name: interfaceToString(mapBackupFile["Name"]),
+				Data: data,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// RestoreSystem sends backup files to an ONVIF camera with the legacy MTOM
+// operation, to restore its configuration
+func (device Device) RestoreSystem(files []BackupFile) error {
+	return device.RestoreSystemContext(context.Background(), files)
+}
+
+// RestoreSystemContext is like RestoreSystem but sends the request with ctx.
+func (device Device) RestoreSystemContext(ctx context.Context, files []BackupFile) error {
+	// create SOAP
+	body := `<RestoreSystem xmlns="http://www.onvif.org/ver10/device/wsdl">`
+	attachments := make(map[string][]byte)
+	for i, file := range files {
+		id := "backup" + strconv.Itoa(i)
+		attachments[id] = file.Data
+		body += `<BackupFiles>
+			<tt:Name>` + escapeXML(file.Name) + `</tt:Name>
+			<tt:Data><xop:Include xmlns:xop="http://www.w3.org/2004/08/xop/include" href="cid:` + id + `"/></tt:Data>
+		</BackupFiles>`
+	}
+	body += `</RestoreSystem>`
+
+	soap := SOAP{
+		XMLNs:       deviceXMLNs,
+		User:        device.User,
+		Password:    device.Password,
+		Body:        body,
+		attachments: attachments,
+	}
+
+	// send request
+	_, err := device.sendRequest(ctx, soap, device.XAddr)
+	return err
+}
+
+// StartSystemRestore asks an ONVIF camera where to upload a backup file over
+// HTTP
+func (device Device) StartSystemRestore() (SystemRestore, error) {
+	return device.StartSystemRestoreContext(context.Background())
+}
+
+// StartSystemRestoreContext is like StartSystemRestore but sends the request with ctx.
+func (device Device) StartSystemRestoreContext(ctx context.Context) (SystemRestore, error) {
+	// create SOAP
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body:     `<StartSystemRestore xmlns="http://www.onvif.org/ver10/device/wsdl"/>`,
+	}
+
+	result := SystemRestore{}
+
+	// send request
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
+	if err != nil {
+		return result, err
+	}
+
+	// parse response into interface
+	ifaceRestore, err := response.ValueForPath("Envelope.Body.StartSystemRestoreResponse")
+	if err != nil {
+		return result, err
+	}
+
+	// parse interface into struct
+	if mapRestore, ok := ifaceRestore.(map[string]interface{}); ok {
+		result.UploadURI = strings.TrimSpace(interfaceToString(mapRestore["UploadUri"]))
+		result.ExpectedDownTime = interfaceToDuration(mapRestore["ExpectedDownTime"])
+	}
+
+	return result, nil
+}
+
+// UploadBackup posts the size bytes of a backup file to the upload URI of
+// restore. Progress, if not nil, is called as the file is sent.
+func (device Device) UploadBackup(ctx context.Context, restore SystemRestore, file io.Reader, size int64, progress func(sent, total int64)) error {
+	if restore.UploadURI == "" {
+		return errors.New("device did not give a backup upload URI")
+	}
+
+	logAt(device.Logger, LogDebug, "onvif backup upload", "uri", redact(restore.UploadURI), "size", size)
+	return device.upload(ctx, restore.UploadURI, file, size, progress)
+}
+
+// RestoreBackup pushes backup files taken with GetSystemBackup back to the
+// device. A single file is uploaded over HTTP when the device advertises it,
+// and files are sent with the legacy RestoreSystem otherwise. The device
+// may reboot to apply the backup.
+func (device Device) RestoreBackup(ctx context.Context, files []BackupFile) error {
+	if len(files) != 1 || !device.systemCapabilities(ctx).HttpSystemBackup {
+		return device.RestoreSystemContext(ctx, files)
+	}
+
+	restore, err := device.StartSystemRestoreContext(ctx)
+	if err != nil {
+		return err
+	}
+	return device.UploadBackup(ctx, restore, bytes.NewReader(files[0].Data), int64(len(files[0].Data)), nil)
+}
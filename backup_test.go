@@ -0,0 +1,157 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/clbanning/mxj"
+)
+
+var testBackupFiles = []BackupFile{
+	{Name: "config.bin", Data: []byte("\x00\x01binary config\xff")},
+	{Name: "users & keys.tar", Data: bytes.Repeat([]byte("k"), 4096)},
+}
+
+// fakeBackupDevice stands in for a device whose configuration is backed up
+// and restored, with MTOM or over HTTP.
+type fakeBackupDevice struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	httpBackup bool         // advertise HttpSystemBackup
+	mtom       bool         // send GetSystemBackup as an MTOM message
+	restored   []BackupFile // the files received by RestoreSystem
+	uploaded   []byte       // the file uploaded after StartSystemRestore
+}
+
+func newFakeBackupDevice(t *testing.T, httpBackup, mtom bool) *fakeBackupDevice {
+	device := &fakeBackupDevice{httpBackup: httpBackup, mtom: mtom}
+	device.Server = newSOAPServer(t, "", nil, withHandler(device.serve))
+	return device
+}
+
+func (device *fakeBackupDevice) serve(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	if r.URL.Path == "/restore" {
+		device.uploaded = body
+		return true
+	}
+
+	parts := mtomParts(r.Header.Get("Content-Type"), body)
+	request := string(parts[""])
+
+	var response string
+	attachments := make(map[string][]byte)
+	switch {
+	case strings.Contains(request, "GetServices"):
+		response = `<tds:GetServicesResponse><tds:Service>
+			<tds:Namespace>http://www.onvif.org/ver10/device/wsdl</tds:Namespace>
+			<tds:Capabilities><tds:Capabilities>
+				<tds:System SystemBackup="true" HttpSystemBackup="` + boolToString(device.httpBackup) + `"/>
+			</tds:Capabilities></tds:Capabilities>
+		</tds:Service></tds:GetServicesResponse>`
+	case strings.Contains(request, "GetSystemBackup"):
+		response = `<tds:GetSystemBackupResponse>`
+		for i, file := range testBackupFiles {
+			data := base64.StdEncoding.EncodeToString(file.Data)
+			if device.mtom {
+				id := "file" + intToString(i) + "@device"
+				attachments[id] = file.Data
+				data = `<xop:Include xmlns:xop="http://www.w3.org/2004/08/xop/include" href="cid:` + strings.Replace(id, "@", "%40", 1) + `"/>`
+			}
+			response += `<tds:BackupFiles><tt:Name>` + escapeXML(file.Name) + `</tt:Name>` +
+				`<tt:Data xmlns:xmime="http://www.w3.org/2005/05/xmlmime" xmime:contentType="application/octet-stream">` + data + `</tt:Data></tds:BackupFiles>`
+		}
+		response += `</tds:GetSystemBackupResponse>`
+	case strings.Contains(request, "RestoreSystem"):
+		device.restored = readRestoreRequest(parts)
+		response = `<tds:RestoreSystemResponse/>`
+	case strings.Contains(request, "StartSystemRestore"):
+		response = `<tds:StartSystemRestoreResponse>
+			<tds:UploadUri>` + device.URL + `/restore</tds:UploadUri>
+			<tds:ExpectedDownTime>PT30S</tds:ExpectedDownTime>
+		</tds:StartSystemRestoreResponse>`
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return true
+	}
+
+	writeSOAPResponse(w, http.StatusOK, response, attachments)
+	return true
+}
+
+// readRestoreRequest reads the files of a RestoreSystem request from its
+// MTOM parts.
+func readRestoreRequest(parts map[string][]byte) []BackupFile {
+	mapXML, err := mxj.NewMapXml(parts[""])
+	if err != nil {
+		return nil
+	}
+	ifaceBackupFiles, _ := mapXML.ValuesForPath("Envelope.Body.RestoreSystem.BackupFiles")
+
+	var files []BackupFile
+	for _, ifaceBackupFile := range ifaceBackupFiles {
+		mapBackupFile, _ := ifaceBackupFile.(map[string]interface{})
+		href, _ := mxj.Map(mapBackupFile).ValueForPathString("Data.Include.-href")
+		files = append(files, BackupFile{
+			Name: interfaceToString(mapBackupFile["Name"]),
+			Data: parts["<"+strings.TrimPrefix(href, "cid:")+">"],
+		})
+	}
+	return files
+}
+
+func TestGetSystemBackup(t *testing.T) {
+	for _, mtom := range []bool{true, false} {
+		server := newFakeBackupDevice(t, false, mtom)
+
+		files, err := Device{XAddr: server.URL}.GetSystemBackup()
+		if err != nil {
+			t.Fatalf("MTOM %v: %v", mtom, err)
+		}
+		if !reflect.DeepEqual(files, testBackupFiles) {
+			t.Errorf("MTOM %v: expected %q, got %q", mtom, testBackupFiles, files)
+		}
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	server := newFakeBackupDevice(t, true, false)
+	device := Device{XAddr: server.URL}
+
+	// Several files need the MTOM operation
+	if err := device.RestoreBackup(context.Background(), testBackupFiles); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(server.restored, testBackupFiles) {
+		t.Errorf("expected %q restored, got %q", testBackupFiles, server.restored)
+	}
+
+	// A single file is uploaded
+	if err := device.RestoreBackup(context.Background(), testBackupFiles[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(server.uploaded, testBackupFiles[0].Data) {
+		t.Errorf("expected %q uploaded, got %q", testBackupFiles[0].Data, server.uploaded)
+	}
+}
+
+func TestRestoreBackupWithoutHTTP(t *testing.T) {
+	server := newFakeBackupDevice(t, false, false)
+
+	if err := (Device{XAddr: server.URL}).RestoreBackup(context.Background(), testBackupFiles[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if server.uploaded != nil || !reflect.DeepEqual(server.restored, testBackupFiles[:1]) {
+		t.Errorf("expected the file restored with MTOM, got %q and upload %q", server.restored, server.uploaded)
+	}
+}
@@ -0,0 +1,358 @@
+package onvif
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"time"
+
+	"github.com/clbanning/mxj"
+)
+
+// ErrNoPEMBlock is returned by DecodePEM when the data has no PEM block of
+// the expected type.
+var ErrNoPEMBlock = errors.New("onvif: no PEM block found")
+
+// The PEM block types of the certificates, keys and certification requests
+// exchanged with a device.
+const (
+	PEMCertificate        = "CERTIFICATE"
+	PEMCertificateRequest = "CERTIFICATE REQUEST"
+	PEMPrivateKey         = "PRIVATE KEY"
+)
+
+// DecodePEM returns the DER bytes of the first PEM block of blockType in data.
+func DecodePEM(data []byte, blockType string) ([]byte, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, ErrNoPEMBlock
+		}
+		if block.Type == blockType {
+			return block.Bytes, nil
+		}
+	}
+}
+
+// EncodePEM encodes DER bytes as a PEM block of blockType.
+func EncodePEM(blockType string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+// CertificateFromPEM creates a Certificate with id from the first certificate
+// of PEM data, to be sent with LoadCertificates or LoadCACertificates.
+func CertificateFromPEM(id string, data []byte) (Certificate, error) {
+	der, err := DecodePEM(data, PEMCertificate)
+	if err != nil {
+		return Certificate{}, err
+	}
+	return Certificate{CertificateID: id, Certificate: der}, nil
+}
+
+// PEM encodes the certificate as PEM.
+func (certificate Certificate) PEM() []byte {
+	return EncodePEM(PEMCertificate, certificate.Certificate)
+}
+
+// X509 parses the certificate.
+func (certificate Certificate) X509() (*x509.Certificate, error) {
+	return x509.ParseCertificate(certificate.Certificate)
+}
+
+// GetCertificates fetch the certificates of the HTTPS server of an ONVIF
+// camera
+func (device Device) GetCertificates() ([]Certificate, error) {
+	return device.GetCertificatesContext(context.Background())
+}
+
+// GetCertificatesContext is like GetCertificates but sends the request with ctx.
+func (device Device) GetCertificatesContext(ctx context.Context) ([]Certificate, error) {
+	return device.getCertificates(ctx, "GetCertificates", "NvtCertificate")
+}
+
+// GetCACertificates fetch the CA certificates an ONVIF camera trusts for
+// client authentication
+func (device Device) GetCACertificates() ([]Certificate, error) {
+	return device.GetCACertificatesContext(context.Background())
+}
+
+// GetCACertificatesContext is like GetCACertificates but sends the request with ctx.
+func (device Device) GetCACertificatesContext(ctx context.Context) ([]Certificate, error) {
+	return device.getCertificates(ctx, "GetCACertificates", "CACertificate")
+}
+
+// getCertificates sends operation and reads the certificates of its response
+// named element.
+func (device Device) getCertificates(ctx context.Context, operation, element string) ([]Certificate, error) {
+	// create SOAP
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body:     `<` + operation + ` xmlns="http://www.onvif.org/ver10/device/wsdl"/>`,
+	}
+
+	result := []Certificate{}
+
+	// send request
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
+	if err != nil {
+		return result, err
+	}
+
+	// parse response into interface
+	ifaceCertificates, err := response.ValuesForPath("Envelope.Body." + operation + "Response." + element)
+	if err != nil {
+		return result, err
+	}
+
+	// parse interface into struct
+	for _, ifaceCertificate := range ifaceCertificates {
+		certificate, err := readCertificate(ifaceCertificate)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, certificate)
+	}
+
+	return result, nil
+}
+
+// CreateCertificate asks an ONVIF camera to create a key pair and a self-signed
+// certificate for its HTTPS server. The device picks what is left empty or
+// zero.
+func (device Device) CreateCertificate(certificateID, subject string, validNotBefore, validNotAfter time.Time) (Certificate, error) {
+	return device.CreateCertificateContext(context.Background(), certificateID, subject, validNotBefore, validNotAfter)
+}
+
+// CreateCertificateContext is like CreateCertificate but sends the request with ctx.
+func (device Device) CreateCertificateContext(ctx context.Context, certificateID, subject string, validNotBefore, validNotAfter time.Time) (Certificate, error) {
+	// create SOAP
+	body := `<CreateCertificate xmlns="http://www.onvif.org/ver10/device/wsdl">`
+	if certificateID != "" {
+		body += `<CertificateID>` + escapeXML(certificateID) + `</CertificateID>`
+	}
+	if subject != "" {
+		body += `<Subject>` + escapeXML(subject) + `</Subject>`
+	}
+	if !validNotBefore.IsZero() {
+		body += `<ValidNotBefore>` + validNotBefore.UTC().Format(time.RFC3339) + `</ValidNotBefore>`
+	}
+	if !validNotAfter.IsZero() {
+		body += `<ValidNotAfter>` + validNotAfter.UTC().Format(time.RFC3339) + `</ValidNotAfter>`
+	}
+	body += `</CreateCertificate>`
+
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body:     body,
+	}
+
+	// send request
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
+	if err != nil {
+		return Certificate{}, err
+	}
+
+	// parse response into interface
+	ifaceCertificate, err := response.ValueForPath("Envelope.Body.CreateCertificateResponse.NvtCertificate")
+	if err != nil {
+		return Certificate{}, err
+	}
+
+	// parse interface into struct
+	return readCertificate(ifaceCertificate)
+}
+
+// LoadCertificates sends certificates for the HTTPS server of an ONVIF
+// camera, whose key pairs the device already holds
+func (device Device) LoadCertificates(certificates []Certificate) error {
+	return device.LoadCertificatesContext(context.Background(), certificates)
+}
+
+// LoadCertificatesContext is like LoadCertificates but sends the request with ctx.
+func (device Device) LoadCertificatesContext(ctx context.Context, certificates []Certificate) error {
+	return device.loadCertificates(ctx, "LoadCertificates", "NVTCertificate", certificates)
+}
+
+// LoadCACertificates sends CA certificates an ONVIF camera trusts for client
+// authentication
+func (device Device) LoadCACertificates(certificates []Certificate) error {
+	return device.LoadCACertificatesContext(context.Background(), certificates)
+}
+
+// LoadCACertificatesContext is like LoadCACertificates but sends the request with ctx.
+func (device Device) LoadCACertificatesContext(ctx context.Context, certificates []Certificate) error {
+	return device.loadCertificates(ctx, "LoadCACertificates", "CACertificate", certificates)
+}
+
+// loadCertificates sends certificates as the named elements of operation.
+func (device Device) loadCertificates(ctx context.Context, operation, element string, certificates []Certificate) error {
+	// create SOAP
+	body := `<` + operation + ` xmlns="http://www.onvif.org/ver10/device/wsdl">`
+	for _, certificate := range certificates {
+		body += `<` + element + `>
+			<tt:CertificateID>` + escapeXML(certificate.CertificateID) + `</tt:CertificateID>
+			<tt:Certificate><tt:Data>` + base64.StdEncoding.EncodeToString(certificate.Certificate) + `</tt:Data></tt:Certificate>
+		</` + element + `>`
+	}
+	body += `</` + operation + `>`
+
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body:     body,
+	}
+
+	// send request
+	_, err := device.sendRequest(ctx, soap, device.XAddr)
+	return err
+}
+
+// GetCertificatesStatus fetch which certificates the HTTPS server of an ONVIF
+// camera uses
+func (device Device) GetCertificatesStatus() ([]CertificateStatus, error) {
+	return device.GetCertificatesStatusContext(context.Background())
+}
+
+// GetCertificatesStatusContext is like GetCertificatesStatus but sends the request with ctx.
+func (device Device) GetCertificatesStatusContext(ctx context.Context) ([]CertificateStatus, error) {
+	// create SOAP
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body:     `<GetCertificatesStatus xmlns="http://www.onvif.org/ver10/device/wsdl"/>`,
+	}
+
+	result := []CertificateStatus{}
+
+	// send request
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
+	if err != nil {
+		return result, err
+	}
+
+	// parse response into interface
+	ifaceStatuses, err := response.ValuesForPath("Envelope.Body.GetCertificatesStatusResponse.CertificateStatus")
+	if err != nil {
+		return result, err
+	}
+
+	// parse interface into struct
+	for _, ifaceStatus := range ifaceStatuses {
+		if mapStatus, ok := ifaceStatus.(map[string]interface{}); ok {
+			result = append(result, CertificateStatus{
+				CertificateID: interfaceToString(mapStatus["CertificateID"]),
+				Status:        interfaceToBool(mapStatus["Status"]),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// SetCertificatesStatus sets which certificates the HTTPS server of an ONVIF
+// camera uses
+func (device Device) SetCertificatesStatus(statuses []CertificateStatus) error {
+	return device.SetCertificatesStatusContext(context.Background(), statuses)
+}
+
+// SetCertificatesStatusContext is like SetCertificatesStatus but sends the request with ctx.
+func (device Device) SetCertificatesStatusContext(ctx context.Context, statuses []CertificateStatus) error {
+	// create SOAP
+	body := `<SetCertificatesStatus xmlns="http://www.onvif.org/ver10/device/wsdl">`
+	for _, status := range statuses {
+		body += `<CertificateStatus>
+			<tt:CertificateID>` + escapeXML(status.CertificateID) + `</tt:CertificateID>
+			<tt:Status>` + boolToString(status.Status) + `</tt:Status>
+		</CertificateStatus>`
+	}
+	body += `</SetCertificatesStatus>`
+
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body:     body,
+	}
+
+	// send request
+	_, err := device.sendRequest(ctx, soap, device.XAddr)
+	return err
+}
+
+// DeleteCertificates deletes certificates, and their key pairs, of an ONVIF
+// camera
+func (device Device) DeleteCertificates(certificateIDs ...string) error {
+	return device.DeleteCertificatesContext(context.Background(), certificateIDs...)
+}
+
+// DeleteCertificatesContext is like DeleteCertificates but sends the request with ctx.
+func (device Device) DeleteCertificatesContext(ctx context.Context, certificateIDs ...string) error {
+	// create SOAP
+	body := `<DeleteCertificates xmlns="http://www.onvif.org/ver10/device/wsdl">`
+	for _, certificateID := range certificateIDs {
+		body += `<CertificateID>` + escapeXML(certificateID) + `</CertificateID>`
+	}
+	body += `</DeleteCertificates>`
+
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body:     body,
+	}
+
+	// send request
+	_, err := device.sendRequest(ctx, soap, device.XAddr)
+	return err
+}
+
+// SetClientCertificateMode sets whether the HTTPS server of an ONVIF camera
+// requires clients to authenticate with a certificate
+func (device Device) SetClientCertificateMode(enabled bool) error {
+	return device.SetClientCertificateModeContext(context.Background(), enabled)
+}
+
+// SetClientCertificateModeContext is like SetClientCertificateMode but sends the request with ctx.
+func (device Device) SetClientCertificateModeContext(ctx context.Context, enabled bool) error {
+	// create SOAP
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body: `<SetClientCertificateMode xmlns="http://www.onvif.org/ver10/device/wsdl">
+			<Enabled>` + boolToString(enabled) + `</Enabled>
+		</SetClientCertificateMode>`,
+	}
+
+	// send request
+	_, err := device.sendRequest(ctx, soap, device.XAddr)
+	return err
+}
+
+// readCertificate reads a tt:Certificate, whose data may have been sent as an
+// MTOM attachment.
+func readCertificate(ifaceCertificate interface{}) (Certificate, error) {
+	mapCertificate, ok := ifaceCertificate.(map[string]interface{})
+	if !ok {
+		return Certificate{}, nil
+	}
+
+	ifaceData, _ := mxj.Map(mapCertificate).ValueForPath("Certificate.Data")
+	data, err := attachmentData(ifaceData)
+	if err != nil {
+		return Certificate{}, err
+	}
+	return Certificate{
+		CertificateID: interfaceToString(mapCertificate["CertificateID"]),
+		Certificate:   data,
+	}, nil
+}
@@ -0,0 +1,163 @@
+package onvif
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestCertificate creates a self-signed certificate, DER encoded.
+func newTestCertificate(t *testing.T, commonName string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestCertificatePEM(t *testing.T) {
+	der := newTestCertificate(t, "camera.example")
+
+	// A key before the certificate is skipped
+	data := append(EncodePEM(PEMPrivateKey, []byte("key")), EncodePEM(PEMCertificate, der)...)
+	certificate, err := CertificateFromPEM("https", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certificate.CertificateID != "https" || !bytes.Equal(certificate.Certificate, der) {
+		t.Fatalf("unexpected certificate %+v", certificate)
+	}
+	if !bytes.Equal(certificate.PEM(), EncodePEM(PEMCertificate, der)) {
+		t.Fatalf("unexpected PEM %s", certificate.PEM())
+	}
+
+	parsed, err := certificate.X509()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Subject.CommonName != "camera.example" {
+		t.Fatalf("unexpected subject %v", parsed.Subject)
+	}
+
+	if _, err := DecodePEM(der, PEMCertificate); err != ErrNoPEMBlock {
+		t.Fatalf("expected ErrNoPEMBlock, got %v", err)
+	}
+}
+
+func TestGetCertificates(t *testing.T) {
+	der := newTestCertificate(t, "camera.example")
+	server := newSOAPServer(t, `<tds:GetCertificatesResponse>
+		<tds:NvtCertificate><tt:CertificateID>https</tt:CertificateID><tt:Certificate><tt:Data>`+base64.StdEncoding.EncodeToString(der)+`</tt:Data></tt:Certificate></tds:NvtCertificate>
+		<tds:NvtCertificate><tt:CertificateID>old</tt:CertificateID><tt:Certificate><tt:Data>AAEC</tt:Data></tt:Certificate></tds:NvtCertificate>
+	</tds:GetCertificatesResponse>`, nil)
+
+	certificates, err := Device{XAddr: server.URL}.GetCertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Certificate{
+		{CertificateID: "https", Certificate: der},
+		{CertificateID: "old", Certificate: []byte{0, 1, 2}},
+	}
+	if !reflect.DeepEqual(certificates, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, certificates)
+	}
+}
+
+func TestCreateCertificate(t *testing.T) {
+	var request string
+	server := newSOAPServer(t, `<tds:CreateCertificateResponse>
+		<tds:NvtCertificate><tt:CertificateID>new</tt:CertificateID><tt:Certificate><tt:Data>AAEC</tt:Data></tt:Certificate></tds:NvtCertificate>
+	</tds:CreateCertificateResponse>`, &request)
+
+	notAfter := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	certificate, err := Device{XAddr: server.URL}.CreateCertificate("new", "CN=camera", time.Time{}, notAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certificate.CertificateID != "new" || !bytes.Equal(certificate.Certificate, []byte{0, 1, 2}) {
+		t.Fatalf("unexpected certificate %+v", certificate)
+	}
+	if value := requestValue(t, request, "Envelope.Body.CreateCertificate.ValidNotAfter"); value != "2030-01-02T03:04:05Z" {
+		t.Fatalf("unexpected ValidNotAfter %v", value)
+	}
+}
+
+func TestLoadCACertificates(t *testing.T) {
+	var request string
+	server := newSOAPServer(t, `<tds:LoadCACertificatesResponse/>`, &request)
+
+	der := newTestCertificate(t, "Recorder CA")
+	if err := (Device{XAddr: server.URL}).LoadCACertificates([]Certificate{{CertificateID: "ca", Certificate: der}}); err != nil {
+		t.Fatal(err)
+	}
+	if value := requestValue(t, request, "Envelope.Body.LoadCACertificates.CACertificate.CertificateID"); value != "ca" {
+		t.Fatalf("unexpected certificate ID %v", value)
+	}
+	if value := requestValue(t, request, "Envelope.Body.LoadCACertificates.CACertificate.Certificate.Data"); value != base64.StdEncoding.EncodeToString(der) {
+		t.Fatalf("unexpected certificate data %v", value)
+	}
+}
+
+func TestCertificatesStatus(t *testing.T) {
+	server := newSOAPServer(t, `<tds:GetCertificatesStatusResponse>
+		<tds:CertificateStatus><tt:CertificateID>https</tt:CertificateID><tt:Status>true</tt:Status></tds:CertificateStatus>
+		<tds:CertificateStatus><tt:CertificateID>old</tt:CertificateID><tt:Status>false</tt:Status></tds:CertificateStatus>
+	</tds:GetCertificatesStatusResponse>`, nil)
+
+	statuses, err := Device{XAddr: server.URL}.GetCertificatesStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []CertificateStatus{{CertificateID: "https", Status: true}, {CertificateID: "old"}}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, statuses)
+	}
+
+	var request string
+	server = newSOAPServer(t, `<tds:SetCertificatesStatusResponse/>`, &request)
+	if err := (Device{XAddr: server.URL}).SetCertificatesStatus([]CertificateStatus{{CertificateID: "new", Status: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if value := requestValue(t, request, "Envelope.Body.SetCertificatesStatus.CertificateStatus.Status"); value != "true" {
+		t.Fatalf("unexpected status %v", value)
+	}
+}
+
+func TestDeleteCertificatesAndClientCertificateMode(t *testing.T) {
+	var request string
+	server := newSOAPServer(t, `<tds:DeleteCertificatesResponse/>`, &request)
+	device := Device{XAddr: server.URL}
+
+	if err := device.DeleteCertificates("old", "older"); err != nil {
+		t.Fatal(err)
+	}
+	if value := requestValues(t, request, "Envelope.Body.DeleteCertificates.CertificateID"); !reflect.DeepEqual(value, []interface{}{"old", "older"}) {
+		t.Fatalf("unexpected certificate IDs %v", value)
+	}
+
+	if err := device.SetClientCertificateMode(true); err != nil {
+		t.Fatal(err)
+	}
+	if value := requestValue(t, request, "Envelope.Body.SetClientCertificateMode.Enabled"); value != "true" {
+		t.Fatalf("unexpected mode %v", value)
+	}
+}
@@ -0,0 +1,280 @@
+package onvif
+
+import (
+	"container/list"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/clbanning/mxj"
+	"github.com/quocson95/go-onvif/digest"
+)
+
+// Client is a long-lived handle on an ONVIF device. A bare Device opens a new
+// connection for every call; a Client keeps one HTTP transport for its whole
+// lifetime, so connections are pooled and the digest challenge is reused
+// between calls. All Device methods are available on a Client, and a Client
+// is safe for concurrent use.
+type Client struct {
+	Device
+
+	httpClient  *http.Client // answers HTTP digest challenges
+	plainClient *http.Client // sends requests as they are
+	state       deviceState
+	trustedKey  trustedKey
+}
+
+// NewClient creates a Client for device. Requests go through httpClient,
+// wrapped with digest authentication for the device's credentials. If
+// httpClient is nil, or has no Transport, a pooled transport is created,
+// verifying HTTPS devices as device.TLS says; to use a custom
+// http.RoundTripper pass &http.Client{Transport: rt}.
+func NewClient(device Device, httpClient *http.Client) *Client {
+	client := &Client{Device: device}
+	client.Device.client = client
+
+	pooled := http.Client{}
+	if httpClient != nil {
+		pooled = *httpClient
+	}
+
+	base := pooled.Transport
+	if base == nil {
+		base = newHTTPTransport(client.Device.tlsClientConfig(device.XAddr))
+	}
+	plain := pooled
+	plain.Transport = base
+	pooled.Transport = &digest.Transport{
+		Username:  device.User,
+		Password:  device.Password,
+		Transport: base,
+	}
+
+	client.httpClient = &pooled
+	client.plainClient = &plain
+	return client
+}
+
+// Service returns a Device for another service endpoint of the same camera,
+// such as the media or PTZ XAddr from GetCapabilities, that shares the
+// client's connections and authentication state.
+func (client *Client) Service(xaddr string) Device {
+	device := client.Device
+	device.XAddr = xaddr
+	return device
+}
+
+// newHTTPTransport creates the pooled transport used by clients that were not
+// given one.
+func newHTTPTransport(tlsConfig *tls.Config) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		TLSClientConfig:       tlsConfig,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// deviceState is what we learn about a device across calls.
+type deviceState struct {
+	mu          sync.Mutex
+	clockOffset time.Duration // how far the device's clock is ahead of ours
+	authMode    AuthMode      // the mode AuthAuto settled on
+	authRefused string        // the credentials every mode was refused for
+}
+
+// maxDeviceStates is how many hosts bare Devices remember state for. The
+// least recently used host is forgotten first, and is probed afresh if it
+// comes back.
+const maxDeviceStates = 1024
+
+var (
+	deviceStatesMu  sync.Mutex
+	deviceStates    = make(map[string]*list.Element) // key: device host
+	deviceStatesLRU = list.New()                     // of *hostState, most recently used first
+)
+
+// hostState is the state bare Devices share for a host.
+type hostState struct {
+	host  string
+	state *deviceState
+}
+
+// stateFor returns the state of the device serving xaddr. Clients keep their
+// own, bare Devices share one per host, for up to maxDeviceStates hosts.
+func (device Device) stateFor(xaddr string) *deviceState {
+	if device.client != nil {
+		return &device.client.state
+	}
+
+	host := xaddr
+	if urlXAddr, err := url.Parse(xaddr); err == nil {
+		host = urlXAddr.Host
+	}
+
+	deviceStatesMu.Lock()
+	defer deviceStatesMu.Unlock()
+	if element, ok := deviceStates[host]; ok {
+		deviceStatesLRU.MoveToFront(element)
+		return element.Value.(*hostState).state
+	}
+
+	if deviceStatesLRU.Len() >= maxDeviceStates {
+		oldest := deviceStatesLRU.Back()
+		deviceStatesLRU.Remove(oldest)
+		delete(deviceStates, oldest.Value.(*hostState).host)
+	}
+	state := &deviceState{}
+	deviceStates[host] = deviceStatesLRU.PushFront(&hostState{host: host, state: state})
+	return state
+}
+
+func (state *deviceState) getClockOffset() time.Duration {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.clockOffset
+}
+
+func (state *deviceState) setClockOffset(offset time.Duration) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.clockOffset = offset
+}
+
+func (state *deviceState) getAuthMode() AuthMode {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.authMode
+}
+
+func (state *deviceState) setAuthMode(mode AuthMode) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.authMode = mode
+	state.authRefused = ""
+}
+
+// refusedAuth reports whether the device refused every mode for credentials.
+func (state *deviceState) refusedAuth(credentials string) bool {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.authRefused == credentials
+}
+
+func (state *deviceState) setAuthRefused(credentials string) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.authRefused = credentials
+}
+
+// sendRequest sends soap to xaddr through the device's client, if it has one,
+// authenticating the way the device expects.
+func (device Device) sendRequest(ctx context.Context, soap SOAP, xaddr string) (mxj.Map, error) {
+	soap.client = device.client
+	soap.AuthMode = device.AuthMode
+	soap.logger = device.Logger
+	if device.client == nil {
+		soap.tlsConfig = device.tlsClientConfig(xaddr)
+	}
+	if soap.User == "" || soap.AuthMode != AuthAuto {
+		return device.sendRequestWithClock(ctx, soap, xaddr)
+	}
+
+	state := device.stateFor(xaddr)
+	if mode := state.getAuthMode(); mode != AuthAuto {
+		soap.AuthMode = mode
+		return device.sendRequestWithClock(ctx, soap, xaddr)
+	}
+
+	// Don't probe again for credentials the device already refused
+	credentials := soap.User + ":" + soap.Password
+	if state.refusedAuth(credentials) {
+		soap.AuthMode = autoAuthModes[0]
+		return device.sendRequestWithClock(ctx, soap, xaddr)
+	}
+
+	// Probe the modes in turn and remember the first the device accepts.
+	// The password is only sent in clear text over HTTPS.
+	secure := false
+	if urlXAddr, err := url.Parse(xaddr); err == nil {
+		secure = urlXAddr.Scheme == "https"
+	}
+
+	var response mxj.Map
+	var err error
+	for _, mode := range autoAuthModes {
+		if mode.sendsPassword() && !secure {
+			continue
+		}
+		soap.AuthMode = mode
+		response, err = device.sendRequestWithClock(ctx, soap, xaddr)
+		if errors.Is(err, ErrNotAuthorized) {
+			continue
+		}
+		if err == nil {
+			state.setAuthMode(mode)
+		}
+		return response, err
+	}
+
+	state.setAuthRefused(credentials)
+	return response, err
+}
+
+// sendHTTP sends a plain HTTP request, such as a firmware upload, to a URI
+// the device handed out, through the device's client if it has one. Such
+// requests can't carry a WS-UsernameToken, so HTTP digest challenges are
+// answered unless the device uses basic or no authentication.
+func (device Device) sendHTTP(req *http.Request) (*http.Response, error) {
+	mode := device.AuthMode
+	if mode == AuthAuto {
+		mode = device.stateFor(req.URL.String()).getAuthMode()
+	}
+	if mode != AuthNone && mode != AuthHTTPBasic {
+		mode = AuthHTTPDigest
+	}
+
+	soap := SOAP{User: device.User, Password: device.Password, AuthMode: mode, client: device.client}
+	if device.client == nil {
+		soap.tlsConfig = device.tlsClientConfig(req.URL.String())
+	}
+	if device.User != "" && mode == AuthHTTPBasic {
+		req.SetBasicAuth(device.User, device.Password)
+	}
+
+	httpClient, release := soap.httpClient()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = releasingBody{resp.Body, release}
+	return resp, nil
+}
+
+// releasingBody releases the HTTP client a response came from once its body
+// is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (body releasingBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.release()
+	return err
+}
@@ -0,0 +1,118 @@
+package onvif
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const testInformationResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl">
+	<s:Body><tds:GetDeviceInformationResponse><tds:Manufacturer>Acme</tds:Manufacturer></tds:GetDeviceInformationResponse></s:Body>
+</s:Envelope>`
+
+type countingTransport struct {
+	base     http.RoundTripper
+	requests int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return t.base.RoundTrip(req)
+}
+
+func TestClientReusesConnections(t *testing.T) {
+	var connections, challenges int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Digest ") {
+			atomic.AddInt32(&challenges, 1)
+			w.Header().Set("WWW-Authenticate", `Digest realm="onvif", nonce="abc", qop="auth"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(testInformationResponse))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := NewClient(Device{
+		XAddr:    server.URL + "/onvif/device_service",
+		User:     "admin",
+		Password: "secret",
+		AuthMode: AuthHTTPDigest,
+	}, nil)
+
+	for i := 0; i < 5; i++ {
+		info, err := client.GetInformation()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Manufacturer != "Acme" {
+			t.Fatalf("unexpected manufacturer %q", info.Manufacturer)
+		}
+	}
+
+	if n := atomic.LoadInt32(&connections); n != 1 {
+		t.Errorf("expected 1 connection, got %d", n)
+	}
+	if n := atomic.LoadInt32(&challenges); n != 1 {
+		t.Errorf("expected the digest challenge to be reused, got %d challenges", n)
+	}
+}
+
+func TestClientUsesCallerTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(testInformationResponse))
+	}))
+	defer server.Close()
+
+	transport := &countingTransport{base: http.DefaultTransport}
+	client := NewClient(Device{XAddr: server.URL + "/onvif/device_service"}, &http.Client{Transport: transport})
+
+	media := client.Service(server.URL + "/onvif/media_service")
+	if _, err := client.GetInformation(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := media.GetInformation(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&transport.requests); n != 2 {
+		t.Fatalf("expected 2 requests through the caller's transport, got %d", n)
+	}
+}
+
+func TestDeviceStatesBounded(t *testing.T) {
+	first := Device{XAddr: "http://10.99.0.1/onvif/device_service"}
+	state := first.stateFor(first.XAddr)
+	if first.stateFor(first.XAddr) != state {
+		t.Fatal("expected a host to keep its state")
+	}
+
+	for i := 0; i <= maxDeviceStates; i++ {
+		xaddr := "http://10.98." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256) + "/onvif/device_service"
+		Device{XAddr: xaddr}.stateFor(xaddr)
+	}
+
+	deviceStatesMu.Lock()
+	count := len(deviceStates)
+	deviceStatesMu.Unlock()
+	if count > maxDeviceStates {
+		t.Fatalf("expected at most %d hosts, got %d", maxDeviceStates, count)
+	}
+	if first.stateFor(first.XAddr) == state {
+		t.Fatal("expected the least recently used host to be forgotten")
+	}
+}
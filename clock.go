@@ -0,0 +1,101 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/clbanning/mxj"
+)
+
+// clockSkewTolerance is how far a device clock may drift from the offset we
+// already compensate for before a NotAuthorized fault is blamed on it.
+const clockSkewTolerance = time.Second
+
+// UTCTime returns the UTC date and time reported by the device.
+func (systemDT SystemDateAndTime) UTCTime() time.Time {
+	return time.Date(systemDT.Year, time.Month(systemDT.Month), systemDT.Day,
+		systemDT.Hour, systemDT.Minute, systemDT.Second, 0, time.UTC)
+}
+
+// SyncClock reads the device's time, which is allowed without
+// authentication, and remembers its offset from the local clock for the
+// WS-UsernameToken of later requests.
+func (device Device) SyncClock() (time.Duration, error) {
+	return device.SyncClockContext(context.Background())
+}
+
+// SyncClockContext is like SyncClock but sends the request with ctx.
+func (device Device) SyncClockContext(ctx context.Context) (time.Duration, error) {
+	return device.syncClock(ctx, device.XAddr)
+}
+
+func (device Device) syncClock(ctx context.Context, xaddr string) (time.Duration, error) {
+	// GetSystemDateAndTime belongs to the device service, which is not
+	// always served on the XAddr of other services.
+	xaddrs := []string{xaddr}
+	if urlXAddr, err := url.Parse(xaddr); err == nil && urlXAddr.Path != "/onvif/device_service" {
+		urlXAddr.Path = "/onvif/device_service"
+		xaddrs = append(xaddrs, urlXAddr.String())
+	}
+
+	var err error
+	for _, timeXAddr := range xaddrs {
+		start := time.Now()
+		timeDevice := device
+		timeDevice.XAddr = timeXAddr
+		var systemDT SystemDateAndTime
+		systemDT, err = timeDevice.GetSystemDateAndTimeContext(ctx)
+		if err != nil || systemDT.Year == 0 {
+			continue
+		}
+
+		// Compare against the middle of the round trip
+		local := start.Add(time.Since(start) / 2)
+		offset := systemDT.UTCTime().Sub(local).Round(time.Second)
+		device.stateFor(xaddr).setClockOffset(offset)
+		return offset, nil
+	}
+
+	if err == nil {
+		err = errors.New("device did not report its UTC time")
+	}
+	return 0, err
+}
+
+// sendRequestWithClock sends soap with the device's known clock offset, and
+// retries once with a corrected timestamp when the device rejects the
+// credentials because its clock has drifted.
+func (device Device) sendRequestWithClock(ctx context.Context, soap SOAP, xaddr string) (mxj.Map, error) {
+	soap.ClockOffset = device.stateFor(xaddr).getClockOffset()
+	response, err := device.sendRequestWithRetry(ctx, soap, xaddr)
+	if soap.User == "" || !soap.AuthMode.usesUsernameToken() || !errors.Is(err, ErrNotAuthorized) {
+		return response, err
+	}
+
+	offset, syncErr := device.syncClock(ctx, xaddr)
+	if syncErr != nil || !isClockFault(err, offset-soap.ClockOffset) {
+		return response, err
+	}
+
+	soap.ClockOffset = offset
+	return device.sendRequestWithRetry(ctx, soap, xaddr)
+}
+
+// isClockFault reports whether a NotAuthorized fault looks time-related,
+// either by its wording or because the clock moved since the token was made.
+func isClockFault(err error, drift time.Duration) bool {
+	if drift > clockSkewTolerance || drift < -clockSkewTolerance {
+		return true
+	}
+
+	reason := strings.ToLower(err.Error())
+	for _, hint := range []string{"time", "expired", "created"} {
+		if strings.Contains(reason, hint) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package onvif
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// skewedClock answers as a device whose clock runs skew ahead of ours and
+// which rejects tokens created more than 5 seconds away from its own time.
+func skewedClock(skew time.Duration, faults *int32) soapServerOption {
+	created := regexp.MustCompile(`<Created[^>]*>([^<]+)</Created>`)
+	return withHandler(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		now := time.Now().Add(skew).UTC()
+
+		if strings.Contains(string(body), "GetSystemDateAndTime") {
+			writeSOAPResponse(w, http.StatusOK, fmt.Sprintf(`<tds:GetSystemDateAndTimeResponse><tds:SystemDateAndTime>
+					<tt:DateTimeType>NTP</tt:DateTimeType>
+					<tt:UTCDateTime>
+						<tt:Time><tt:Hour>%d</tt:Hour><tt:Minute>%d</tt:Minute><tt:Second>%d</tt:Second></tt:Time>
+						<tt:Date><tt:Year>%d</tt:Year><tt:Month>%d</tt:Month><tt:Day>%d</tt:Day></tt:Date>
+					</tt:UTCDateTime>
+				</tds:SystemDateAndTime></tds:GetSystemDateAndTimeResponse>`,
+				now.Hour(), now.Minute(), now.Second(), now.Year(), now.Month(), now.Day()), nil)
+			return true
+		}
+
+		match := created.FindStringSubmatch(string(body))
+		if match != nil {
+			timestamp, err := time.Parse(time.RFC3339, match[1])
+			if err == nil && timestamp.Sub(now) < 5*time.Second && now.Sub(timestamp) < 5*time.Second {
+				return false
+			}
+		}
+
+		atomic.AddInt32(faults, 1)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(notAuthorizedFault))
+		return true
+	})
+}
+
+func TestClockSkewRetry(t *testing.T) {
+	var faults int32
+	server := newSOAPServer(t, testInformationResponse, nil, withRawResponse(), skewedClock(-3*time.Hour, &faults))
+	device := Device{XAddr: server.URL + "/onvif/device_service", User: "admin", Password: "secret"}
+
+	for i := 0; i < 3; i++ {
+		info, err := device.GetInformation()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Manufacturer != "Acme" {
+			t.Fatalf("unexpected manufacturer %q", info.Manufacturer)
+		}
+	}
+
+	if n := atomic.LoadInt32(&faults); n != 1 {
+		t.Fatalf("expected a single rejected token before the offset was learned, got %d", n)
+	}
+}
+
+func TestClientSyncClock(t *testing.T) {
+	var faults int32
+	server := newSOAPServer(t, testInformationResponse, nil, withRawResponse(), skewedClock(90*time.Minute, &faults))
+	client := NewClient(Device{XAddr: server.URL + "/onvif/device_service", User: "admin", Password: "secret"}, nil)
+
+	offset, err := client.SyncClock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset < 89*time.Minute || offset > 91*time.Minute {
+		t.Fatalf("unexpected clock offset %v", offset)
+	}
+
+	if _, err := client.Service(server.URL + "/onvif/media_service").GetInformation(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&faults); n != 0 {
+		t.Fatalf("expected no rejected token after syncing the clock, got %d", n)
+	}
+}
@@ -1,7 +1,7 @@
 package onvif
 
 import (
-	"github.com/golang/glog"
+	"context"
 	"strings"
 )
 
@@ -12,6 +12,11 @@ var deviceXMLNs = []string{
 
 // GetInformation fetch information of ONVIF camera
 func (device Device) GetInformation() (DeviceInformation, error) {
+	return device.GetInformationContext(context.Background())
+}
+
+// GetInformationContext is like GetInformation but sends the request with ctx.
+func (device Device) GetInformationContext(ctx context.Context) (DeviceInformation, error) {
 	// Create SOAP
 	soap := SOAP{
 		Body:     "<tds:GetDeviceInformation/>",
@@ -21,7 +26,7 @@ func (device Device) GetInformation() (DeviceInformation, error) {
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return DeviceInformation{}, err
 	}
@@ -47,6 +52,11 @@ func (device Device) GetInformation() (DeviceInformation, error) {
 
 // GetInformation fetch information of ONVIF camera
 func (device Device) GetNetworkInterfaces() ([]NetworkInterface, error) {
+	return device.GetNetworkInterfacesContext(context.Background())
+}
+
+// GetNetworkInterfacesContext is like GetNetworkInterfaces but sends the request with ctx.
+func (device Device) GetNetworkInterfacesContext(ctx context.Context) ([]NetworkInterface, error) {
 	// Create SOAP
 	soap := SOAP{
 		Body:     "<tds:GetNetworkInterfaces/>",
@@ -56,7 +66,7 @@ func (device Device) GetNetworkInterfaces() ([]NetworkInterface, error) {
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return nil, err
 	}
@@ -71,7 +81,7 @@ func (device Device) GetNetworkInterfaces() ([]NetworkInterface, error) {
 	result := make([]NetworkInterface, 0)
 	for _, networkInterfacesInfo := range networkInterfacesInfos {
 		if mapNetworkInterfacesInfo, ok := networkInterfacesInfo.(map[string]interface{}); ok {
-			glog.Infof("mapNetworkInterfacesInfo %v", mapNetworkInterfacesInfo)
+			logAt(device.Logger, LogDebug, "network interface", "xaddr", redact(device.XAddr), "operation", "GetNetworkInterfaces", "interface", mapNetworkInterfacesInfo)
 			networkInterface := NetworkInterface{}
 			networkInterface.Token = interfaceToString(mapNetworkInterfacesInfo["-token"])
 			networkInterface.Enabled = interfaceToBool(mapNetworkInterfacesInfo["Enabled"])
@@ -106,19 +116,24 @@ func (device Device) GetNetworkInterfaces() ([]NetworkInterface, error) {
 }
 
 func (device Device) SetNetworkInterfaces(networkInterface NetworkInterface) error {
+	return device.SetNetworkInterfacesContext(context.Background(), networkInterface)
+}
+
+// SetNetworkInterfacesContext is like SetNetworkInterfaces but sends the request with ctx.
+func (device Device) SetNetworkInterfacesContext(ctx context.Context, networkInterface NetworkInterface) error {
 	//create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<SetNetworkInterfaces xmlns="http://www.onvif.org/ver10/device/wsdl">
-					<InterfaceToken>` + networkInterface.Token + `</InterfaceToken>
+					<InterfaceToken>` + escapeXML(networkInterface.Token) + `</InterfaceToken>
 					<NetworkInterface>
 						<Enabled xmlns="http://www.onvif.org/ver10/schema">` + boolToString(networkInterface.Enabled) + `</Enabled>
 						<MTU xmlns="http://www.onvif.org/ver10/schema">` + intToString(networkInterface.Info.MTU) + `</MTU>
 						<IPv4 xmlns="http://www.onvif.org/ver10/schema">
 							<Enabled>true</Enabled>
 							<Manual>
-								<Address>` + networkInterface.IPv4.Config.Manual.Address + `</Address>
+								<Address>` + escapeXML(networkInterface.IPv4.Config.Manual.Address) + `</Address>
 								<PrefixLength>` + intToString(networkInterface.IPv4.Config.Manual.PrefixLength) + `</PrefixLength>
 							</Manual>
 							<DHCP>` + boolToString(networkInterface.IPv4.Config.DHCP) + `</DHCP>
@@ -127,7 +142,7 @@ func (device Device) SetNetworkInterfaces(networkInterface NetworkInterface) err
  			  </SetNetworkInterfaces>`,
 	}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 
 	if err != nil {
 		return err
@@ -142,6 +157,11 @@ func (device Device) SetNetworkInterfaces(networkInterface NetworkInterface) err
 
 // GetCapabilities fetch info of ONVIF camera's capabilities
 func (device Device) GetCapabilities() (DeviceCapabilities, error) {
+	return device.GetCapabilitiesContext(context.Background())
+}
+
+// GetCapabilitiesContext is like GetCapabilities but sends the request with ctx.
+func (device Device) GetCapabilitiesContext(ctx context.Context) (DeviceCapabilities, error) {
 	// Create SOAP
 	soap := SOAP{
 		XMLNs: deviceXMLNs,
@@ -153,7 +173,7 @@ func (device Device) GetCapabilities() (DeviceCapabilities, error) {
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return DeviceCapabilities{}, err
 	}
@@ -267,6 +287,11 @@ func (device Device) GetCapabilities() (DeviceCapabilities, error) {
 
 // GetDiscoveryMode fetch network discovery mode of an ONVIF camera
 func (device Device) GetDiscoveryMode() (string, error) {
+	return device.GetDiscoveryModeContext(context.Background())
+}
+
+// GetDiscoveryModeContext is like GetDiscoveryMode but sends the request with ctx.
+func (device Device) GetDiscoveryModeContext(ctx context.Context) (string, error) {
 	// Create SOAP
 	soap := SOAP{
 		Body:     "<tds:GetDiscoveryMode/>",
@@ -276,7 +301,7 @@ func (device Device) GetDiscoveryMode() (string, error) {
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return "", err
 	}
@@ -288,6 +313,11 @@ func (device Device) GetDiscoveryMode() (string, error) {
 
 // GetScopes fetch scopes of an ONVIF camera
 func (device Device) GetScopes() ([]string, error) {
+	return device.GetScopesContext(context.Background())
+}
+
+// GetScopesContext is like GetScopes but sends the request with ctx.
+func (device Device) GetScopesContext(ctx context.Context) ([]string, error) {
 	// Create SOAP
 	soap := SOAP{
 		Body:     "<tds:GetScopes/>",
@@ -297,7 +327,7 @@ func (device Device) GetScopes() ([]string, error) {
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return nil, err
 	}
@@ -322,6 +352,11 @@ func (device Device) GetScopes() ([]string, error) {
 
 // GetHostname fetch hostname of an ONVIF camera
 func (device Device) GetHostname() (HostnameInformation, error) {
+	return device.GetHostnameContext(context.Background())
+}
+
+// GetHostnameContext is like GetHostname but sends the request with ctx.
+func (device Device) GetHostnameContext(ctx context.Context) (HostnameInformation, error) {
 	// Create SOAP
 	soap := SOAP{
 		Body:     "<tds:GetHostname/>",
@@ -331,7 +366,7 @@ func (device Device) GetHostname() (HostnameInformation, error) {
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return HostnameInformation{}, err
 	}
@@ -353,6 +388,11 @@ func (device Device) GetHostname() (HostnameInformation, error) {
 }
 
 func (device Device) GetSystemDateAndTime() (SystemDateAndTime, error) {
+	return device.GetSystemDateAndTimeContext(context.Background())
+}
+
+// GetSystemDateAndTimeContext is like GetSystemDateAndTime but sends the request with ctx.
+func (device Device) GetSystemDateAndTimeContext(ctx context.Context) (SystemDateAndTime, error) {
 	// Create SOAP
 	soap := SOAP{
 		XMLNs: deviceXMLNs,
@@ -362,7 +402,7 @@ func (device Device) GetSystemDateAndTime() (SystemDateAndTime, error) {
 	systemDT := SystemDateAndTime{}
 
 	// send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return systemDT, err
 	}
@@ -404,14 +444,19 @@ func (device Device) GetSystemDateAndTime() (SystemDateAndTime, error) {
 }
 
 func (device Device) SetSystemDateAndTime(systemDT SystemDateAndTime) error {
+	return device.SetSystemDateAndTimeContext(context.Background(), systemDT)
+}
+
+// SetSystemDateAndTimeContext is like SetSystemDateAndTime but sends the request with ctx.
+func (device Device) SetSystemDateAndTimeContext(ctx context.Context, systemDT SystemDateAndTime) error {
 	// create Body request
 	var body string
 	if systemDT.DateTimeType == "Manual" { // Manual mode
 		body = `<SetSystemDateAndTime xmlns="http://www.onvif.org/ver10/device/wsdl">
-					<DateTimeType>` + systemDT.DateTimeType + `</DateTimeType>
+					<DateTimeType>` + escapeXML(systemDT.DateTimeType) + `</DateTimeType>
 					<DaylightSavings>` + boolToString(systemDT.DaylightSavings) + `</DaylightSavings>
 					<TimeZone>
-						<TZ xmlns="http://www.onvif.org/ver10/schema">` + systemDT.TZ + `</TZ>
+						<TZ xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(systemDT.TZ) + `</TZ>
 					</TimeZone>
 					<UTCDateTime>
 						<Time xmlns="http://www.onvif.org/ver10/schema">
@@ -428,11 +473,11 @@ func (device Device) SetSystemDateAndTime(systemDT SystemDateAndTime) error {
 				</SetSystemDateAndTime>`
 	} else { // NTP mode
 		body = `<SetSystemDateAndTime xmlns="http://www.onvif.org/ver10/device/wsdl">
-					<DateTimeType>` + systemDT.DateTimeType + `</DateTimeType>
+					<DateTimeType>` + escapeXML(systemDT.DateTimeType) + `</DateTimeType>
 					<DaylightSavings>` + boolToString(systemDT.DaylightSavings) + `</DaylightSavings>`
 
 		if systemDT.TZ != "" {
-			body += `<TimeZone><TZ xmlns="http://www.onvif.org/ver10/schema">` + systemDT.TZ + `</TZ></TimeZone>`
+			body += `<TimeZone><TZ xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(systemDT.TZ) + `</TZ></TimeZone>`
 		}
 
 		body += `</SetSystemDateAndTime>`
@@ -446,7 +491,7 @@ func (device Device) SetSystemDateAndTime(systemDT SystemDateAndTime) error {
 	}
 
 	// send soap request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -460,6 +505,11 @@ func (device Device) SetSystemDateAndTime(systemDT SystemDateAndTime) error {
 }
 
 func (device Device) GetNTP() (NTPInformation, error) {
+	return device.GetNTPContext(context.Background())
+}
+
+// GetNTPContext is like GetNTP but sends the request with ctx.
+func (device Device) GetNTPContext(ctx context.Context) (NTPInformation, error) {
 	//create SOAP
 	soap := SOAP{
 		XMLNs:    deviceXMLNs,
@@ -471,7 +521,7 @@ func (device Device) GetNTP() (NTPInformation, error) {
 	ntpInformation := NTPInformation{}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 
 	if err != nil {
 		return ntpInformation, err
@@ -543,6 +593,11 @@ func (device Device) GetNTP() (NTPInformation, error) {
 }
 
 func (device Device) SetNTP(ntpInformation NTPInformation) error {
+	return device.SetNTPContext(context.Background(), ntpInformation)
+}
+
+// SetNTPContext is like SetNTP but sends the request with ctx.
+func (device Device) SetNTPContext(ctx context.Context, ntpInformation NTPInformation) error {
 	// create soap
 	soap := SOAP{
 		XMLNs:    deviceXMLNs,
@@ -551,15 +606,15 @@ func (device Device) SetNTP(ntpInformation NTPInformation) error {
 		Body: `<SetNTP xmlns="http://www.onvif.org/ver10/device/wsdl">
 					<FromDHCP>` + boolToString(ntpInformation.FromDHCP) + `</FromDHCP>
 					<NTPManual>
-						<Type xmlns="http://www.onvif.org/ver10/schema">` + ntpInformation.NTPNetworkHost[0].Type + `</Type>
-						<IPv4Address xmlns="http://www.onvif.org/ver10/schema">` + ntpInformation.NTPNetworkHost[0].IPv4Address + `</IPv4Address>
-						<DNSname xmlns="http://www.onvif.org/ver10/schema">` + ntpInformation.NTPNetworkHost[0].DNSname + `</DNSname>
+						<Type xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(ntpInformation.NTPNetworkHost[0].Type) + `</Type>
+						<IPv4Address xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(ntpInformation.NTPNetworkHost[0].IPv4Address) + `</IPv4Address>
+						<DNSname xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(ntpInformation.NTPNetworkHost[0].DNSname) + `</DNSname>
 					</NTPManual>
 				</SetNTP>`,
 	}
 
 	// send soap request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -573,6 +628,11 @@ func (device Device) SetNTP(ntpInformation NTPInformation) error {
 }
 
 func (device Device) SystemReboot() (string, error) {
+	return device.SystemRebootContext(context.Background())
+}
+
+// SystemRebootContext is like SystemReboot but sends the request with ctx.
+func (device Device) SystemRebootContext(ctx context.Context) (string, error) {
 	// create SOAP
 	soap := SOAP{
 		XMLNs:    deviceXMLNs,
@@ -584,7 +644,7 @@ func (device Device) SystemReboot() (string, error) {
 	var message string
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 
 	if err != nil {
 		return message, err
@@ -605,6 +665,11 @@ func (device Device) SystemReboot() (string, error) {
 }
 
 func (device Device) GetDNS() (DNSInformation, error) {
+	return device.GetDNSContext(context.Background())
+}
+
+// GetDNSContext is like GetDNS but sends the request with ctx.
+func (device Device) GetDNSContext(ctx context.Context) (DNSInformation, error) {
 	soap := SOAP{
 		XMLNs:    deviceXMLNs,
 		User:     device.User,
@@ -615,7 +680,7 @@ func (device Device) GetDNS() (DNSInformation, error) {
 	dnsInformation := DNSInformation{}
 
 	// send soap request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return dnsInformation, err
 	}
@@ -661,6 +726,11 @@ func (device Device) GetDNS() (DNSInformation, error) {
 }
 
 func (device Device) SetDNS(dnsInformation DNSInformation) error {
+	return device.SetDNSContext(context.Background(), dnsInformation)
+}
+
+// SetDNSContext is like SetDNS but sends the request with ctx.
+func (device Device) SetDNSContext(ctx context.Context, dnsInformation DNSInformation) error {
 	// create soap
 	soap := SOAP{
 		XMLNs:    deviceXMLNs,
@@ -668,16 +738,16 @@ func (device Device) SetDNS(dnsInformation DNSInformation) error {
 		Password: device.Password,
 		Body: `<SetDNS xmlns="http://www.onvif.org/ver10/device/wsdl">
 				<FromDHCP>` + boolToString(dnsInformation.FromDHCP) + `</FromDHCP>
-				<SearchDomain>` + dnsInformation.SearchDomain + `</SearchDomain>
+				<SearchDomain>` + escapeXML(dnsInformation.SearchDomain) + `</SearchDomain>
 				<DNSManual>
-					<Type xmlns="http://www.onvif.org/ver10/schema">` + dnsInformation.DNSAddress[0].Type + `</Type>
-					<IPv4Address xmlns="http://www.onvif.org/ver10/schema">` + dnsInformation.DNSAddress[0].IPv4Address + `</IPv4Address>
+					<Type xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(dnsInformation.DNSAddress[0].Type) + `</Type>
+					<IPv4Address xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(dnsInformation.DNSAddress[0].IPv4Address) + `</IPv4Address>
 				</DNSManual>
 			  </SetDNS>`,
 	}
 
 	// send soap request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 
 	if err != nil {
 		return err
@@ -692,6 +762,11 @@ func (device Device) SetDNS(dnsInformation DNSInformation) error {
 }
 
 func (device Device) GetDynamicDNS() (DynamicDNSInformation, error) {
+	return device.GetDynamicDNSContext(context.Background())
+}
+
+// GetDynamicDNSContext is like GetDynamicDNS but sends the request with ctx.
+func (device Device) GetDynamicDNSContext(ctx context.Context) (DynamicDNSInformation, error) {
 	soap := SOAP{
 		XMLNs:    deviceXMLNs,
 		User:     device.User,
@@ -701,7 +776,7 @@ func (device Device) GetDynamicDNS() (DynamicDNSInformation, error) {
 	result := DynamicDNSInformation{}
 
 	// send resquest
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -725,18 +800,23 @@ func (device Device) GetDynamicDNS() (DynamicDNSInformation, error) {
 }
 
 func (device Device) SetHostName(nameToken string) error {
+	return device.SetHostNameContext(context.Background(), nameToken)
+}
+
+// SetHostNameContext is like SetHostName but sends the request with ctx.
+func (device Device) SetHostNameContext(ctx context.Context, nameToken string) error {
 	// create soap
 	soap := SOAP{
 		XMLNs:    deviceXMLNs,
 		User:     device.User,
 		Password: device.Password,
 		Body: `<SetHostname xmlns="http://www.onvif.org/ver10/device/wsdl">
-				<Name xmlns="http://www.onvif.org/ver10/schema">` + nameToken + `</Name>
+				<Name xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(nameToken) + `</Name>
 			   </SetHostname>`,
 	}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -750,17 +830,22 @@ func (device Device) SetHostName(nameToken string) error {
 }
 
 func (device Device) GetNetworkProtocols() ([]NetworkProtocol, error) {
+	return device.GetNetworkProtocolsContext(context.Background())
+}
+
+// GetNetworkProtocolsContext is like GetNetworkProtocols but sends the request with ctx.
+func (device Device) GetNetworkProtocolsContext(ctx context.Context) ([]NetworkProtocol, error) {
 	// create soap
 	soap := SOAP{
 		XMLNs:    deviceXMLNs,
 		User:     device.User,
 		Password: device.Password,
-		Body:     `<GetNetworkProtocols xmlns:="http://www.onvif.org/ver10/device/wsdl"/>`,
+		Body:     `<GetNetworkProtocols xmlns="http://www.onvif.org/ver10/device/wsdl"/>`,
 	}
 
 	result := []NetworkProtocol{}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -788,12 +873,17 @@ func (device Device) GetNetworkProtocols() ([]NetworkProtocol, error) {
 }
 
 func (device Device) SetNetworkProtocols(protocols []NetworkProtocol) error {
+	return device.SetNetworkProtocolsContext(context.Background(), protocols)
+}
+
+// SetNetworkProtocolsContext is like SetNetworkProtocols but sends the request with ctx.
+func (device Device) SetNetworkProtocolsContext(ctx context.Context, protocols []NetworkProtocol) error {
 	// create body for array protocols
 	var protocolsBody string = ``
 	for _, protocol := range protocols {
 		protocolsBody += `<NetworkProtocols>
-							<Name xmlns="http://www.onvif.org/ver10/schema">` + protocol.Name + `</Name>
-							<Enabled xmlns="http://www.onvif.org/ver10/schema">` + boolToString(protocol.Enabled) + `</Enable>
+							<Name xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(protocol.Name) + `</Name>
+							<Enabled xmlns="http://www.onvif.org/ver10/schema">` + boolToString(protocol.Enabled) + `</Enabled>
 							<Port xmlns="http://www.onvif.org/ver10/schema">` + intToString(protocol.Port) + `</Port>
 						  </NetworkProtocols>`
 	}
@@ -806,7 +896,7 @@ func (device Device) SetNetworkProtocols(protocols []NetworkProtocol) error {
 		Body:     `<SetNetworkProtocols xmlns="http://www.onvif.org/ver10/device/wsdl">` + protocolsBody + `</SetNetworkProtocols>`,
 	}
 	// send soap request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -820,10 +910,15 @@ func (device Device) SetNetworkProtocols(protocols []NetworkProtocol) error {
 }
 
 func (device Device) SetScopes(listScopes []string) error {
+	return device.SetScopesContext(context.Background(), listScopes)
+}
+
+// SetScopesContext is like SetScopes but sends the request with ctx.
+func (device Device) SetScopesContext(ctx context.Context, listScopes []string) error {
 	// create scopes body
 	var scopesBody string
 	for _, scope := range listScopes {
-		scopesBody += `<Scopes>` + scope + `</Scopes>`
+		scopesBody += `<Scopes>` + escapeXML(scope) + `</Scopes>`
 	}
 
 	// create soap
@@ -835,7 +930,7 @@ func (device Device) SetScopes(listScopes []string) error {
 	}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -849,10 +944,15 @@ func (device Device) SetScopes(listScopes []string) error {
 }
 
 func (device Device) AddScopes(listScopes []string) error {
+	return device.AddScopesContext(context.Background(), listScopes)
+}
+
+// AddScopesContext is like AddScopes but sends the request with ctx.
+func (device Device) AddScopesContext(ctx context.Context, listScopes []string) error {
 	// create scopes body
 	var scopesBody string
 	for _, scope := range listScopes {
-		scopesBody += `<ScopeItem>` + scope + `</ScopeItem>`
+		scopesBody += `<ScopeItem>` + escapeXML(scope) + `</ScopeItem>`
 	}
 
 	// create soap
@@ -864,7 +964,7 @@ func (device Device) AddScopes(listScopes []string) error {
 	}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -878,10 +978,15 @@ func (device Device) AddScopes(listScopes []string) error {
 }
 
 func (device Device) RemoveScopes(listScopes []string) ([]string, error) {
+	return device.RemoveScopesContext(context.Background(), listScopes)
+}
+
+// RemoveScopesContext is like RemoveScopes but sends the request with ctx.
+func (device Device) RemoveScopesContext(ctx context.Context, listScopes []string) ([]string, error) {
 	// create scopes body
 	var scopesBody string
 	for _, scope := range listScopes {
-		scopesBody += `<ScopeItem>` + scope + `</ScopeItem>`
+		scopesBody += `<ScopeItem>` + escapeXML(scope) + `</ScopeItem>`
 	}
 	// create soap
 	soap := SOAP{
@@ -893,7 +998,7 @@ func (device Device) RemoveScopes(listScopes []string) ([]string, error) {
 
 	var result []string
 	// send request
-	respone, err := soap.SendRequest(device.XAddr)
+	respone, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -908,6 +1013,11 @@ func (device Device) RemoveScopes(listScopes []string) ([]string, error) {
 }
 
 func (device Device) GetNetworkDefaultGateway() (NetworkGateway, error) {
+	return device.GetNetworkDefaultGatewayContext(context.Background())
+}
+
+// GetNetworkDefaultGatewayContext is like GetNetworkDefaultGateway but sends the request with ctx.
+func (device Device) GetNetworkDefaultGatewayContext(ctx context.Context) (NetworkGateway, error) {
 	//create soap
 	soap := SOAP{
 		User:     device.User,
@@ -917,7 +1027,7 @@ func (device Device) GetNetworkDefaultGateway() (NetworkGateway, error) {
 
 	result := NetworkGateway{}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -936,16 +1046,21 @@ func (device Device) GetNetworkDefaultGateway() (NetworkGateway, error) {
 }
 
 func (device Device) SetNetworkDefaultGateway(defaultGateway NetworkGateway) error {
+	return device.SetNetworkDefaultGatewayContext(context.Background(), defaultGateway)
+}
+
+// SetNetworkDefaultGatewayContext is like SetNetworkDefaultGateway but sends the request with ctx.
+func (device Device) SetNetworkDefaultGatewayContext(ctx context.Context, defaultGateway NetworkGateway) error {
 	//create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<SetNetworkDefaultGateway xmlns="http://www.onvif.org/ver10/device/wsdl">
-					<IPv4Address>` + defaultGateway.IPv4Address + `</IPv4Address>
+					<IPv4Address>` + escapeXML(defaultGateway.IPv4Address) + `</IPv4Address>
  			  </SetNetworkDefaultGateway>`,
 	}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 
 	if err != nil {
 		return err
@@ -959,6 +1074,11 @@ func (device Device) SetNetworkDefaultGateway(defaultGateway NetworkGateway) err
 }
 
 func (device Device) GetUsers() ([]User, error) {
+	return device.GetUsersContext(context.Background())
+}
+
+// GetUsersContext is like GetUsers but sends the request with ctx.
+func (device Device) GetUsersContext(ctx context.Context) ([]User, error) {
 	//create soap
 	soap := SOAP{
 		User:     device.User,
@@ -969,7 +1089,7 @@ func (device Device) GetUsers() ([]User, error) {
 	result := []User{}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -996,18 +1116,23 @@ func (device Device) GetUsers() ([]User, error) {
 }
 
 func (device Device) SetUser(user User) error {
+	return device.SetUserContext(context.Background(), user)
+}
+
+// SetUserContext is like SetUser but sends the request with ctx.
+func (device Device) SetUserContext(ctx context.Context, user User) error {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<SetUser xmlns="http://www.onvif.org/ver10/device/wsdl"><User>
-					<Username xmlns="http://www.onvif.org/ver10/schema">` + user.Username + `</Username>
-					<Password xmlns="http://www.onvif.org/ver10/schema">` + user.Password + `</Password>
-					<UserLevel xmlns="http://www.onvif.org/ver10/schema">` + user.UserLevel + `</UserLevel>
+					<Username xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(user.Username) + `</Username>
+					<Password xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(user.Password) + `</Password>
+					<UserLevel xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(user.UserLevel) + `</UserLevel>
 				</User></SetUser>`,
 	}
 	// send soap request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -1021,10 +1146,15 @@ func (device Device) SetUser(user User) error {
 }
 
 func (device Device) DeleteUsers(usernames []string) error {
+	return device.DeleteUsersContext(context.Background(), usernames)
+}
+
+// DeleteUsersContext is like DeleteUsers but sends the request with ctx.
+func (device Device) DeleteUsersContext(ctx context.Context, usernames []string) error {
 	// create usernamebody
 	var usernameBody = ``
 	for _, username := range usernames {
-		usernameBody += `<Username>` + username + `</Username>`
+		usernameBody += `<Username>` + escapeXML(username) + `</Username>`
 	}
 
 	// create soap
@@ -1035,7 +1165,7 @@ func (device Device) DeleteUsers(usernames []string) error {
 	}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -1049,13 +1179,18 @@ func (device Device) DeleteUsers(usernames []string) error {
 }
 
 func (device Device) CreateUsers(users []User) error {
+	return device.CreateUsersContext(context.Background(), users)
+}
+
+// CreateUsersContext is like CreateUsers but sends the request with ctx.
+func (device Device) CreateUsersContext(ctx context.Context, users []User) error {
 	// create UserBody
 	var userBody = ``
 	for _, user := range users {
 		userBody += `<User>
-						<Username xmlns="http://www.onvif.org/ver10/schema">` + user.Username + `</Username>
-						<Password xmlns="http://www.onvif.org/ver10/schema">` + user.Password + `</Password>
-						<UserLevel xmlns="http://www.onvif.org/ver10/schema">` + user.UserLevel + `</UserLevel>
+						<Username xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(user.Username) + `</Username>
+						<Password xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(user.Password) + `</Password>
+						<UserLevel xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(user.UserLevel) + `</UserLevel>
 					 </User>`
 	}
 
@@ -1067,7 +1202,7 @@ func (device Device) CreateUsers(users []User) error {
 	}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -1081,6 +1216,11 @@ func (device Device) CreateUsers(users []User) error {
 }
 
 func (device Device) GetRelayOutputs() (RelayOutput, error) {
+	return device.GetRelayOutputsContext(context.Background())
+}
+
+// GetRelayOutputsContext is like GetRelayOutputs but sends the request with ctx.
+func (device Device) GetRelayOutputsContext(ctx context.Context) (RelayOutput, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -1091,7 +1231,7 @@ func (device Device) GetRelayOutputs() (RelayOutput, error) {
 	result := RelayOutput{}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1117,6 +1257,11 @@ func (device Device) GetRelayOutputs() (RelayOutput, error) {
 }
 
 func (device Device) GetZeroConfiguration() (NetworkZeroConfiguration, error) {
+	return device.GetZeroConfigurationContext(context.Background())
+}
+
+// GetZeroConfigurationContext is like GetZeroConfiguration but sends the request with ctx.
+func (device Device) GetZeroConfigurationContext(ctx context.Context) (NetworkZeroConfiguration, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -1127,7 +1272,7 @@ func (device Device) GetZeroConfiguration() (NetworkZeroConfiguration, error) {
 	result := NetworkZeroConfiguration{}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1150,11 +1295,16 @@ func (device Device) GetZeroConfiguration() (NetworkZeroConfiguration, error) {
 		}
 	}
 
-	glog.Info(result)
+	logAt(device.Logger, LogDebug, "zero configuration", "xaddr", redact(device.XAddr), "operation", "GetZeroConfiguration", "result", result)
 	return result, nil
 }
 
 func (device Device) GetServices() ([]Service, error) {
+	return device.GetServicesContext(context.Background())
+}
+
+// GetServicesContext is like GetServices but sends the request with ctx.
+func (device Device) GetServicesContext(ctx context.Context) ([]Service, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -1165,7 +1315,7 @@ func (device Device) GetServices() ([]Service, error) {
 	result := []Service{}
 
 	//send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1197,6 +1347,11 @@ func (device Device) GetServices() ([]Service, error) {
 }
 
 func (device Device) GetServiceCapabilities() ([]Service, error) {
+	return device.GetServiceCapabilitiesContext(context.Background())
+}
+
+// GetServiceCapabilitiesContext is like GetServiceCapabilities but sends the request with ctx.
+func (device Device) GetServiceCapabilitiesContext(ctx context.Context) ([]Service, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -1207,7 +1362,7 @@ func (device Device) GetServiceCapabilities() ([]Service, error) {
 	result := []Service{}
 
 	//send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1257,6 +1412,10 @@ func (device Device) GetServiceCapabilities() ([]Service, error) {
 							system.RemoteDiscovery = interfaceToBool(mapSystem["-RemoteDiscovery"])
 							system.SystemBackup = interfaceToBool(mapSystem["-SystemBackup"])
 							system.SystemLogging = interfaceToBool(mapSystem["-SystemLogging"])
+							system.HttpFirmwareUpgrade = interfaceToBool(mapSystem["-HttpFirmwareUpgrade"])
+							system.HttpSystemBackup = interfaceToBool(mapSystem["-HttpSystemBackup"])
+							system.HttpSystemLogging = interfaceToBool(mapSystem["-HttpSystemLogging"])
+							system.HttpSupportInformation = interfaceToBool(mapSystem["-HttpSupportInformation"])
 						}
 						deviceCapabilities.System = system
 
@@ -0,0 +1,144 @@
+package digest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// onlyReader hides everything but Read, so http.NewRequest cannot set
+// GetBody.
+type onlyReader struct {
+	io.Reader
+}
+
+// newBodyServer starts a server that reads the whole body before answering
+// with a digest challenge, and records the bodies of authorized requests.
+func newBodyServer(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Digest ") {
+			w.Header().Set("WWW-Authenticate", `Digest realm="onvif", nonce="abc", qop="auth"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), bodies...)
+	}
+}
+
+func TestTransportReplaysBody(t *testing.T) {
+	const payload = `<s:Envelope><s:Body><tds:GetDeviceInformation/></s:Body></s:Envelope>`
+	bodies := map[string]func() io.Reader{
+		"rewindable": func() io.Reader { return bytes.NewBufferString(payload) },
+		"reader":     func() io.Reader { return onlyReader{strings.NewReader(payload)} },
+	}
+
+	for name, body := range bodies {
+		server, received := newBodyServer(t)
+		transport := &Transport{Username: "admin", Password: "secret", Transport: http.DefaultTransport}
+
+		req, err := http.NewRequest("POST", server.URL, body())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d", name, resp.StatusCode)
+		}
+
+		if got := received(); len(got) != 1 || got[0] != payload {
+			t.Fatalf("%s: server received %q", name, got)
+		}
+	}
+}
+
+func TestTransportReplaysBodyAfterStaleNonce(t *testing.T) {
+	const payload = "payload"
+	handler, server := newDigestServer(t)
+	transport := &Transport{Username: "admin", Password: "secret", Transport: http.DefaultTransport}
+
+	var bodies []string
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		if recorder.Code == http.StatusOK {
+			bodies = append(bodies, string(body))
+		}
+		for k, v := range recorder.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(recorder.Code)
+	})
+
+	for i := 0; i < 2; i++ {
+		if i == 1 {
+			handler.stale = true
+		}
+		req, _ := http.NewRequest("POST", server.URL, onlyReader{strings.NewReader(payload)})
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if len(bodies) != 2 || bodies[0] != payload || bodies[1] != payload {
+		t.Fatalf("server received %q", bodies)
+	}
+}
+
+// closeRecorder records whether a request body was closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (body *closeRecorder) Close() error {
+	body.closed = true
+	return nil
+}
+
+func TestTransportClosesBodyWithCachedChallenge(t *testing.T) {
+	server, _ := newBodyServer(t)
+	transport := &Transport{Username: "admin", Password: "secret", Transport: http.DefaultTransport}
+
+	for i := 0; i < 2; i++ {
+		body := &closeRecorder{Reader: strings.NewReader("payload")}
+		req, err := http.NewRequest("POST", server.URL, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader("payload")), nil
+		}
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if !body.closed {
+			t.Fatalf("request %d: body was not closed", i+1)
+		}
+	}
+}
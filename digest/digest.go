@@ -13,10 +13,10 @@
 // limitations under the License.
 
 // The digest package provides an implementation of http.RoundTripper that takes
-// care of HTTP Digest Authentication (http://www.ietf.org/rfc/rfc2617.txt).
-// This only implements the MD5 and "auth" portions of the RFC, but that covers
-// the majority of avalible server side implementations including apache web
-// server.
+// care of HTTP Digest Authentication (https://tools.ietf.org/html/rfc7616).
+// It implements the MD5, SHA-256 and SHA-512-256 algorithms and their -sess
+// variants, "auth" and "auth-int" protection and username hashing, picking
+// the strongest algorithm the server offers.
 //
 // Example usage:
 //
@@ -44,17 +44,21 @@
 package digest
 
 import (
+	"bytes"
 	"crypto/md5"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/tls"
 	"errors"
 	"fmt"
-	"github.com/golang/glog"
+	"hash"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -70,6 +74,17 @@ type Transport struct {
 	Username  string
 	Password  string
 	Transport http.RoundTripper
+
+	// The credentials built from the challenges the servers accepted, so a
+	// long-lived Transport can authenticate follow-up requests directly.
+	mu     sync.Mutex
+	cache  map[cacheKey]*credentials
+	realms map[string]string // key: host, value: realm it last challenged with
+}
+
+type cacheKey struct {
+	host  string
+	realm string
 }
 
 // NewTransport creates a new digest transport using the http.DefaultTransport.
@@ -97,6 +112,23 @@ func NewTransport(username, password string) *Transport {
 	return t
 }
 
+// algorithms are the digest algorithms we support, in order of preference.
+var algorithms = []string{"SHA-512-256", "SHA-512-256-sess", "SHA-256", "SHA-256-sess", "MD5", "MD5-sess"}
+
+// hashFor returns the hash function of a digest algorithm, with or without
+// its -sess suffix, or nil if the algorithm is not supported.
+func hashFor(algorithm string) func() hash.Hash {
+	switch strings.ToUpper(strings.TrimSuffix(strings.ToLower(algorithm), "-sess")) {
+	case "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	case "SHA-512-256":
+		return sha512.New512_256
+	}
+	return nil
+}
+
 type challenge struct {
 	Realm     string
 	Domain    string
@@ -105,44 +137,129 @@ type challenge struct {
 	Stale     string
 	Algorithm string
 	Qop       string
+	Userhash  bool
+	nextNonce string // from Authentication-Info
 }
 
-func parseChallenge(input string) (*challenge, error) {
-	const ws = " \n\r\t"
-	const qs = `"`
-	s := strings.Trim(input, ws)
-	if !strings.HasPrefix(s, "Digest ") {
-		return nil, ErrBadChallenge
+// set stores the challenge parameter name.
+func (c *challenge) set(name, value string) {
+	switch strings.ToLower(name) {
+	case "realm":
+		c.Realm = value
+	case "domain":
+		c.Domain = value
+	case "nonce":
+		c.Nonce = value
+	case "opaque":
+		c.Opaque = value
+	case "stale":
+		c.Stale = value
+	case "algorithm":
+		c.Algorithm = value
+	case "qop":
+		// Prefer "auth", which does not need the request body
+		c.Qop = value
+		for _, qop := range []string{"auth", "auth-int"} {
+			for _, offered := range strings.Split(value, ",") {
+				if strings.TrimSpace(offered) == qop {
+					c.Qop = qop
+					return
+				}
+			}
+		}
+	case "userhash":
+		c.Userhash = strings.EqualFold(value, "true")
+	case "nextnonce":
+		c.nextNonce = value
+	}
+}
+
+// parseChallenges returns the digest challenges in the values of the
+// WWW-Authenticate headers. A value may hold several challenges, of any
+// scheme; parameters we don't know are ignored.
+func parseChallenges(headers []string) []*challenge {
+	var challenges []*challenge
+	for _, s := range headers {
+		var current *challenge
+		for {
+			s = strings.TrimLeft(s, " \t\r\n,")
+			if s == "" {
+				break
+			}
+
+			end := strings.IndexAny(s, " \t\r\n=,")
+			if end == -1 {
+				end = len(s)
+			} else if end == 0 {
+				s = s[1:]
+				continue
+			}
+			token := s[:end]
+			s = strings.TrimLeft(s[end:], " \t")
+
+			// A token without a value starts a new challenge
+			if !strings.HasPrefix(s, "=") {
+				current = nil
+				if strings.EqualFold(token, "Digest") {
+					current = &challenge{Algorithm: "MD5"}
+					challenges = append(challenges, current)
+				}
+				continue
+			}
+
+			var value string
+			value, s = parseValue(strings.TrimLeft(s[1:], " \t"))
+			if current != nil {
+				current.set(token, value)
+			}
+		}
 	}
-	s = strings.Trim(s[7:], ws)
-	sl := strings.Split(s, ", ")
-	c := &challenge{
-		Algorithm: "MD5",
-	}
-	var r []string
-	for i := range sl {
-		r = strings.SplitN(sl[i], "=", 2)
-		switch r[0] {
-		case "realm":
-			c.Realm = strings.Trim(r[1], qs)
-		case "domain":
-			c.Domain = strings.Trim(r[1], qs)
-		case "nonce":
-			c.Nonce = strings.Trim(r[1], qs)
-		case "opaque":
-			c.Opaque = strings.Trim(r[1], qs)
-		case "stale":
-			c.Stale = strings.Trim(r[1], qs)
-		case "algorithm":
-			c.Algorithm = strings.Trim(r[1], qs)
-		case "qop":
-			//TODO(gavaletz) should be an array of strings?
-			c.Qop = strings.Trim(r[1], qs)
+	return challenges
+}
+
+// parseValue splits a token or quoted string parameter value from the rest
+// of the header.
+func parseValue(s string) (string, string) {
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexAny(s, " \t\r\n,")
+		if end == -1 {
+			return s, ""
+		}
+		return s[:end], s[end:]
+	}
+
+	var value strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value.WriteByte(s[i])
+			}
+		case '"':
+			return value.String(), s[i+1:]
 		default:
-			return nil, ErrBadChallenge
+			value.WriteByte(s[i])
 		}
 	}
-	return c, nil
+	return value.String(), ""
+}
+
+// parseChallenge picks the challenge with the strongest algorithm we support
+// from the WWW-Authenticate headers.
+func parseChallenge(headers []string) (*challenge, error) {
+	challenges := parseChallenges(headers)
+	if len(challenges) == 0 {
+		return nil, ErrBadChallenge
+	}
+	for _, algorithm := range algorithms {
+		for _, c := range challenges {
+			if strings.EqualFold(c.Algorithm, algorithm) {
+				return c, nil
+			}
+		}
+	}
+	return nil, ErrAlgNotImplemented
 }
 
 type credentials struct {
@@ -155,31 +272,55 @@ type credentials struct {
 	Opaque     string
 	MessageQop string
 	NonceCount int
+	Userhash   bool
 	method     string
 	password   string
+	entity     []byte // the request body, for "auth-int"
+	sessionKey string // the -sess HA1, fixed by the first response to the challenge
 }
 
-func h(data string) string {
-	hf := md5.New()
+func (c *credentials) h(data string) string {
+	hf := hashFor(c.Algorithm)()
 	io.WriteString(hf, data)
 	return fmt.Sprintf("%x", hf.Sum(nil))
 }
 
-func kd(secret, data string) string {
-	return h(fmt.Sprintf("%s:%s", secret, data))
+func (c *credentials) kd(secret, data string) string {
+	return c.h(fmt.Sprintf("%s:%s", secret, data))
 }
 
 func (c *credentials) ha1() string {
-	return h(fmt.Sprintf("%s:%s:%s", c.Username, c.Realm, c.password))
+	ha1 := c.h(fmt.Sprintf("%s:%s:%s", c.Username, c.Realm, c.password))
+	if strings.HasSuffix(strings.ToLower(c.Algorithm), "-sess") {
+		// The session key is computed once per challenge, from the nonce
+		// and cnonce of the first request (RFC 7616 section 3.4.2)
+		if c.sessionKey == "" {
+			c.sessionKey = c.h(fmt.Sprintf("%s:%s:%s", ha1, c.Nonce, c.Cnonce))
+		}
+		ha1 = c.sessionKey
+	}
+	return ha1
 }
 
 func (c *credentials) ha2() string {
-	return h(fmt.Sprintf("%s:%s", c.method, c.DigestURI))
+	if c.MessageQop == "auth-int" {
+		return c.h(fmt.Sprintf("%s:%s:%s", c.method, c.DigestURI, c.h(string(c.entity))))
+	}
+	return c.h(fmt.Sprintf("%s:%s", c.method, c.DigestURI))
+}
+
+// username returns the username to send, hashed when the server asked for
+// userhash.
+func (c *credentials) username() string {
+	if c.Userhash {
+		return c.h(fmt.Sprintf("%s:%s", c.Username, c.Realm))
+	}
+	return c.Username
 }
 
 func (c *credentials) resp(cnonce string) (string, error) {
 	c.NonceCount++
-	if c.MessageQop == "auth" {
+	if c.MessageQop == "auth" || c.MessageQop == "auth-int" {
 		if cnonce != "" {
 			c.Cnonce = cnonce
 		} else {
@@ -187,109 +328,269 @@ func (c *credentials) resp(cnonce string) (string, error) {
 			io.ReadFull(rand.Reader, b)
 			c.Cnonce = fmt.Sprintf("%x", b)[:16]
 		}
-		return kd(c.ha1(), fmt.Sprintf("%s:%08x:%s:%s:%s",
+		return c.kd(c.ha1(), fmt.Sprintf("%s:%08x:%s:%s:%s",
 			c.Nonce, c.NonceCount, c.Cnonce, c.MessageQop, c.ha2())), nil
 	} else if c.MessageQop == "" {
-		return kd(c.ha1(), fmt.Sprintf("%s:%s", c.Nonce, c.ha2())), nil
+		return c.kd(c.ha1(), fmt.Sprintf("%s:%s", c.Nonce, c.ha2())), nil
 	}
 	return "", ErrAlgNotImplemented
 }
 
 func (c *credentials) authorize() (string, error) {
-	// Note that this is only implemented for MD5 and NOT MD5-sess.
-	// MD5-sess is rarely supported and those that do are a big mess.
-	if c.Algorithm != "MD5" {
-		return "", ErrAlgNotImplemented
-	}
-	// Note that this is NOT implemented for "qop=auth-int".  Similarly the
-	// auth-int server side implementations that do exist are a mess.
-	if c.MessageQop != "auth" && c.MessageQop != "" {
+	if hashFor(c.Algorithm) == nil {
 		return "", ErrAlgNotImplemented
 	}
 	resp, err := c.resp("")
 	if err != nil {
-		return "", ErrAlgNotImplemented
+		return "", err
 	}
-	sl := []string{fmt.Sprintf(`username="%s"`, c.Username)}
-	sl = append(sl, fmt.Sprintf(`realm="%s"`, c.Realm))
-	sl = append(sl, fmt.Sprintf(`nonce="%s"`, c.Nonce))
-	sl = append(sl, fmt.Sprintf(`uri="%s"`, c.DigestURI))
+	return c.header(resp), nil
+}
+
+// header formats the Authorization header for the response digest.
+func (c *credentials) header(resp string) string {
+	sl := []string{fmt.Sprintf(`username=%s`, quote(c.username()))}
+	sl = append(sl, fmt.Sprintf(`realm=%s`, quote(c.Realm)))
+	sl = append(sl, fmt.Sprintf(`nonce=%s`, quote(c.Nonce)))
+	sl = append(sl, fmt.Sprintf(`uri=%s`, quote(c.DigestURI)))
 	sl = append(sl, fmt.Sprintf(`response="%s"`, resp))
 	if c.Algorithm != "" {
-		sl = append(sl, fmt.Sprintf(`algorithm="%s"`, c.Algorithm))
+		sl = append(sl, fmt.Sprintf("algorithm=%s", c.Algorithm))
 	}
 	if c.Opaque != "" {
-		sl = append(sl, fmt.Sprintf(`opaque="%s"`, c.Opaque))
+		sl = append(sl, fmt.Sprintf(`opaque=%s`, quote(c.Opaque)))
 	}
 	if c.MessageQop != "" {
 		sl = append(sl, fmt.Sprintf("qop=%s", c.MessageQop))
 		sl = append(sl, fmt.Sprintf("nc=%08x", c.NonceCount))
 		sl = append(sl, fmt.Sprintf(`cnonce="%s"`, c.Cnonce))
 	}
-	return fmt.Sprintf("Digest %s", strings.Join(sl, ", ")), nil
+	if c.Userhash {
+		sl = append(sl, "userhash=true")
+	}
+	return fmt.Sprintf("Digest %s", strings.Join(sl, ", "))
+}
+
+// quote returns s as a quoted string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// prepare points the credentials at req, reading its body when the digest
+// covers it.
+func (c *credentials) prepare(req *http.Request) error {
+	c.DigestURI = req.URL.RequestURI()
+	c.method = req.Method
+	c.entity = nil
+	if c.MessageQop != "auth-int" || req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if req.GetBody == nil {
+		return ErrAlgNotImplemented
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	c.entity, err = ioutil.ReadAll(body)
+	return err
 }
 
-func (t *Transport) newCredentials(req *http.Request, c *challenge) *credentials {
-	return &credentials{
+func (t *Transport) newCredentials(req *http.Request, c *challenge) (*credentials, error) {
+	cr := &credentials{
 		Username:   t.Username,
 		Realm:      c.Realm,
 		Nonce:      c.Nonce,
-		DigestURI:  req.URL.RequestURI(),
 		Algorithm:  c.Algorithm,
 		Opaque:     c.Opaque,
-		MessageQop: c.Qop, // "auth" must be a single value
+		MessageQop: c.Qop,
 		NonceCount: 0,
-		method:     req.Method,
+		Userhash:   c.Userhash,
 		password:   t.Password,
 	}
+	return cr, cr.prepare(req)
 }
 
 // RoundTrip makes a request expecting a 401 response that will require digest
 // authentication.  It creates the credentials it needs and makes a follow-up
-// request.
+// request.  Once a challenge has been accepted, later requests to the same
+// host and realm are authorized up front with the same nonce and an
+// incrementing nonce count, until the server answers with a new challenge.
 func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	if t.Transport == nil {
 		return nil, ErrNilTransport
 	}
 
-	// Copy the request so we don't modify the input.
-	req2 := new(http.Request)
-	*req2 = *req
-	req2.Header = make(http.Header)
-	for k, s := range req.Header {
-		req2.Header[k] = s
+	// The body may have to be sent twice, make sure it can be rewound.
+	req, err := rewindable(req)
+	if err != nil {
+		return nil, err
 	}
 
-	// Make a request to get the 401 that contains the challenge.
-	resp, err := t.Transport.RoundTrip(req)
-	if err != nil || resp.StatusCode != 401 {
-		return resp, err
-	}
-	chal := resp.Header.Get("WWW-Authenticate")
-	c, err := parseChallenge(chal)
-	if err != nil {
-		// Read response body
-		responseBody, errR := ioutil.ReadAll(resp.Body)
-		if errR == nil {
-			glog.Infof("Onvif response: %s", string(responseBody))
-			return resp, err
+	// Make a request to get the 401 that contains the challenge, or reuse
+	// the last challenge if we have one for this host.
+	first := req
+	key, auth, ok := t.cachedAuthorization(req)
+	if ok {
+		first, err = cloneRequest(req)
+		// The clone has its own copy of the body, so the caller's is
+		// closed here as the transport would have
+		if req.Body != nil {
+			req.Body.Close()
 		}
-		return resp, errR
+		if err != nil {
+			return nil, err
+		}
+		first.Header.Set("Authorization", auth)
 	}
-
-	// Form credentials based on the challenge.
-	cr := t.newCredentials(req2, c)
-	auth, err := cr.authorize()
+	resp, err := t.Transport.RoundTrip(first)
 	if err != nil {
 		return resp, err
 	}
+	if resp.StatusCode != 401 {
+		if ok {
+			t.nextNonce(key, resp)
+		}
+		return resp, nil
+	}
+	c, err := parseChallenge(resp.Header["Www-Authenticate"])
+	if err == ErrBadChallenge {
+		// Not a digest challenge, hand the 401 back to the caller.
+		return resp, nil
+	}
 
 	// We'll no longer use the initial response, so close it
 	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// The cached nonce expired (stale=true) or was refused, answer the new
+	// challenge instead.
+	req2, err := cloneRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	cr, err := t.newCredentials(req2, c)
+	if err != nil {
+		return nil, err
+	}
+	auth, err = cr.authorize()
+	if err != nil {
+		return nil, err
+	}
 
 	// Make authenticated request.
 	req2.Header.Set("Authorization", auth)
-	return t.Transport.RoundTrip(req2)
+	resp, err = t.Transport.RoundTrip(req2)
+	if err != nil {
+		return resp, err
+	}
+	key = cacheKey{req.URL.Host, c.Realm}
+	if resp.StatusCode == 401 {
+		t.forget(key)
+	} else {
+		t.remember(key, cr)
+		t.nextNonce(key, resp)
+	}
+	return resp, nil
+}
+
+// cachedAuthorization builds an Authorization header for req from the last
+// challenge its host accepted, incrementing its nonce count.
+func (t *Transport) cachedAuthorization(req *http.Request) (cacheKey, string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := cacheKey{req.URL.Host, t.realms[req.URL.Host]}
+	cr, ok := t.cache[key]
+	if !ok || cr.prepare(req) != nil {
+		return key, "", false
+	}
+	auth, err := cr.authorize()
+	if err != nil {
+		return key, "", false
+	}
+	return key, auth, true
+}
+
+func (t *Transport) remember(key cacheKey, cr *credentials) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cache == nil {
+		t.cache = make(map[cacheKey]*credentials)
+		t.realms = make(map[string]string)
+	}
+	t.cache[key] = cr
+	t.realms[key.host] = key.realm
+}
+
+func (t *Transport) forget(key cacheKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.cache, key)
+}
+
+// nextNonce switches the cached credentials to the nonce the server sent
+// for the next request in Authentication-Info, if any.
+func (t *Transport) nextNonce(key cacheKey, resp *http.Response) {
+	info := resp.Header.Get("Authentication-Info")
+	if info == "" {
+		return
+	}
+	challenges := parseChallenges([]string{"Digest " + info})
+	if len(challenges) == 0 || challenges[0].nextNonce == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cr, ok := t.cache[key]; ok {
+		cr.Nonce = challenges[0].nextNonce
+		cr.NonceCount = 0
+	}
+}
+
+// rewindable returns req, or a copy of it with the body buffered in memory
+// when the request cannot rewind its body itself.
+func rewindable(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return req, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	req2 := new(http.Request)
+	*req2 = *req
+	req2.ContentLength = int64(len(body))
+	req2.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	req2.Body, _ = req2.GetBody()
+	return req2, nil
+}
+
+// cloneRequest copies req so we don't modify the input, with its body
+// rewound for another attempt.
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	req2 := new(http.Request)
+	*req2 = *req
+	req2.Header = make(http.Header)
+	for k, s := range req.Header {
+		req2.Header[k] = s
+	}
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req2.Body = body
+	}
+	return req2, nil
 }
 
 // Client returns an HTTP client that uses the digest transport.
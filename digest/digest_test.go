@@ -0,0 +1,157 @@
+package digest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResponseVectors(t *testing.T) {
+	rfc7616 := credentials{
+		Username:   "Mufasa",
+		Realm:      "http-auth@example.org",
+		Nonce:      "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+		DigestURI:  "/dir/index.html",
+		MessageQop: "auth",
+		method:     "GET",
+		password:   "Circle of Life",
+	}
+	const cnonce = "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+
+	cases := []struct {
+		name     string
+		cr       credentials
+		cnonce   string
+		expected string
+	}{
+		// RFC 2617 section 3.5
+		{"RFC 2617 MD5", credentials{
+			Username:   "Mufasa",
+			Realm:      "testrealm@host.com",
+			Nonce:      "dcd98b7102dd2f0e8b11d0f600bfb0c093",
+			DigestURI:  "/dir/index.html",
+			Algorithm:  "MD5",
+			MessageQop: "auth",
+			method:     "GET",
+			password:   "Circle Of Life",
+		}, "0a4f113b", "6629fae49393a05397450978507c4ef1"},
+		// RFC 7616 section 3.9.1
+		{"RFC 7616 MD5", with(rfc7616, "MD5", "auth"), cnonce,
+			"8ca523f5e9506fed4657c9700eebdbec"},
+		{"RFC 7616 SHA-256", with(rfc7616, "SHA-256", "auth"), cnonce,
+			"753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+		// The RFC has no session example, so this one extends the one above
+		{"SHA-256-sess", with(rfc7616, "SHA-256-sess", "auth"), cnonce,
+			"2fd51b3a77ad75bad6afad6003e818d767133c46d9e2749e7f5232ae1ea3efd7"},
+		{"MD5-sess", with(rfc7616, "MD5-sess", "auth"), cnonce,
+			"e783283f46242139c486a698fec7211d"},
+		// RFC 7616 section 3.9.2. The response printed there was not
+		// computed from the example's inputs (see the RFC errata), so this
+		// one is recomputed from them.
+		{"RFC 7616 SHA-512-256", credentials{
+			Username:   "Jäsøn Doe",
+			Realm:      "api@example.org",
+			Nonce:      "5TsQWLVdgBdmrQ0XsxbDODV+57QdFR34I9HAbC/RVvkK",
+			DigestURI:  "/doc/index.html",
+			Algorithm:  "SHA-512-256",
+			MessageQop: "auth",
+			Userhash:   true,
+			method:     "GET",
+			password:   "Secret, or not?",
+		}, "NTg6RKcb9boFIAS3KrFK9BGeh+iDa/sm6jUMp2wds69v",
+			"93308f41873a77f41ea3d87886878276f1a92271362e72275c3d3a38cf9f5fd6"},
+	}
+
+	for _, c := range cases {
+		resp, err := c.cr.resp(c.cnonce)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if resp != c.expected {
+			t.Errorf("%s: response %s, expected %s", c.name, resp, c.expected)
+		}
+	}
+
+	authInt := with(rfc7616, "SHA-256", "auth-int")
+	authInt.method = "POST"
+	authInt.entity = []byte("hello")
+	if resp, _ := authInt.resp(cnonce); resp != "c98b95dbdb463c4483e324bced57d591946a6f84098142757b1333c52c47d62e" {
+		t.Errorf("auth-int: unexpected response %s", resp)
+	}
+}
+
+func TestSessionKeyOncePerChallenge(t *testing.T) {
+	cr := credentials{
+		Username:   "Mufasa",
+		Realm:      "http-auth@example.org",
+		Nonce:      "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+		DigestURI:  "/dir/index.html",
+		Algorithm:  "MD5-sess",
+		MessageQop: "auth",
+		method:     "GET",
+		password:   "Circle of Life",
+	}
+	if _, err := cr.resp("f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A later request brings its own cnonce, but keeps the session key
+	// of the first
+	if resp, _ := cr.resp("0a4f113b"); resp != "588a20c61c4ff8b98530282477c75dde" {
+		t.Fatalf("unexpected response %s", resp)
+	}
+}
+
+func with(cr credentials, algorithm, qop string) credentials {
+	cr.Algorithm = algorithm
+	cr.MessageQop = qop
+	return cr
+}
+
+func TestUserhash(t *testing.T) {
+	// RFC 7616 section 3.9.2
+	cr := credentials{Username: "Jäsøn Doe", Realm: "api@example.org", Algorithm: "SHA-512-256", Userhash: true}
+	if username := cr.username(); username != "793263caabb707a56211940d90411ea4a575adeccb7e360aeb624ed06ece9b0b" {
+		t.Fatalf("unexpected hashed username %s", username)
+	}
+	if header := cr.header("x"); !strings.Contains(header, "userhash=true") || strings.Contains(header, "Doe") {
+		t.Fatalf("unexpected header %s", header)
+	}
+}
+
+func TestParseChallengePrefersStrongestAlgorithm(t *testing.T) {
+	headers := []string{
+		`Basic realm="onvif"`,
+		`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=MD5, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+		`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS", userhash=true`,
+	}
+	c, err := parseChallenge(headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Algorithm != "SHA-256" || c.Qop != "auth" || !c.Userhash || c.Opaque != "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS" {
+		t.Fatalf("unexpected challenge %+v", c)
+	}
+
+	// Several challenges in one header
+	c, err = parseChallenge([]string{`Digest realm="a, b", nonce="1", algorithm=MD5, Digest realm="a, b", nonce="2", algorithm=SHA-512-256-sess, qop=auth-int`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Nonce != "2" || c.Realm != "a, b" || c.Qop != "auth-int" {
+		t.Fatalf("unexpected challenge %+v", c)
+	}
+
+	if _, err := parseChallenge([]string{`Basic realm="onvif"`}); err != ErrBadChallenge {
+		t.Fatalf("expected ErrBadChallenge, got %v", err)
+	}
+	if _, err := parseChallenge([]string{`Digest realm="onvif", nonce="1", algorithm=SHA-1`}); err != ErrAlgNotImplemented {
+		t.Fatalf("expected ErrAlgNotImplemented, got %v", err)
+	}
+}
+
+func TestHeaderQuotesValues(t *testing.T) {
+	cr := credentials{Username: `a"b\c`, Realm: "r", Nonce: "n", DigestURI: "/", Algorithm: "MD5"}
+	if header := cr.header("x"); !strings.Contains(header, `username="a\"b\\c"`) || !strings.Contains(header, "algorithm=MD5") {
+		t.Fatalf("unexpected header %s", header)
+	}
+}
@@ -0,0 +1,177 @@
+package digest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+var authParamRegexp = regexp.MustCompile(`(\w+)=(?:"((?:[^"\\]|\\.)*)"|([^,\s]+))`)
+
+// digestServer checks digest credentials for user "admin" with password
+// "secret", like a camera would.
+type digestServer struct {
+	mu         sync.Mutex
+	nonce      int
+	nc         map[string]int // key: nonce, value: last nonce count
+	stale      bool           // reject the current nonce as stale
+	nextNonce  bool           // hand out the next nonce in Authentication-Info
+	requests   int
+	challenges int
+}
+
+func (s *digestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ioutil.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	params := make(map[string]string)
+	for _, match := range authParamRegexp.FindAllStringSubmatch(r.Header.Get("Authorization"), -1) {
+		params[match[1]] = match[2] + match[3]
+	}
+	nonce := strconv.Itoa(s.nonce)
+	nc, _ := strconv.ParseInt(params["nc"], 16, 32)
+
+	cr := credentials{
+		Username:   params["username"],
+		Realm:      params["realm"],
+		Nonce:      params["nonce"],
+		DigestURI:  params["uri"],
+		Algorithm:  params["algorithm"],
+		MessageQop: params["qop"],
+		NonceCount: int(nc) - 1,
+		method:     r.Method,
+		password:   "secret",
+	}
+	valid := cr.Username == "admin" && cr.Realm == "onvif" && hashFor(cr.Algorithm) != nil
+	if valid {
+		expected, _ := cr.resp(params["cnonce"])
+		valid = expected == params["response"]
+	}
+
+	switch {
+	case !valid:
+	case params["nonce"] != nonce || s.stale:
+		s.stale = false
+		s.nonce++
+		s.challenge(w, true)
+		return
+	case int(nc) <= s.nc[nonce]:
+		// A replayed nonce count
+	default:
+		s.nc[nonce] = int(nc)
+		if s.nextNonce {
+			s.nonce++
+			w.Header().Set("Authentication-Info", fmt.Sprintf(`nextnonce="%d", qop=auth`, s.nonce))
+		}
+		w.Write([]byte("ok"))
+		return
+	}
+	s.challenge(w, false)
+}
+
+func (s *digestServer) challenge(w http.ResponseWriter, stale bool) {
+	s.challenges++
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="onvif", nonce="%d", qop="auth", algorithm=SHA-256, stale=%v`, s.nonce, stale))
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func (s *digestServer) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests, s.challenges
+}
+
+func newDigestServer(t *testing.T) (*digestServer, *httptest.Server) {
+	handler := &digestServer{nc: make(map[string]int)}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return handler, server
+}
+
+func get(t *testing.T, client *http.Client, url string) {
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+func TestTransportAuthorizesPreemptively(t *testing.T) {
+	handler, server := newDigestServer(t)
+	transport := &Transport{Username: "admin", Password: "secret", Transport: http.DefaultTransport}
+	client, _ := transport.Client()
+
+	for i := 0; i < 3; i++ {
+		get(t, client, server.URL+"/onvif/device_service")
+	}
+	if requests, challenges := handler.counts(); requests != 4 || challenges != 1 {
+		t.Fatalf("expected 4 requests and 1 challenge, got %d and %d", requests, challenges)
+	}
+	if nc := handler.nc["0"]; nc != 3 {
+		t.Fatalf("expected the nonce count to reach 3, got %d", nc)
+	}
+}
+
+func TestTransportAnswersStaleNonce(t *testing.T) {
+	handler, server := newDigestServer(t)
+	transport := &Transport{Username: "admin", Password: "secret", Transport: http.DefaultTransport}
+	client, _ := transport.Client()
+
+	get(t, client, server.URL)
+	handler.mu.Lock()
+	handler.stale = true
+	handler.mu.Unlock()
+
+	get(t, client, server.URL)
+	get(t, client, server.URL)
+	if requests, challenges := handler.counts(); requests != 5 || challenges != 2 {
+		t.Fatalf("expected 5 requests and 2 challenges, got %d and %d", requests, challenges)
+	}
+	if nc := handler.nc["1"]; nc != 2 {
+		t.Fatalf("expected the new nonce to be used twice, got nonce count %d", nc)
+	}
+}
+
+func TestTransportFollowsNextNonce(t *testing.T) {
+	handler, server := newDigestServer(t)
+	handler.nextNonce = true
+	transport := &Transport{Username: "admin", Password: "secret", Transport: http.DefaultTransport}
+	client, _ := transport.Client()
+
+	for i := 0; i < 3; i++ {
+		get(t, client, server.URL)
+	}
+	if requests, challenges := handler.counts(); requests != 4 || challenges != 1 {
+		t.Fatalf("expected 4 requests and 1 challenge, got %d and %d", requests, challenges)
+	}
+}
+
+func TestTransportForgetsRejectedCredentials(t *testing.T) {
+	handler, server := newDigestServer(t)
+	transport := &Transport{Username: "admin", Password: "wrong", Transport: http.DefaultTransport}
+	client, _ := transport.Client()
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("unexpected status %d", resp.StatusCode)
+		}
+	}
+	if requests, _ := handler.counts(); requests != 4 {
+		t.Fatalf("expected every call to start unauthenticated, got %d requests", requests)
+	}
+}
@@ -1,89 +1,510 @@
 package onvif
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"github.com/clbanning/mxj"
-	"github.com/golang/glog"
 	"github.com/google/uuid"
 	"net"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 var errWrongDiscoveryResponse = errors.New("Response is not related to discovery request ")
 
-// StartDiscovery send a WS-Discovery message and wait for all matching device to respond
+// StartDiscoveryOn sends WS-Discovery probes from the IPv4 and IPv6
+// addresses of an interface and waits for all matching devices to respond
 func StartDiscoveryOn(interfaceName string, duration time.Duration) ([]Device, error) {
 	itf, err := net.InterfaceByName(interfaceName) //here your interface
+	if err != nil {
+		return []Device{}, err
+	}
+
+	return discoverOnInterface(*itf, duration)
+}
+
+// StartDiscovery send a WS-Discovery message and wait for all matching device to respond
+func StartDiscovery(interfaceName string, duration time.Duration) ([]Device, error) {
+	// Get list of interface address
+	if interfaceName != "" {
+		return StartDiscoveryOn(interfaceName, duration)
+	}
 
+	itfs, err := net.Interfaces()
 	if err != nil {
 		return []Device{}, err
 	}
 
-	item, _ := itf.Addrs()
-	var ip net.IP
-	for _, addr := range item {
-		switch v := addr.(type) {
-		case *net.IPNet:
-			if !v.IP.IsLoopback() {
-				if v.IP.To4() != nil { //Verify if IP is IPV4
-					ip = v.IP
+	// Create initial discovery results
+	var discoveryResults []Device
+
+	// Discover device on each interface's network
+	for _, itf := range itfs {
+		devices, err := discoverOnInterface(itf, duration)
+		if err != nil {
+			return []Device{}, err
+		}
+
+		discoveryResults = append(discoveryResults, devices...)
+	}
+
+	return discoveryResults, nil
+}
+
+// onvifScopePrefix starts the scopes defined by ONVIF.
+const onvifScopePrefix = "onvif://www.onvif.org/"
+
+// DiscoveredDevice is a device that answered WS-Discovery.
+type DiscoveredDevice struct {
+	ID              string   // endpoint UUID, without the urn:uuid: prefix
+	XAddrs          []string // every address of the device service
+	Scopes          []string
+	Types           []string
+	MetadataVersion int
+	Source          net.Addr // where the answer came from
+
+	// Parsed from the ONVIF scopes
+	Name      string
+	Hardware  string
+	Locations []string // such as "building3" or "country/china"
+	Profiles  []string // such as "Streaming" or "T"
+}
+
+// Device returns a Device for the discovered device, using the XAddr most
+// likely to be reachable: one on the address the answer came from, else one
+// of the same IP family, else the first.
+func (device DiscoveredDevice) Device() Device {
+	result := Device{ID: device.ID, Name: device.Name}
+	if len(device.XAddrs) == 0 {
+		return result
+	}
+	result.XAddr = device.XAddrs[0]
+
+	source, ok := device.Source.(*net.UDPAddr)
+	if !ok {
+		return result
+	}
+	sameFamily := ""
+	for _, xAddr := range device.XAddrs {
+		urlXAddr, err := url.Parse(xAddr)
+		if err != nil {
+			continue
+		}
+		ip := net.ParseIP(urlXAddr.Hostname())
+		if ip.Equal(source.IP) {
+			result.XAddr = xAddr
+			return result
+		}
+		if ip != nil && sameFamily == "" && (ip.To4() == nil) == (source.IP.To4() == nil) {
+			sameFamily = xAddr
+		}
+	}
+	if sameFamily != "" {
+		result.XAddr = sameFamily
+	}
+	return result
+}
+
+// HasProfile reports whether the device claims an ONVIF profile, such as
+// "Streaming" or "T".
+func (device DiscoveredDevice) HasProfile(profile string) bool {
+	for _, p := range device.Profiles {
+		if strings.EqualFold(p, profile) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultDiscoveryDuration is how long DiscoverStream waits for answers when
+// no duration is given.
+const defaultDiscoveryDuration = 3 * time.Second
+
+// DiscoveryOptions configures DiscoverStream.
+type DiscoveryOptions struct {
+	// Interface is the name of the network interface to probe from. All
+	// interfaces are probed when empty.
+	Interface string
+	// Duration is how long to wait for devices to answer, 3 seconds if
+	// zero.
+	Duration time.Duration
+	// Types are the types of device to probe for, TypeNetworkVideoTransmitter
+	// if empty. Types ONVIF does not predefine, such as those of access
+	// control devices, can be given as a DeviceType literal.
+	Types []DeviceType
+	// Scopes limits the probe to devices that have all these scopes, such
+	// as "onvif://www.onvif.org/Profile/T" or
+	// "onvif://www.onvif.org/location/building3".
+	Scopes []string
+	// MatchBy is the rule scopes are matched by, MatchByRFC3986 if empty.
+	MatchBy string
+}
+
+// DeviceType is a type of device in a WS-Discovery probe, a qualified name.
+type DeviceType struct {
+	Namespace string
+	Name      string
+}
+
+// The device types ONVIF defines.
+var (
+	TypeNetworkVideoTransmitter = DeviceType{"http://www.onvif.org/ver10/network/wsdl", "NetworkVideoTransmitter"}
+	TypeNetworkVideoDisplay     = DeviceType{"http://www.onvif.org/ver10/network/wsdl", "NetworkVideoDisplay"}
+	TypeDevice                  = DeviceType{"http://www.onvif.org/ver10/device/wsdl", "Device"}
+)
+
+// The WS-Discovery rules for matching scopes.
+const (
+	MatchByRFC3986 = "http://schemas.xmlsoap.org/ws/2005/04/discovery/rfc3986"
+	MatchByUUID    = "http://schemas.xmlsoap.org/ws/2005/04/discovery/uuid"
+	MatchByLDAP    = "http://schemas.xmlsoap.org/ws/2005/04/discovery/ldap"
+	MatchByStrcmp0 = "http://schemas.xmlsoap.org/ws/2005/04/discovery/strcmp0"
+)
+
+// probeBody returns the Probe element for the options.
+func (opts DiscoveryOptions) probeBody() string {
+	types := opts.Types
+	if len(types) == 0 {
+		types = []DeviceType{TypeNetworkVideoTransmitter}
+	}
+
+	var namespaces, names []string
+	for i, deviceType := range types {
+		prefix := "dp" + strconv.Itoa(i)
+		namespaces = append(namespaces, `xmlns:`+prefix+`="`+escapeXML(deviceType.Namespace)+`"`)
+		names = append(names, prefix+":"+escapeXML(deviceType.Name))
+	}
+
+	body := `<Probe xmlns="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+		<d:Types xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" ` + strings.Join(namespaces, " ") + `>` + strings.Join(names, " ") + `</d:Types>`
+	if len(opts.Scopes) > 0 {
+		var scopes []string
+		for _, scope := range opts.Scopes {
+			scopes = append(scopes, escapeXML(scope))
+		}
+		body += `<d:Scopes xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" MatchBy="` + escapeXML(opts.matchBy()) + `">` + strings.Join(scopes, " ") + `</d:Scopes>`
+	}
+	return body + `</Probe>`
+}
+
+func (opts DiscoveryOptions) matchBy() string {
+	if opts.MatchBy == "" {
+		return MatchByRFC3986
+	}
+	return opts.MatchBy
+}
+
+// matches reports whether device matches the probe. Devices are supposed to
+// only answer probes they match, but many ignore scopes.
+func (opts DiscoveryOptions) matches(device DiscoveredDevice) bool {
+	if len(opts.Types) > 0 && len(device.Types) > 0 {
+		matched := false
+		for _, deviceType := range opts.Types {
+			for _, qname := range device.Types {
+				if qname[strings.Index(qname, ":")+1:] == deviceType.Name {
+					matched = true
 				}
 			}
 		}
+		if !matched {
+			return false
+		}
 	}
 
-	if ip == nil {
-		return []Device{}, err
+	for _, scope := range opts.Scopes {
+		matched := false
+		for _, deviceScope := range device.Scopes {
+			if matchScope(opts.matchBy(), scope, deviceScope) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
 	}
+	return true
+}
 
-	// Discover device on interface's network
-	devices, err := discoverDevices(ip.String(), duration)
+// matchScope reports whether deviceScope matches scope by rule. Rules we
+// can't evaluate match everything, leaving the decision to the device.
+func matchScope(rule, scope, deviceScope string) bool {
+	switch rule {
+	case MatchByStrcmp0:
+		return scope == deviceScope
+	case MatchByRFC3986:
+		// The scheme and authority match case-insensitively, the path
+		// segment by segment
+		urlScope, err := url.Parse(scope)
+		if err != nil {
+			return false
+		}
+		urlDevice, err := url.Parse(deviceScope)
+		if err != nil || !strings.EqualFold(urlScope.Scheme, urlDevice.Scheme) || !strings.EqualFold(urlScope.Host, urlDevice.Host) {
+			return false
+		}
+		segments := strings.Split(strings.Trim(urlScope.Path, "/"), "/")
+		deviceSegments := strings.Split(strings.Trim(urlDevice.Path, "/"), "/")
+		if len(segments) > len(deviceSegments) {
+			return false
+		}
+		for i, segment := range segments {
+			if segment != "" && segment != deviceSegments[i] {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
 
-	return devices, nil
+// DiscoveryResult is a device that answered a probe, or the error that
+// stopped probing from one of the local addresses.
+type DiscoveryResult struct {
+	Device DiscoveredDevice
+	Err    error
 }
 
-// StartDiscovery send a WS-Discovery message and wait for all matching device to respond
-func StartDiscovery(interfaceName string, duration time.Duration) ([]Device, error) {
-	// Get list of interface address
+// DiscoverStream probes for devices and emits each device as soon as it
+// answers, once per endpoint UUID. The channel is closed when ctx ends or
+// opts.Duration has passed.
+func DiscoverStream(ctx context.Context, opts DiscoveryOptions) <-chan DiscoveryResult {
+	if opts.Duration <= 0 {
+		opts.Duration = defaultDiscoveryDuration
+	}
+
+	results := make(chan DiscoveryResult)
+	go func() {
+		defer close(results)
+
+		ipAddrs, err := discoveryAddrs(opts.Interface)
+		if err != nil {
+			sendDiscoveryResult(ctx, results, DiscoveryResult{Err: err})
+			return
+		}
+
+		found := foundOnce(ctx, results)
+
+		var wg sync.WaitGroup
+		for _, ipAddr := range ipAddrs {
+			wg.Add(1)
+			go func(ipAddr string) {
+				defer wg.Done()
+				err := probeDevices(ctx, ipAddr, opts, found)
+				if err != nil && isIPv6(ipAddr) {
+					logAt(nil, LogWarn, "IPv6 discovery failed", "address", ipAddr, "error", err)
+				} else if err != nil {
+					sendDiscoveryResult(ctx, results, DiscoveryResult{Err: err})
+				}
+			}(ipAddr)
+		}
+		wg.Wait()
+	}()
+
+	return results
+}
+
+// foundOnce returns a callback that sends each device to results once, even
+// when it answers on several addresses.
+func foundOnce(ctx context.Context, results chan<- DiscoveryResult) func(DiscoveredDevice) {
+	var mu sync.Mutex
+	seen := make(map[string]bool) // key: endpoint UUID
+	return func(device DiscoveredDevice) {
+		key := device.ID
+		if key == "" {
+			key = strings.Join(device.XAddrs, " ")
+		}
+		mu.Lock()
+		duplicate := seen[key]
+		seen[key] = true
+		mu.Unlock()
+
+		if !duplicate {
+			sendDiscoveryResult(ctx, results, DiscoveryResult{Device: device})
+		}
+	}
+}
+
+// sendDiscoveryResult sends result unless ctx ends first.
+func sendDiscoveryResult(ctx context.Context, results chan<- DiscoveryResult, result DiscoveryResult) {
+	select {
+	case results <- result:
+	case <-ctx.Done():
+	}
+}
+
+// discoverOnInterface probes from every IPv4 address of itf, and from one of
+// its IPv6 addresses on the link-local multicast group, all at once. IPv6
+// failures are not fatal, as many networks have no IPv6 route.
+func discoverOnInterface(itf net.Interface, duration time.Duration) ([]Device, error) {
+	ipAddrs, err := interfaceAddrs(itf)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([][]Device, len(ipAddrs))
+	errs := make([]error, len(ipAddrs))
+	var wg sync.WaitGroup
+	for i, ipAddr := range ipAddrs {
+		wg.Add(1)
+		go func(i int, ipAddr string) {
+			defer wg.Done()
+			devices[i], errs[i] = discoverDevices(ipAddr, duration)
+		}(i, ipAddr)
+	}
+	wg.Wait()
+
+	var discoveryResults []Device
+	for i, ipAddr := range ipAddrs {
+		if errs[i] != nil {
+			if !isIPv6(ipAddr) {
+				return nil, errs[i]
+			}
+			logAt(nil, LogWarn, "IPv6 discovery failed", "interface", itf.Name, "error", errs[i])
+		}
+		discoveryResults = append(discoveryResults, devices[i]...)
+	}
+
+	return discoveryResults, nil
+}
+
+// discoveryAddrs returns the addresses to probe from on the interface named
+// interfaceName, or on all interfaces when it is empty.
+func discoveryAddrs(interfaceName string) ([]string, error) {
 	if interfaceName != "" {
-		return StartDiscoveryOn(interfaceName, duration)
+		itf, err := net.InterfaceByName(interfaceName)
+		if err != nil {
+			return nil, err
+		}
+		return interfaceAddrs(*itf)
 	}
 
-	addrs, err := net.InterfaceAddrs()
+	itfs, err := net.Interfaces()
 	if err != nil {
-		return []Device{}, err
+		return nil, err
+	}
+
+	var ipAddrs []string
+	for _, itf := range itfs {
+		addrs, err := interfaceAddrs(itf)
+		if err != nil {
+			return nil, err
+		}
+		ipAddrs = append(ipAddrs, addrs...)
+	}
+	return ipAddrs, nil
+}
+
+// interfaceAddrs returns every IPv4 address of itf and one of its IPv6
+// addresses, with the interface as zone.
+func interfaceAddrs(itf net.Interface) ([]string, error) {
+	if itf.Flags&net.FlagUp == 0 || itf.Flags&net.FlagLoopback != 0 || itf.Flags&net.FlagMulticast == 0 {
+		return nil, nil
+	}
+
+	addrs, err := itf.Addrs()
+	if err != nil {
+		return nil, err
 	}
 
-	// Fetch IPv4 address
 	var ipAddrs []string
+	var ipv6Addr string
 	for _, addr := range addrs {
 		ipAddr, ok := addr.(*net.IPNet)
-		if ok && !ipAddr.IP.IsLoopback() && ipAddr.IP.To4() != nil {
+		if !ok || ipAddr.IP.IsLoopback() {
+			continue
+		}
+
+		if ipAddr.IP.To4() != nil {
 			ipAddrs = append(ipAddrs, ipAddr.IP.String())
+		} else if ipv6Addr == "" || ipAddr.IP.IsLinkLocalUnicast() {
+			// Prefer the link-local address, which every IPv6 interface has
+			ipv6Addr = ipAddr.IP.String() + "%" + itf.Name
 		}
 	}
 
-	// Create initial discovery results
-	var discoveryResults []Device
+	if ipv6Addr != "" {
+		ipAddrs = append(ipAddrs, ipv6Addr)
+	}
+	return ipAddrs, nil
+}
 
-	// Discover device on each interface's network
-	for _, ipAddr := range ipAddrs {
-		devices, err := discoverDevices(ipAddr, duration)
-		if err != nil {
-			return []Device{}, err
+// isIPv6 reports whether ipAddr is an IPv6 address.
+func isIPv6(ipAddr string) bool {
+	return strings.Contains(ipAddr, ":")
+}
+
+// discoverDevices probes from ipAddr, an IPv4 address or an IPv6 address
+// with its interface as zone, such as "fe80::1%eth0".
+func discoverDevices(ipAddr string, duration time.Duration) ([]Device, error) {
+	discoveryResults := make([]Device, 0)
+	opts := DiscoveryOptions{Duration: duration}
+	err := probeDevices(context.Background(), ipAddr, opts, func(device DiscoveredDevice) {
+		discoveryResults = append(discoveryResults, device.Device())
+	})
+	return discoveryResults, err
+}
+
+// probeDevices sends a WS-Discovery probe from ipAddr and calls found for
+// every matching device that answers, until opts.Duration passes or ctx
+// ends.
+func probeDevices(ctx context.Context, ipAddr string, opts DiscoveryOptions, found func(DiscoveredDevice)) error {
+	network, localAddress, multicastAddress, err := multicastAddrs(ipAddr)
+	if err != nil {
+		return err
+	}
+
+	return sendProbe(ctx, network, localAddress, multicastAddress, opts, found)
+}
+
+// multicastAddrs returns the local address to send from and the WS-Discovery
+// multicast group of ipAddr's family.
+func multicastAddrs(ipAddr string) (network string, local, multicast *net.UDPAddr, err error) {
+	network, multicastHost := "udp4", "239.255.255.250"
+	if isIPv6(ipAddr) {
+		network, multicastHost = "udp6", "ff02::c"
+		if zone := strings.Index(ipAddr, "%"); zone != -1 {
+			multicastHost += ipAddr[zone:]
 		}
+	}
 
-		discoveryResults = append(discoveryResults, devices...)
+	local, err = net.ResolveUDPAddr(network, net.JoinHostPort(ipAddr, "0"))
+	if err != nil {
+		return "", nil, nil, err
 	}
 
-	return discoveryResults, nil
+	multicast, err = net.ResolveUDPAddr(network, net.JoinHostPort(multicastHost, "3702"))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return network, local, multicast, nil
 }
 
-func discoverDevices(ipAddr string, duration time.Duration) ([]Device, error) {
-	// Create WS-Discovery request
-	requestID := "uuid:" + uuid.New().String()
+// sendProbe sends a WS-Discovery probe from local to destination and calls
+// found for every matching device that answers, until opts.Duration passes,
+// ctx ends, or a unicast destination answered.
+func sendProbe(ctx context.Context, network string, local, destination *net.UDPAddr, opts DiscoveryOptions, found func(DiscoveredDevice)) error {
+	return sendDiscoveryMessage(ctx, network, local, destination, opts.Duration, "Probe", opts.probeBody(), func(device DiscoveredDevice) {
+		if opts.matches(device) {
+			found(device)
+		}
+	})
+}
+
+// The addressing of WS-Discovery messages.
+const (
+	discoveryActionPrefix = "http://schemas.xmlsoap.org/ws/2005/04/discovery/"
+	discoveryAdHocTo      = "urn:schemas-xmlsoap-org:ws:2005:04:discovery"
+)
+
+// discoveryRequest returns the envelope of a WS-Discovery message, such as a
+// Probe or Resolve, sent to to.
+func discoveryRequest(messageID, to, action, body string) string {
 	//request := `
 	//	<?xml version="1.0" encoding="UTF-8"?>
 	//	<e:Envelope
@@ -109,149 +530,190 @@ func discoverDevices(ipAddr string, duration time.Duration) ([]Device, error) {
 					xmlns:s="http://www.w3.org/2003/05/soap-envelope"
 					xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing">
 					<s:Header>
-						<a:Action s:mustUnderstand="1">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</a:Action>
-						<a:MessageID>` + requestID + `</a:MessageID>
+						<a:Action s:mustUnderstand="1">` + discoveryActionPrefix + action + `</a:Action>
+						<a:MessageID>` + messageID + `</a:MessageID>
 						<a:ReplyTo><a:Address>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:Address></a:ReplyTo>
-						<a:To s:mustUnderstand="1">urn:schemas-xmlsoap-org:ws:2005:04:discovery</a:To>
+						<a:To s:mustUnderstand="1">` + escapeXML(to) + `</a:To>
 					</s:Header>
 					<s:Body>
-						<Probe xmlns="http://schemas.xmlsoap.org/ws/2005/04/discovery">
-							<d:Types xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dp0="http://www.onvif.org/ver10/network/wsdl">dp0:NetworkVideoTransmitter</d:Types>
-						</Probe>
+						` + body + `
 					</s:Body>
 				</s:Envelope>`
 
 	// Clean WS-Discovery message
 	request = regexp.MustCompile(`>\s+<`).ReplaceAllString(request, "><")
-	request = regexp.MustCompile(`\s+`).ReplaceAllString(request, " ")
-
-	// Create UDP address for local and multicast address
-	localAddress, err := net.ResolveUDPAddr("udp4", ipAddr+":0")
-	if err != nil {
-		return []Device{}, err
-	}
+	return regexp.MustCompile(`\s+`).ReplaceAllString(request, " ")
+}
 
-	multicastAddress, err := net.ResolveUDPAddr("udp4", "239.255.255.250:3702")
-	if err != nil {
-		return []Device{}, err
-	}
+// sendDiscoveryMessage sends a WS-Discovery action, such as a Probe or
+// Resolve, from local to destination and calls found for every device that
+// answers, until duration passes, ctx ends, or a unicast destination
+// answered.
+func sendDiscoveryMessage(ctx context.Context, network string, local, destination *net.UDPAddr, duration time.Duration, action, body string, found func(DiscoveredDevice)) error {
+	requestID := "uuid:" + uuid.New().String()
+	request := discoveryRequest(requestID, discoveryAdHocTo, action, body)
 
 	// Create UDP connection to listen for respond from matching device
-	conn, err := net.ListenUDP("udp", localAddress)
+	conn, err := net.ListenUDP(network, local)
 	if err != nil {
-		return []Device{}, err
+		return err
 	}
 	defer conn.Close()
 
-	// Set connection's timeout
+	// Set connection's timeout, and unblock reading when ctx ends first
 	err = conn.SetDeadline(time.Now().Add(duration))
 	if err != nil {
-		return []Device{}, err
+		return err
 	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
 
-	// Send WS-Discovery request to multicast address
-	_, err = conn.WriteToUDP([]byte(request), multicastAddress)
+	// Send WS-Discovery request
+	_, err = conn.WriteToUDP([]byte(request), destination)
 	if err != nil {
-		return []Device{}, err
+		return err
 	}
 
-	// Create initial discovery results
-	discoveryResults := make([]Device, 0)
-
 	// Keep reading UDP message until timeout
 	for {
 		// Create buffer and receive UDP response
 		buffer := make([]byte, 10*1024)
-		_, _, err = conn.ReadFromUDP(buffer)
+		n, source, err := conn.ReadFromUDP(buffer)
 
 		// Check if connection timeout
 		if err != nil {
 			if udpErr, ok := err.(net.Error); ok && udpErr.Timeout() {
-				break
-			} else {
-				return discoveryResults, err
+				return nil
 			}
+			return err
 		}
 
-		//fmt.Println(string(buffer))
 		// Read and parse WS-Discovery response
-		device, err := readDiscoveryResponse(requestID, buffer)
-		if err != nil && err != errWrongDiscoveryResponse {
-			return discoveryResults, err
+		devices, err := readDiscoveryResponse(requestID, buffer[:n], source)
+		if err == errWrongDiscoveryResponse {
+			continue
+		}
+		if err != nil {
+			return err
 		}
 
-		// Push device to results
-		discoveryResults = append(discoveryResults, device)
+		for _, device := range devices {
+			found(device)
+		}
+		if !destination.IP.IsMulticast() {
+			return nil
+		}
 	}
-
-	return discoveryResults, nil
 }
 
-// readDiscoveryResponse reads and parses WS-Discovery response
-func readDiscoveryResponse(messageID string, buffer []byte) (Device, error) {
-	glog.Infof("Discover response: %s", string(buffer))
-
-	// Inital result
-	result := Device{}
+// readDiscoveryResponse reads and parses WS-Discovery response, one device
+// per ProbeMatch or ResolveMatch
+func readDiscoveryResponse(messageID string, buffer []byte, source net.Addr) ([]DiscoveredDevice, error) {
+	operation := "ProbeMatches"
+	if bytes.Contains(buffer, []byte("ResolveMatches")) {
+		operation = "ResolveMatches"
+	}
+	if level := operationLogLevel(operation); level != LogOff {
+		logAt(nil, level, "discovery response", "operation", operation, "body", redact(string(buffer)))
+	}
 
 	// Parse XML to map
 	mapXML, err := mxj.NewMapXml(buffer)
 	if err != nil {
-		glog.Warningf("Parse response error %v", err)
-		return result, err
+		logAt(nil, LogWarn, "discovery response is not valid XML", "error", err)
+		return nil, err
 	}
 
 	// Check if this response is for our request
 	responseMessageID, err := mapXML.ValueForPath("Envelope.Header.RelatesTo")
 	if err != nil {
-		glog.Warningf("Parse message id error %v", err)
-		return result, err
+		logAt(nil, LogWarn, "discovery response has no RelatesTo", "error", err)
+		return nil, err
 	}
 
-	if responseMessageMap, ok := responseMessageID.(map[string]interface{}); ok {
-		responseMessage := responseMessageMap["#text"].(string)
-		if responseMessage != messageID {
-			glog.Info(responseMessage)
-			glog.Info(messageID)
-			return result, errWrongDiscoveryResponse
-		}
-	} else {
-		if responseMessageID != messageID {
-			glog.Info(responseMessageID)
-			glog.Info(messageID)
-			return result, errWrongDiscoveryResponse
+	if responseMessage := strings.TrimSpace(textOf(responseMessageID)); responseMessage != messageID {
+		logAt(nil, LogDebug, "discovery response is for another probe", "relatesTo", responseMessage, "messageID", messageID)
+		return nil, errWrongDiscoveryResponse
+	}
+
+	// Read every ProbeMatch, or the ResolveMatch
+	var devices []DiscoveredDevice
+	probeMatches, _ := mapXML.ValuesForPath("Envelope.Body.ProbeMatches.ProbeMatch")
+	resolveMatches, _ := mapXML.ValuesForPath("Envelope.Body.ResolveMatches.ResolveMatch")
+	for _, probeMatch := range append(probeMatches, resolveMatches...) {
+		if mapProbeMatch, ok := probeMatch.(map[string]interface{}); ok {
+			device := readDiscoveredDevice(mapProbeMatch, source)
+			logAt(nil, LogDebug, "discovered device", "id", device.ID, "xaddr", redact(strings.Join(device.XAddrs, " ")))
+			devices = append(devices, device)
 		}
 	}
 
-	// Get device's ID and clean it
-	deviceID, _ := mapXML.ValueForPathString("Envelope.Body.ProbeMatches.ProbeMatch.EndpointReference.Address")
-	deviceID = strings.Replace(deviceID, "urn:uuid:", "", 1)
-	glog.Infof("Discover device id: %s", deviceID)
+	return devices, nil
+}
 
-	// Get device's name
-	deviceName := ""
-	scopes, _ := mapXML.ValueForPathString("Envelope.Body.ProbeMatches.ProbeMatch.Scopes")
-	for _, scope := range strings.Split(scopes, " ") {
-		if strings.HasPrefix(scope, "onvif://www.onvif.org/name/") {
-			deviceName = strings.Replace(scope, "onvif://www.onvif.org/name/", "", 1)
-			deviceName = strings.Replace(deviceName, "_", " ", -1)
-			break
-		}
+// readDiscoveredDevice reads the endpoint described by a Hello, ProbeMatch
+// or ResolveMatch.
+func readDiscoveredDevice(mapEndpoint map[string]interface{}, source net.Addr) DiscoveredDevice {
+	metadataVersion, _ := strconv.Atoi(strings.TrimSpace(textOf(mapEndpoint["MetadataVersion"])))
+	device := DiscoveredDevice{
+		ID:              readEndpointID(mapEndpoint),
+		XAddrs:          strings.Fields(textOf(mapEndpoint["XAddrs"])),
+		Scopes:          strings.Fields(textOf(mapEndpoint["Scopes"])),
+		Types:           strings.Fields(textOf(mapEndpoint["Types"])),
+		MetadataVersion: metadataVersion,
+		Source:          source,
 	}
 
-	// Get device's xAddrs
-	xAddrs, _ := mapXML.ValueForPathString("Envelope.Body.ProbeMatches.ProbeMatch.XAddrs")
-	listXAddr := strings.Split(xAddrs, " ")
-	glog.Infof("Discover address: %s", xAddrs)
-	if len(listXAddr) == 0 {
-		glog.Warning("Discover address len 0")
-		return result, errors.New("Device does not have any xAddr ")
+	// Parse the ONVIF scopes, onvif://www.onvif.org/<category>/<value>
+	for _, scope := range device.Scopes {
+		if !strings.HasPrefix(scope, onvifScopePrefix) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(scope, onvifScopePrefix), "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value, err := url.PathUnescape(parts[1])
+		if err != nil {
+			value = parts[1]
+		}
+
+		switch strings.ToLower(parts[0]) {
+		case "name":
+			device.Name = strings.Replace(value, "_", " ", -1)
+		case "hardware":
+			device.Hardware = value
+		case "location":
+			device.Locations = append(device.Locations, value)
+		case "profile":
+			device.Profiles = append(device.Profiles, value)
+		}
 	}
 
-	// Finalize result
-	result.ID = deviceID
-	result.Name = deviceName
-	result.XAddr = listXAddr[0]
+	return device
+}
+
+// readEndpointID returns the endpoint UUID of a discovery message body.
+func readEndpointID(mapEndpoint map[string]interface{}) string {
+	var address string
+	if mapReference, ok := mapEndpoint["EndpointReference"].(map[string]interface{}); ok {
+		address = strings.TrimSpace(textOf(mapReference["Address"]))
+	}
+	return strings.Replace(address, "urn:uuid:", "", 1)
+}
 
-	return result, nil
+// textOf returns the text of an element parsed by mxj, with or without
+// attributes.
+func textOf(src interface{}) string {
+	if mapSrc, ok := src.(map[string]interface{}); ok {
+		return interfaceToString(mapSrc["#text"])
+	}
+	return interfaceToString(src)
 }
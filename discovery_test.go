@@ -0,0 +1,265 @@
+package onvif
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clbanning/mxj"
+)
+
+const testProbeMatches = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl">
+	<s:Header><a:RelatesTo>uuid:probe</a:RelatesTo></s:Header>
+	<s:Body><d:ProbeMatches><d:ProbeMatch>
+		<a:EndpointReference><a:Address>urn:uuid:2419d68a-2dd2-21b2-a205-ec3c2d3b9f41</a:Address></a:EndpointReference>
+		<d:Types>dn:NetworkVideoTransmitter</d:Types>
+		<d:Scopes>onvif://www.onvif.org/name/Front_Door onvif://www.onvif.org/hardware/IPC-1</d:Scopes>
+		<d:XAddrs>http://192.168.1.20/onvif/device_service http://[fd00::20]/onvif/device_service</d:XAddrs>
+		<d:MetadataVersion>1</d:MetadataVersion>
+	</d:ProbeMatch></d:ProbeMatches></s:Body>
+</s:Envelope>`
+
+const testTwoProbeMatches = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+	<s:Header><a:RelatesTo>uuid:probe</a:RelatesTo></s:Header>
+	<s:Body><d:ProbeMatches>
+		<d:ProbeMatch>
+			<a:EndpointReference><a:Address>urn:uuid:encoder-1</a:Address></a:EndpointReference>
+			<d:Scopes>onvif://www.onvif.org/Profile/Streaming onvif://www.onvif.org/Profile/T onvif://www.onvif.org/location/building%203 onvif://www.onvif.org/location/country/vietnam</d:Scopes>
+			<d:XAddrs>http://10.0.0.5/onvif/device_service http://192.168.1.21/onvif/device_service</d:XAddrs>
+			<d:MetadataVersion>7</d:MetadataVersion>
+		</d:ProbeMatch>
+		<d:ProbeMatch>
+			<a:EndpointReference><a:Address>urn:uuid:encoder-2</a:Address></a:EndpointReference>
+			<d:XAddrs>http://192.168.1.22/onvif/device_service</d:XAddrs>
+		</d:ProbeMatch>
+	</d:ProbeMatches></s:Body>
+</s:Envelope>`
+
+func TestReadDiscoveryResponse(t *testing.T) {
+	source := &net.UDPAddr{IP: net.ParseIP("192.168.1.20"), Port: 3702}
+	devices, err := readDiscoveryResponse("uuid:probe", []byte(testProbeMatches), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := DiscoveredDevice{
+		ID:              "2419d68a-2dd2-21b2-a205-ec3c2d3b9f41",
+		XAddrs:          []string{"http://192.168.1.20/onvif/device_service", "http://[fd00::20]/onvif/device_service"},
+		Scopes:          []string{"onvif://www.onvif.org/name/Front_Door", "onvif://www.onvif.org/hardware/IPC-1"},
+		Types:           []string{"dn:NetworkVideoTransmitter"},
+		MetadataVersion: 1,
+		Source:          source,
+		Name:            "Front Door",
+		Hardware:        "IPC-1",
+	}
+	if len(devices) != 1 || !reflect.DeepEqual(devices[0], expected) {
+		t.Fatalf("unexpected devices %+v", devices)
+	}
+
+	if _, err := readDiscoveryResponse("uuid:other", []byte(testProbeMatches), source); err != errWrongDiscoveryResponse {
+		t.Fatalf("expected errWrongDiscoveryResponse, got %v", err)
+	}
+}
+
+func TestReadDiscoveryResponseReadsEveryProbeMatch(t *testing.T) {
+	source := &net.UDPAddr{IP: net.ParseIP("192.168.1.21"), Port: 3702}
+	devices, err := readDiscoveryResponse("uuid:probe", []byte(testTwoProbeMatches), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 || devices[0].ID != "encoder-1" || devices[1].ID != "encoder-2" {
+		t.Fatalf("unexpected devices %+v", devices)
+	}
+
+	encoder := devices[0]
+	if !encoder.HasProfile("T") || !encoder.HasProfile("streaming") || encoder.HasProfile("G") {
+		t.Errorf("unexpected profiles %v", encoder.Profiles)
+	}
+	if !reflect.DeepEqual(encoder.Locations, []string{"building 3", "country/vietnam"}) {
+		t.Errorf("unexpected locations %v", encoder.Locations)
+	}
+	if encoder.MetadataVersion != 7 {
+		t.Errorf("unexpected metadata version %d", encoder.MetadataVersion)
+	}
+}
+
+func TestDiscoveredDevicePicksReachableXAddr(t *testing.T) {
+	device := DiscoveredDevice{XAddrs: []string{
+		"http://10.0.0.5/onvif/device_service",
+		"http://[fd00::20]/onvif/device_service",
+		"http://192.168.1.21/onvif/device_service",
+	}}
+	cases := map[string]string{
+		"192.168.1.21": "http://192.168.1.21/onvif/device_service",
+		"fd00::20":     "http://[fd00::20]/onvif/device_service",
+		"fd00::99":     "http://[fd00::20]/onvif/device_service",
+		"172.16.0.1":   "http://10.0.0.5/onvif/device_service",
+	}
+	for ip, expected := range cases {
+		device.Source = &net.UDPAddr{IP: net.ParseIP(ip), Port: 3702}
+		if xAddr := device.Device().XAddr; xAddr != expected {
+			t.Errorf("answer from %s: got %s, expected %s", ip, xAddr, expected)
+		}
+	}
+}
+
+// multicastInterface returns an interface that can send IPv4 multicast, or
+// skips the test.
+func multicastInterface(t *testing.T) *net.Interface {
+	itfs, _ := net.Interfaces()
+	for _, itf := range itfs {
+		if itf.Flags&net.FlagUp == 0 || itf.Flags&net.FlagLoopback != 0 || itf.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		if addrs, _ := interfaceAddrs(itf); len(addrs) > 0 && !isIPv6(addrs[0]) {
+			return &itf
+		}
+	}
+	t.Skip("no IPv4 multicast interface")
+	return nil
+}
+
+// newFakeDiscoveryDevice joins the WS-Discovery multicast group on itf and
+// answers every probe with a ProbeMatch for each id, sent twice.
+func newFakeDiscoveryDevice(t *testing.T, itf *net.Interface, ids ...string) {
+	conn, err := net.ListenMulticastUDP("udp4", itf, &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 3702})
+	if err != nil {
+		t.Skipf("cannot join the multicast group: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buffer := make([]byte, 10*1024)
+		for {
+			n, addr, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			mapXML, err := mxj.NewMapXml(buffer[:n])
+			if err != nil {
+				continue
+			}
+			messageID, _ := mapXML.ValueForPathString("Envelope.Header.MessageID")
+			for _, id := range ids {
+				response := strings.Replace(testProbeMatches, "uuid:probe", messageID, 1)
+				response = strings.Replace(response, "2419d68a-2dd2-21b2-a205-ec3c2d3b9f41", id, 1)
+				conn.WriteToUDP([]byte(response), addr)
+				conn.WriteToUDP([]byte(response), addr)
+			}
+		}
+	}()
+}
+
+func TestDiscoverStream(t *testing.T) {
+	itf := multicastInterface(t)
+	newFakeDiscoveryDevice(t, itf, "device-1", "device-2")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+
+	seen := make(map[string]int)
+	for result := range DiscoverStream(ctx, DiscoveryOptions{Interface: itf.Name, Duration: 500 * time.Millisecond}) {
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		seen[result.Device.ID]++
+	}
+
+	if seen["device-1"] != 1 || seen["device-2"] != 1 {
+		t.Fatalf("expected each device once, got %v", seen)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("stream stayed open for %v", elapsed)
+	}
+}
+
+func TestDiscoverStreamStopsWithContext(t *testing.T) {
+	itf := multicastInterface(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := DiscoverStream(ctx, DiscoveryOptions{Interface: itf.Name, Duration: time.Minute})
+	cancel()
+
+	select {
+	case <-drain(results):
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream not closed after the context was cancelled")
+	}
+}
+
+// drain reads results until they are closed.
+func drain(results <-chan DiscoveryResult) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for range results {
+		}
+		close(done)
+	}()
+	return done
+}
+
+func TestProbeBody(t *testing.T) {
+	opts := DiscoveryOptions{
+		Types:  []DeviceType{TypeNetworkVideoTransmitter, TypeDevice},
+		Scopes: []string{"onvif://www.onvif.org/Profile/T", "onvif://www.onvif.org/location/a&b"},
+	}
+	probe := requestValue(t, opts.probeBody(), "Probe").(map[string]interface{})
+
+	types := probe["Types"].(map[string]interface{})
+	if types["#text"] != "dp0:NetworkVideoTransmitter dp1:Device" || types["-dp1"] != "http://www.onvif.org/ver10/device/wsdl" {
+		t.Errorf("unexpected types %v", types)
+	}
+	scopes := probe["Scopes"].(map[string]interface{})
+	if scopes["#text"] != "onvif://www.onvif.org/Profile/T onvif://www.onvif.org/location/a&b" || scopes["-MatchBy"] != MatchByRFC3986 {
+		t.Errorf("unexpected scopes %v", scopes)
+	}
+
+	if body := (DiscoveryOptions{}).probeBody(); !strings.Contains(body, "dp0:NetworkVideoTransmitter") || strings.Contains(body, "Scopes") {
+		t.Errorf("unexpected default probe %s", body)
+	}
+}
+
+func TestMatchScope(t *testing.T) {
+	cases := []struct {
+		rule, scope, deviceScope string
+		expected                 bool
+	}{
+		{MatchByRFC3986, "onvif://www.onvif.org/location/building3", "onvif://www.onvif.org/location/building3/floor2", true},
+		{MatchByRFC3986, "onvif://www.onvif.org/location/building3", "onvif://www.onvif.org/location/building33", false},
+		{MatchByRFC3986, "ONVIF://WWW.onvif.org/Profile/T", "onvif://www.onvif.org/Profile/T", true},
+		{MatchByRFC3986, "onvif://www.onvif.org/Profile/T", "onvif://www.onvif.org/profile/t", false},
+		{MatchByStrcmp0, "onvif://www.onvif.org/location", "onvif://www.onvif.org/location/building3", false},
+		{MatchByLDAP, "ldap:///ou=cameras", "onvif://www.onvif.org/Profile/T", true},
+	}
+	for _, c := range cases {
+		if matched := matchScope(c.rule, c.scope, c.deviceScope); matched != c.expected {
+			t.Errorf("matchScope(%s, %s, %s) = %v", c.rule, c.scope, c.deviceScope, matched)
+		}
+	}
+}
+
+func TestDiscoverStreamFiltersByScope(t *testing.T) {
+	itf := multicastInterface(t)
+	newFakeDiscoveryDevice(t, itf, "device-1")
+
+	for scope, expected := range map[string]int{
+		"onvif://www.onvif.org/hardware/IPC-1": 1,
+		"onvif://www.onvif.org/Profile/T":      0,
+	} {
+		opts := DiscoveryOptions{Interface: itf.Name, Duration: 300 * time.Millisecond, Scopes: []string{scope}}
+		found := 0
+		for result := range DiscoverStream(context.Background(), opts) {
+			if result.Err == nil && result.Device.ID == "device-1" {
+				found++
+			}
+		}
+		if found != expected {
+			t.Errorf("scope %s: found %d devices, expected %d", scope, found, expected)
+		}
+	}
+}
@@ -1,7 +1,14 @@
 package onvif
 
+import "context"
+
 // return url for unsubscribe
 func (device Device) Subscribe(address string) (string, error) {
+	return device.SubscribeContext(context.Background(), address)
+}
+
+// SubscribeContext is like Subscribe but sends the request with ctx.
+func (device Device) SubscribeContext(ctx context.Context, address string) (string, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -12,7 +19,7 @@ func (device Device) Subscribe(address string) (string, error) {
 		},
 		Body: `<wsnt:Subscribe xmlns="http://docs.oasis-open.org/wsn/b-2.xsd">
 					<wsnt:ConsumerReference>
-						<wsa:Address xmlns="http://www.w3.org/2005/08/addressing">` + address + `</wsa:Address>
+						<wsa:Address xmlns="http://www.w3.org/2005/08/addressing">` + escapeXML(address) + `</wsa:Address>
 					</wsnt:ConsumerReference>
 					<wsnt:InitialTerminationTime>PT3600S</wsnt:InitialTerminationTime>
 				</wsnt:Subscribe>`,
@@ -20,7 +27,7 @@ func (device Device) Subscribe(address string) (string, error) {
 
 	var result string = ""
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -35,6 +42,11 @@ func (device Device) Subscribe(address string) (string, error) {
 }
 
 func (device Device) CreatePullPointSubscription() (CreatePullPointSubscriptionResponse, error) {
+	return device.CreatePullPointSubscriptionContext(context.Background())
+}
+
+// CreatePullPointSubscriptionContext is like CreatePullPointSubscription but sends the request with ctx.
+func (device Device) CreatePullPointSubscriptionContext(ctx context.Context) (CreatePullPointSubscriptionResponse, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -47,7 +59,7 @@ func (device Device) CreatePullPointSubscription() (CreatePullPointSubscriptionR
 
 	result := CreatePullPointSubscriptionResponse{}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -71,6 +83,11 @@ func (device Device) CreatePullPointSubscription() (CreatePullPointSubscriptionR
 
 // return url for unsubscribe
 func (device Device) GetEventProperties() (interface{}, error) {
+	return device.GetEventPropertiesContext(context.Background())
+}
+
+// GetEventPropertiesContext is like GetEventProperties but sends the request with ctx.
+func (device Device) GetEventPropertiesContext(ctx context.Context) (interface{}, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -79,7 +96,7 @@ func (device Device) GetEventProperties() (interface{}, error) {
 	}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return "", err
 	}
@@ -94,6 +111,11 @@ func (device Device) GetEventProperties() (interface{}, error) {
 
 // return url for unsubscribe
 func (device Device) PullMessages(address string) ([]NotificationMessage, error) {
+	return device.PullMessagesContext(context.Background(), address)
+}
+
+// PullMessagesContext is like PullMessages but sends the request with ctx.
+func (device Device) PullMessagesContext(ctx context.Context, address string) ([]NotificationMessage, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -108,7 +130,7 @@ func (device Device) PullMessages(address string) ([]NotificationMessage, error)
 
 	var result = make([]NotificationMessage, 0)
 	// send request
-	response, err := soap.SendRequest(address)
+	response, err := device.sendRequest(ctx, soap, address)
 	if err != nil {
 		return result, err
 	}
@@ -170,6 +192,11 @@ func (device Device) PullMessages(address string) ([]NotificationMessage, error)
 }
 
 func (device Device) UnSubscribe(address string) error {
+	return device.UnSubscribeContext(context.Background(), address)
+}
+
+// UnSubscribeContext is like UnSubscribe but sends the request with ctx.
+func (device Device) UnSubscribeContext(ctx context.Context, address string) error {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -177,7 +204,7 @@ func (device Device) UnSubscribe(address string) error {
 		Body:     `<Unsubscribe xmlns="http://docs.oasis-open.org/wsn/b-2"/>`,
 	}
 	// send request
-	response, err := soap.SendRequest(address)
+	response, err := device.sendRequest(ctx, soap, address)
 	if err != nil {
 		return err
 	}
@@ -190,6 +217,11 @@ func (device Device) UnSubscribe(address string) error {
 }
 
 func (device Device) ReNew(address string) (CreatePullPointSubscriptionResponse, error) {
+	return device.ReNewContext(context.Background(), address)
+}
+
+// ReNewContext is like ReNew but sends the request with ctx.
+func (device Device) ReNewContext(ctx context.Context, address string) (CreatePullPointSubscriptionResponse, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -201,7 +233,7 @@ func (device Device) ReNew(address string) (CreatePullPointSubscriptionResponse,
 	result := CreatePullPointSubscriptionResponse{}
 
 	// send request
-	response, err := soap.SendRequest(address)
+	response, err := device.sendRequest(ctx, soap, address)
 	if err != nil {
 		return result, err
 	}
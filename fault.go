@@ -0,0 +1,160 @@
+package onvif
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/clbanning/mxj"
+)
+
+// Sentinel errors matched by a *SOAPFault through errors.Is, whatever
+// language or wording the device uses for the fault reason.
+var (
+	ErrNotAuthorized       = errors.New("onvif: not authorized")
+	ErrActionNotSupported  = errors.New("onvif: action not supported")
+	ErrInvalidArgVal       = errors.New("onvif: invalid argument value")
+	ErrInvalidArgs         = errors.New("onvif: invalid arguments")
+	ErrOperationProhibited = errors.New("onvif: operation prohibited")
+)
+
+// faultSubcodes maps the local name of a fault code or subcode to its
+// sentinel error.
+var faultSubcodes = map[string]error{
+	"NotAuthorized":        ErrNotAuthorized,
+	"FailedAuthentication": ErrNotAuthorized,
+	"ActionNotSupported":   ErrActionNotSupported,
+	"InvalidArgVal":        ErrInvalidArgVal,
+	"InvalidArgs":          ErrInvalidArgs,
+	"OperationProhibited":  ErrOperationProhibited,
+}
+
+// SOAPFault is the error returned when a device answers with a SOAP fault, or
+// with an HTTP error status and no usable SOAP envelope.
+type SOAPFault struct {
+	Code       string   // e.g. "env:Sender", or the SOAP 1.1 faultcode
+	Subcodes   []string // e.g. "ter:NotAuthorized", outermost first
+	Reason     string
+	Detail     string // XML of the fault detail, if any
+	StatusCode int    // HTTP status of the response
+}
+
+func (fault *SOAPFault) Error() string {
+	if fault.Reason != "" {
+		return fault.Reason
+	}
+	if len(fault.Subcodes) > 0 {
+		return fault.Subcodes[len(fault.Subcodes)-1]
+	}
+	if fault.Code != "" {
+		return fault.Code
+	}
+	return fmt.Sprintf("HTTP %d %s", fault.StatusCode, http.StatusText(fault.StatusCode))
+}
+
+// Is reports whether the fault matches one of the package sentinel errors.
+func (fault *SOAPFault) Is(target error) bool {
+	if target == ErrNotAuthorized && fault.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+	for _, code := range append([]string{fault.Code}, fault.Subcodes...) {
+		if err, ok := faultSubcodes[localName(code)]; ok && err == target {
+			return true
+		}
+	}
+	return false
+}
+
+// HasSubcode reports whether the fault code or one of its subcodes has the
+// given local name, e.g. "InvalidArgVal".
+func (fault *SOAPFault) HasSubcode(name string) bool {
+	for _, code := range append([]string{fault.Code}, fault.Subcodes...) {
+		if localName(code) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSOAPFault returns the fault carried by a SOAP 1.2 or SOAP 1.1
+// response, or nil if there is none.
+func parseSOAPFault(mapXML mxj.Map, statusCode int) *SOAPFault {
+	ifaceFault, err := mapXML.ValueForPath("Envelope.Body.Fault")
+	if err != nil {
+		return nil
+	}
+
+	fault := &SOAPFault{StatusCode: statusCode}
+	mapFault, ok := ifaceFault.(map[string]interface{})
+	if !ok {
+		fault.Reason = faultText(ifaceFault)
+		return fault
+	}
+
+	if _, ok := mapFault["Code"]; ok { // SOAP 1.2
+		if mapCode, ok := mapFault["Code"].(map[string]interface{}); ok {
+			fault.Code = faultText(mapCode["Value"])
+			mapSubcode, _ := mapCode["Subcode"].(map[string]interface{})
+			for mapSubcode != nil {
+				fault.Subcodes = append(fault.Subcodes, faultText(mapSubcode["Value"]))
+				mapSubcode, _ = mapSubcode["Subcode"].(map[string]interface{})
+			}
+		}
+		if mapReason, ok := mapFault["Reason"].(map[string]interface{}); ok {
+			fault.Reason = faultText(mapReason["Text"])
+		}
+		fault.Detail = faultDetail(mapFault["Detail"])
+	} else { // SOAP 1.1
+		fault.Code = faultText(mapFault["faultcode"])
+		fault.Reason = faultText(mapFault["faultstring"])
+		fault.Detail = faultDetail(mapFault["detail"])
+	}
+
+	return fault
+}
+
+// faultText returns the text of an element that may carry attributes, or be
+// repeated (e.g. one Reason Text per language, of which the first is used).
+func faultText(src interface{}) string {
+	switch value := src.(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case map[string]interface{}:
+		return faultText(value["#text"])
+	case []interface{}:
+		if len(value) > 0 {
+			return faultText(value[0])
+		}
+	}
+	return ""
+}
+
+func faultDetail(src interface{}) string {
+	switch value := src.(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case map[string]interface{}:
+		detail, err := mxj.Map(value).Xml()
+		if err == nil {
+			return string(detail)
+		}
+	}
+	return ""
+}
+
+// localName strips the namespace prefix of a qualified name.
+func localName(name string) string {
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// code returns the most specific code of the fault.
+func (fault *SOAPFault) code() string {
+	if len(fault.Subcodes) > 0 {
+		return fault.Subcodes[len(fault.Subcodes)-1]
+	}
+	return fault.Code
+}
@@ -0,0 +1,83 @@
+package onvif
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSOAP12Fault(t *testing.T) {
+	server := newSOAPServer(t, `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:ter="http://www.onvif.org/ver10/error">
+	<env:Body>
+		<env:Fault>
+			<env:Code>
+				<env:Value>env:Sender</env:Value>
+				<env:Subcode>
+					<env:Value>ter:InvalidArgVal</env:Value>
+					<env:Subcode><env:Value>ter:NoProfile</env:Value></env:Subcode>
+				</env:Subcode>
+			</env:Code>
+			<env:Reason><env:Text xml:lang="de">Profil existiert nicht</env:Text></env:Reason>
+			<env:Detail><env:Text>token profile_9</env:Text></env:Detail>
+		</env:Fault>
+	</env:Body>
+</env:Envelope>`, nil, withStatus(http.StatusBadRequest), withRawResponse())
+
+	_, err := Device{XAddr: server.URL}.GetStreamURI("profile_9", "RTSP")
+
+	var fault *SOAPFault
+	if !errors.As(err, &fault) {
+		t.Fatalf("expected a *SOAPFault, got %T %v", err, err)
+	}
+	if fault.Code != "env:Sender" || fault.Reason != "Profil existiert nicht" || fault.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected fault %+v", fault)
+	}
+	if len(fault.Subcodes) != 2 || fault.Subcodes[0] != "ter:InvalidArgVal" || fault.Subcodes[1] != "ter:NoProfile" {
+		t.Fatalf("unexpected subcodes %v", fault.Subcodes)
+	}
+	if !strings.Contains(fault.Detail, "token profile_9") {
+		t.Fatalf("unexpected detail %q", fault.Detail)
+	}
+	if !errors.Is(err, ErrInvalidArgVal) || !fault.HasSubcode("NoProfile") {
+		t.Fatal("fault should match ErrInvalidArgVal and NoProfile")
+	}
+	if errors.Is(err, ErrNotAuthorized) || errors.Is(err, ErrActionNotSupported) {
+		t.Fatal("fault should not match unrelated sentinels")
+	}
+}
+
+func TestSOAP11Fault(t *testing.T) {
+	server := newSOAPServer(t, `<?xml version="1.0" encoding="UTF-8"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/">
+	<SOAP-ENV:Body>
+		<SOAP-ENV:Fault>
+			<faultcode>ter:ActionNotSupported</faultcode>
+			<faultstring>Optional Action Not Implemented</faultstring>
+		</SOAP-ENV:Fault>
+	</SOAP-ENV:Body>
+</SOAP-ENV:Envelope>`, nil, withStatus(http.StatusInternalServerError), withRawResponse())
+
+	_, err := Device{XAddr: server.URL}.GetNodes()
+	if !errors.Is(err, ErrActionNotSupported) {
+		t.Fatalf("expected ErrActionNotSupported, got %v", err)
+	}
+	if err.Error() != "Optional Action Not Implemented" {
+		t.Fatalf("unexpected error text %q", err.Error())
+	}
+}
+
+func TestHTTPStatusFault(t *testing.T) {
+	server := newSOAPServer(t, "", nil, withStatus(http.StatusUnauthorized), withRawResponse())
+
+	_, err := Device{XAddr: server.URL}.GetInformation()
+	if !errors.Is(err, ErrNotAuthorized) {
+		t.Fatalf("expected ErrNotAuthorized, got %v", err)
+	}
+
+	var fault *SOAPFault
+	if !errors.As(err, &fault) || fault.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a fault with HTTP status 401, got %v", err)
+	}
+}
@@ -0,0 +1,315 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrFirmwareUnchanged is returned by WaitForReboot when the device still
+// reports the previous firmware version once the timeout passed.
+var ErrFirmwareUnchanged = errors.New("onvif: firmware version did not change")
+
+// Defaults of FirmwareUpgradeOptions.
+const (
+	defaultRebootTimeout = 10 * time.Minute
+	defaultPollInterval  = 5 * time.Second
+)
+
+// FirmwareUpgradeOptions configures UpgradeFirmware.
+type FirmwareUpgradeOptions struct {
+	// Progress, if not nil, is called as the image is uploaded with the
+	// bytes sent so far and the size of the image.
+	Progress func(sent, total int64)
+	// RebootTimeout is how long to wait for the device to come back with a
+	// new firmware version after the upload, 10 minutes if zero.
+	RebootTimeout time.Duration
+	// PollInterval is how often GetInformation is sent while waiting, 5
+	// seconds if zero.
+	PollInterval time.Duration
+}
+
+// StartFirmwareUpgrade asks the device where to upload a firmware image over
+// HTTP, and how long to wait before doing so
+func (device Device) StartFirmwareUpgrade() (FirmwareUpgrade, error) {
+	return device.StartFirmwareUpgradeContext(context.Background())
+}
+
+// StartFirmwareUpgradeContext is like StartFirmwareUpgrade but sends the request with ctx.
+func (device Device) StartFirmwareUpgradeContext(ctx context.Context) (FirmwareUpgrade, error) {
+	// create SOAP
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body:     `<StartFirmwareUpgrade xmlns="http://www.onvif.org/ver10/device/wsdl"/>`,
+	}
+
+	result := FirmwareUpgrade{}
+
+	// send request
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
+	if err != nil {
+		return result, err
+	}
+
+	// parse response into interface
+	ifaceUpgrade, err := response.ValueForPath("Envelope.Body.StartFirmwareUpgradeResponse")
+	if err != nil {
+		return result, err
+	}
+
+	// parse interface into struct
+	if mapUpgrade, ok := ifaceUpgrade.(map[string]interface{}); ok {
+		result.UploadURI = strings.TrimSpace(interfaceToString(mapUpgrade["UploadUri"]))
+		result.UploadDelay = interfaceToDuration(mapUpgrade["UploadDelay"])
+		result.ExpectedDownTime = interfaceToDuration(mapUpgrade["ExpectedDownTime"])
+	}
+
+	return result, nil
+}
+
+// UploadFirmware waits for the upload delay of upgrade, then posts the size
+// bytes of image to its upload URI. Progress, if not nil, is called as the
+// image is sent. If image is an io.Seeker it is read again when the request
+// must be resent to answer an authentication challenge; other images are
+// read into memory first.
+func (device Device) UploadFirmware(ctx context.Context, upgrade FirmwareUpgrade, image io.Reader, size int64, progress func(sent, total int64)) error {
+	if upgrade.UploadURI == "" {
+		return errors.New("device did not give a firmware upload URI")
+	}
+
+	if upgrade.UploadDelay > 0 {
+		timer := time.NewTimer(upgrade.UploadDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	logAt(device.Logger, LogDebug, "onvif firmware upload", "uri", redact(upgrade.UploadURI), "size", size)
+	return device.upload(ctx, upgrade.UploadURI, image, size, progress)
+}
+
+// upload posts size bytes of file to uri, such as a firmware image or a
+// backup file. If file is an io.Seeker it is read again when the request must
+// be resent to answer an authentication challenge, otherwise it is read into
+// memory first, so that progress follows what is actually sent.
+func (device Device) upload(ctx context.Context, uri string, file io.Reader, size int64, progress func(sent, total int64)) error {
+	seeker, ok := file.(io.Seeker)
+	if !ok {
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		reader := bytes.NewReader(data)
+		file, seeker = reader, reader
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	body := &progressReader{reader: file, total: size, progress: progress}
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.GetBody = func() (io.ReadCloser, error) {
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(&progressReader{reader: file, total: size, progress: progress}), nil
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	// Let the device answer the digest challenge before the body is sent
+	req.Header.Set("Expect", "100-continue")
+
+	resp, err := device.sendHTTP(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return &SOAPFault{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// UpgradeSystemFirmware sends a firmware image to the device with the legacy
+// MTOM operation, and returns the message of the device
+func (device Device) UpgradeSystemFirmware(firmware []byte) (string, error) {
+	return device.UpgradeSystemFirmwareContext(context.Background(), firmware)
+}
+
+// UpgradeSystemFirmwareContext is like UpgradeSystemFirmware but sends the request with ctx.
+func (device Device) UpgradeSystemFirmwareContext(ctx context.Context, firmware []byte) (string, error) {
+	// create SOAP
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body: `<UpgradeSystemFirmware xmlns="http://www.onvif.org/ver10/device/wsdl">
+			<Firmware><xop:Include xmlns:xop="http://www.w3.org/2004/08/xop/include" href="cid:firmware"/></Firmware>
+		</UpgradeSystemFirmware>`,
+		attachments: map[string][]byte{"firmware": firmware},
+	}
+
+	var message string
+
+	// send request
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
+	if err != nil {
+		return message, err
+	}
+
+	// parse response into interface
+	ifaceMessage, err := response.ValueForPath("Envelope.Body.UpgradeSystemFirmwareResponse")
+	if err != nil {
+		return message, err
+	}
+
+	// parse message
+	if mapMessage, ok := ifaceMessage.(map[string]interface{}); ok {
+		message = interfaceToString(mapMessage["Message"])
+	}
+
+	return message, nil
+}
+
+// WaitForReboot polls GetInformation every interval until the device reports
+// a firmware version other than previous, and returns its information. The
+// device is expected to be unreachable for a while. Interval defaults to 5
+// seconds and timeout to 10 minutes when zero. When timeout passes, the error
+// is ErrFirmwareUnchanged if the device answered with the previous version,
+// or the last request's error otherwise. If ctx is done first, its error is
+// returned.
+func (device Device) WaitForReboot(ctx context.Context, previous string, interval, timeout time.Duration) (DeviceInformation, error) {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultRebootTimeout
+	}
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastErr := ErrFirmwareUnchanged
+	for {
+		select {
+		case <-ctx.Done():
+			if err := parent.Err(); err != nil {
+				return DeviceInformation{}, err
+			}
+			return DeviceInformation{}, lastErr
+		case <-ticker.C:
+		}
+
+		information, err := device.GetInformationContext(ctx)
+		switch {
+		case err == nil && information.FirmwareVersion != previous:
+			return information, nil
+		case err == nil:
+			lastErr = ErrFirmwareUnchanged
+		case ctx.Err() == nil:
+			logAt(device.Logger, LogDebug, "onvif device not back yet", "xaddr", redact(device.XAddr), "error", err)
+			lastErr = err
+		}
+	}
+}
+
+// UpgradeFirmware upgrades the device with a firmware image and waits for it
+// to come back with a new firmware version, whose information is returned.
+// The image is uploaded over HTTP when the device advertises it, and with
+// the legacy UpgradeSystemFirmware otherwise.
+func (device Device) UpgradeFirmware(ctx context.Context, image io.ReadSeeker, opts FirmwareUpgradeOptions) (DeviceInformation, error) {
+	if opts.RebootTimeout <= 0 {
+		opts.RebootTimeout = defaultRebootTimeout
+	}
+
+	before, err := device.GetInformationContext(ctx)
+	if err != nil {
+		return DeviceInformation{}, err
+	}
+
+	size, err := image.Seek(0, io.SeekEnd)
+	if err != nil {
+		return DeviceInformation{}, err
+	}
+	if _, err := image.Seek(0, io.SeekStart); err != nil {
+		return DeviceInformation{}, err
+	}
+
+	if device.systemCapabilities(ctx).HttpFirmwareUpgrade {
+		upgrade, err := device.StartFirmwareUpgradeContext(ctx)
+		if err != nil {
+			return DeviceInformation{}, err
+		}
+		if err := device.UploadFirmware(ctx, upgrade, image, size, opts.Progress); err != nil {
+			return DeviceInformation{}, err
+		}
+	} else {
+		firmware, err := ioutil.ReadAll(image)
+		if err != nil {
+			return DeviceInformation{}, err
+		}
+		if opts.Progress != nil {
+			opts.Progress(0, size)
+		}
+		if _, err := device.UpgradeSystemFirmwareContext(ctx, firmware); err != nil {
+			return DeviceInformation{}, err
+		}
+		if opts.Progress != nil {
+			opts.Progress(size, size)
+		}
+	}
+
+	return device.WaitForReboot(ctx, before.FirmwareVersion, opts.PollInterval, opts.RebootTimeout)
+}
+
+// systemCapabilities returns the system capabilities of the device service,
+// or none when the device does not support GetServices.
+func (device Device) systemCapabilities(ctx context.Context) DeviceSystemCapabilitiesService {
+	services, err := device.GetServiceCapabilitiesContext(ctx)
+	if err != nil {
+		return DeviceSystemCapabilitiesService{}
+	}
+
+	for _, service := range services {
+		if capabilities, ok := service.Capabilities.Capabilities.(DeviceCapabilitiesService); ok {
+			return capabilities.System
+		}
+	}
+	return DeviceSystemCapabilitiesService{}
+}
+
+// progressReader reports how much of a body has been read.
+type progressReader struct {
+	reader   io.Reader
+	sent     int64
+	total    int64
+	progress func(sent, total int64)
+}
+
+func (reader *progressReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	reader.sent += int64(n)
+	if reader.progress != nil && n > 0 {
+		reader.progress(reader.sent, reader.total)
+	}
+	return n, err
+}
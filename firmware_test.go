@@ -0,0 +1,221 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFirmwareDevice stands in for a device being upgraded. It reports
+// firmware 1.0 until an image is uploaded, and 2.0 afterwards.
+type fakeFirmwareDevice struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	httpUpgrade bool   // advertise HttpFirmwareUpgrade
+	image       []byte // the uploaded image
+	upgrade     string // the UpgradeSystemFirmware envelope
+}
+
+func newFakeFirmwareDevice(t *testing.T, httpUpgrade bool) *fakeFirmwareDevice {
+	device := &fakeFirmwareDevice{httpUpgrade: httpUpgrade}
+	device.Server = newSOAPServer(t, "", nil, withHandler(device.serve))
+	return device
+}
+
+func (device *fakeFirmwareDevice) serve(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	if r.URL.Path == "/upload" {
+		if r.Header.Get("Content-Type") != "application/octet-stream" {
+			http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+			return true
+		}
+		device.image = body
+		return true
+	}
+
+	parts := mtomParts(r.Header.Get("Content-Type"), body)
+	request := string(parts[""])
+
+	var response string
+	switch {
+	case strings.Contains(request, "GetDeviceInformation"):
+		version := "1.0"
+		if device.image != nil {
+			version = "2.0"
+		}
+		response = `<tds:GetDeviceInformationResponse><tds:FirmwareVersion>` + version + `</tds:FirmwareVersion></tds:GetDeviceInformationResponse>`
+	case strings.Contains(request, "GetServices"):
+		response = `<tds:GetServicesResponse><tds:Service>
+			<tds:Namespace>http://www.onvif.org/ver10/device/wsdl</tds:Namespace>
+			<tds:XAddr>` + device.URL + `/onvif/device_service</tds:XAddr>
+			<tds:Capabilities><tds:Capabilities>
+				<tds:System FirmwareUpgrade="true" HttpFirmwareUpgrade="` + boolToString(device.httpUpgrade) + `"/>
+			</tds:Capabilities></tds:Capabilities>
+		</tds:Service></tds:GetServicesResponse>`
+	case strings.Contains(request, "StartFirmwareUpgrade"):
+		response = `<tds:StartFirmwareUpgradeResponse>
+			<tds:UploadUri>` + device.URL + `/upload</tds:UploadUri>
+			<tds:UploadDelay>PT0.05S</tds:UploadDelay>
+			<tds:ExpectedDownTime>PT2M</tds:ExpectedDownTime>
+		</tds:StartFirmwareUpgradeResponse>`
+	case strings.Contains(request, "UpgradeSystemFirmware"):
+		device.image = parts["<firmware>"]
+		device.upgrade = request
+		response = `<tds:UpgradeSystemFirmwareResponse><tds:Message>Upgrading</tds:Message></tds:UpgradeSystemFirmwareResponse>`
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return true
+	}
+
+	writeSOAPResponse(w, http.StatusOK, response, nil)
+	return true
+}
+
+func TestStartFirmwareUpgrade(t *testing.T) {
+	server := newFakeFirmwareDevice(t, true)
+
+	upgrade, err := Device{XAddr: server.URL}.StartFirmwareUpgrade()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := FirmwareUpgrade{UploadURI: server.URL + "/upload", UploadDelay: 50 * time.Millisecond, ExpectedDownTime: 2 * time.Minute}
+	if upgrade != expected {
+		t.Fatalf("expected %+v, got %+v", expected, upgrade)
+	}
+}
+
+func TestUpgradeFirmware(t *testing.T) {
+	image := bytes.Repeat([]byte("firmware"), 64*1024)
+
+	for _, httpUpgrade := range []bool{true, false} {
+		server := newFakeFirmwareDevice(t, httpUpgrade)
+
+		var sent, total int64
+		opts := FirmwareUpgradeOptions{
+			Progress:      func(s, t int64) { sent, total = s, t },
+			PollInterval:  10 * time.Millisecond,
+			RebootTimeout: 2 * time.Second,
+		}
+		information, err := Device{XAddr: server.URL}.UpgradeFirmware(context.Background(), bytes.NewReader(image), opts)
+		if err != nil {
+			t.Fatalf("HTTP upgrade %v: %v", httpUpgrade, err)
+		}
+
+		if information.FirmwareVersion != "2.0" {
+			t.Errorf("HTTP upgrade %v: expected firmware 2.0, got %q", httpUpgrade, information.FirmwareVersion)
+		}
+		if !bytes.Equal(server.image, image) {
+			t.Errorf("HTTP upgrade %v: device received %d bytes, expected %d", httpUpgrade, len(server.image), len(image))
+		}
+		if sent != int64(len(image)) || total != int64(len(image)) {
+			t.Errorf("HTTP upgrade %v: last progress %d/%d", httpUpgrade, sent, total)
+		}
+		if !httpUpgrade && !strings.Contains(server.upgrade, `href="cid:firmware"`) {
+			t.Errorf("MTOM request does not reference the attachment: %s", server.upgrade)
+		}
+	}
+}
+
+func TestWaitForRebootTimeout(t *testing.T) {
+	server := newFakeFirmwareDevice(t, true)
+
+	_, err := Device{XAddr: server.URL}.WaitForReboot(context.Background(), "1.0", 10*time.Millisecond, 100*time.Millisecond)
+	if !errors.Is(err, ErrFirmwareUnchanged) {
+		t.Fatalf("expected ErrFirmwareUnchanged, got %v", err)
+	}
+
+	server.Close()
+	_, err = Device{XAddr: server.URL}.WaitForReboot(context.Background(), "1.0", 10*time.Millisecond, 100*time.Millisecond)
+	if err == nil || errors.Is(err, ErrFirmwareUnchanged) {
+		t.Fatalf("expected the connection error, got %v", err)
+	}
+}
+
+func TestWaitForRebootCancelled(t *testing.T) {
+	server := newFakeFirmwareDevice(t, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := Device{XAddr: server.URL}.WaitForReboot(ctx, "1.0", 10*time.Millisecond, time.Minute)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the context's error, got %v", err)
+	}
+}
+
+func TestUploadFirmwareAnswersChallengeFirst(t *testing.T) {
+	image := bytes.Repeat([]byte("firmware"), 64*1024)
+	server := newFakeFirmwareDevice(t, true)
+
+	// Refuse uploads without credentials before reading the body, so it
+	// is only sent once the challenge is answered
+	var mu sync.Mutex
+	challenged := false
+	var expect []string
+	next := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/upload" {
+			mu.Lock()
+			expect = append(expect, r.Header.Get("Expect"))
+			if r.Header.Get("Authorization") == "" {
+				challenged = true
+				mu.Unlock()
+				w.Header().Set("WWW-Authenticate", `Digest realm="onvif", nonce="abc", qop="auth"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			mu.Unlock()
+		}
+		next.ServeHTTP(w, r)
+	})
+
+	upgrade := FirmwareUpgrade{UploadURI: server.URL + "/upload"}
+	progressed := false
+	progress := func(sent, total int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !challenged {
+			t.Errorf("progress %d/%d reported before the challenge was answered", sent, total)
+		}
+		progressed = true
+	}
+
+	// A reader that can't be rewound
+	reader := struct{ io.Reader }{bytes.NewReader(image)}
+	device := Device{XAddr: server.URL, User: "admin", Password: "secret"}
+	if err := device.UploadFirmware(context.Background(), upgrade, reader, int64(len(image)), progress); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(server.image, image) {
+		t.Errorf("device received %d bytes, expected %d", len(server.image), len(image))
+	}
+	if !progressed {
+		t.Error("expected progress to be reported")
+	}
+	if len(expect) != 2 || expect[0] != "100-continue" {
+		t.Errorf("expected the upload to wait for 100-continue, got %q", expect)
+	}
+}
+
+func TestWaitForRebootDefaultTimeout(t *testing.T) {
+	server := newFakeFirmwareDevice(t, true)
+	server.image = []byte("firmware")
+
+	information, err := Device{XAddr: server.URL}.WaitForReboot(context.Background(), "1.0", 10*time.Millisecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if information.FirmwareVersion != "2.0" {
+		t.Fatalf("expected firmware 2.0, got %+v", information)
+	}
+}
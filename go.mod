@@ -1,9 +1,8 @@
 module github.com/quocson95/go-onvif
 
-go 1.13
+go 1.14
 
 require (
 	github.com/clbanning/mxj v1.8.4
-	github.com/golang/glog v1.2.4
 	github.com/google/uuid v1.2.0
 )
@@ -0,0 +1,168 @@
+package onvif
+
+import (
+	"context"
+	"net"
+
+	"github.com/clbanning/mxj"
+)
+
+// The types of IPAddressFilter.
+const (
+	IPAddressFilterAllow = "Allow"
+	IPAddressFilterDeny  = "Deny"
+)
+
+// NewIPAddressFilter creates a filter of filterType, IPAddressFilterAllow or
+// IPAddressFilterDeny, for IPv4 and IPv6 addresses or CIDR ranges such as
+// "10.20.0.0/16".
+func NewIPAddressFilter(filterType string, addrs ...string) (IPAddressFilter, error) {
+	filter := IPAddressFilter{Type: filterType}
+	for _, addr := range addrs {
+		ip, ipNet, err := net.ParseCIDR(addr)
+		if err != nil {
+			ip = net.ParseIP(addr)
+			if ip == nil {
+				return IPAddressFilter{}, err
+			}
+			ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+		}
+
+		prefixLength, _ := ipNet.Mask.Size()
+		if ip.To4() != nil {
+			if prefixLength > 32 {
+				prefixLength -= 96
+			}
+			filter.IPv4Address = append(filter.IPv4Address, PrefixedIPAdress{Address: ipNet.IP.To4().String(), PrefixLength: prefixLength})
+		} else {
+			filter.IPv6Address = append(filter.IPv6Address, PrefixedIPAdress{Address: ipNet.IP.String(), PrefixLength: prefixLength})
+		}
+	}
+	return filter, nil
+}
+
+// GetIPAddressFilter fetch the IP address filter of an ONVIF camera
+func (device Device) GetIPAddressFilter() (IPAddressFilter, error) {
+	return device.GetIPAddressFilterContext(context.Background())
+}
+
+// GetIPAddressFilterContext is like GetIPAddressFilter but sends the request with ctx.
+func (device Device) GetIPAddressFilterContext(ctx context.Context) (IPAddressFilter, error) {
+	// create SOAP
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body:     `<GetIPAddressFilter xmlns="http://www.onvif.org/ver10/device/wsdl"/>`,
+	}
+
+	result := IPAddressFilter{}
+
+	// send request
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
+	if err != nil {
+		return result, err
+	}
+
+	// parse response into interface
+	ifaceFilter, err := response.ValueForPath("Envelope.Body.GetIPAddressFilterResponse.IPAddressFilter")
+	if err != nil {
+		return result, err
+	}
+
+	// parse interface into struct
+	if mapFilter, ok := ifaceFilter.(map[string]interface{}); ok {
+		result.Type = interfaceToString(mapFilter["Type"])
+		result.IPv4Address = readPrefixedIPAddresses(mapFilter, "IPv4Address")
+		result.IPv6Address = readPrefixedIPAddresses(mapFilter, "IPv6Address")
+	}
+
+	return result, nil
+}
+
+// SetIPAddressFilter replaces the IP address filter of an ONVIF camera
+func (device Device) SetIPAddressFilter(filter IPAddressFilter) error {
+	return device.SetIPAddressFilterContext(context.Background(), filter)
+}
+
+// SetIPAddressFilterContext is like SetIPAddressFilter but sends the request with ctx.
+func (device Device) SetIPAddressFilterContext(ctx context.Context, filter IPAddressFilter) error {
+	return device.sendIPAddressFilter(ctx, "SetIPAddressFilter", filter)
+}
+
+// AddIPAddressFilter adds the addresses of filter to the IP address filter of
+// an ONVIF camera
+func (device Device) AddIPAddressFilter(filter IPAddressFilter) error {
+	return device.AddIPAddressFilterContext(context.Background(), filter)
+}
+
+// AddIPAddressFilterContext is like AddIPAddressFilter but sends the request with ctx.
+func (device Device) AddIPAddressFilterContext(ctx context.Context, filter IPAddressFilter) error {
+	return device.sendIPAddressFilter(ctx, "AddIPAddressFilter", filter)
+}
+
+// RemoveIPAddressFilter removes the addresses of filter from the IP address
+// filter of an ONVIF camera
+func (device Device) RemoveIPAddressFilter(filter IPAddressFilter) error {
+	return device.RemoveIPAddressFilterContext(context.Background(), filter)
+}
+
+// RemoveIPAddressFilterContext is like RemoveIPAddressFilter but sends the request with ctx.
+func (device Device) RemoveIPAddressFilterContext(ctx context.Context, filter IPAddressFilter) error {
+	return device.sendIPAddressFilter(ctx, "RemoveIPAddressFilter", filter)
+}
+
+// sendIPAddressFilter sends filter with operation, which Set, Add and Remove
+// share.
+func (device Device) sendIPAddressFilter(ctx context.Context, operation string, filter IPAddressFilter) error {
+	body := `<` + operation + ` xmlns="http://www.onvif.org/ver10/device/wsdl">
+		<IPAddressFilter>
+			<Type xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(filter.Type) + `</Type>`
+	for _, addr := range filter.IPv4Address {
+		body += `<IPv4Address xmlns="http://www.onvif.org/ver10/schema">
+				<Address>` + escapeXML(addr.Address) + `</Address>
+				<PrefixLength>` + intToString(addr.PrefixLength) + `</PrefixLength>
+			</IPv4Address>`
+	}
+	for _, addr := range filter.IPv6Address {
+		body += `<IPv6Address xmlns="http://www.onvif.org/ver10/schema">
+				<Address>` + escapeXML(addr.Address) + `</Address>
+				<PrefixLength>` + intToString(addr.PrefixLength) + `</PrefixLength>
+			</IPv6Address>`
+	}
+	body += `</IPAddressFilter>
+		</` + operation + `>`
+
+	// create SOAP
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body:     body,
+	}
+
+	// send request
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
+	if err != nil {
+		return err
+	}
+
+	_, err = response.ValueForPath("Envelope.Body." + operation + "Response")
+	return err
+}
+
+// readPrefixedIPAddresses reads the addresses of a repeated element of an
+// IP address filter.
+func readPrefixedIPAddresses(mapFilter map[string]interface{}, name string) []PrefixedIPAdress {
+	var result []PrefixedIPAdress
+	ifaceAddrs, _ := mxj.Map(mapFilter).ValuesForPath(name)
+	for _, ifaceAddr := range ifaceAddrs {
+		if mapAddr, ok := ifaceAddr.(map[string]interface{}); ok {
+			result = append(result, PrefixedIPAdress{
+				Address:      interfaceToString(mapAddr["Address"]),
+				PrefixLength: interfaceToInt(mapAddr["PrefixLength"]),
+			})
+		}
+	}
+	return result
+}
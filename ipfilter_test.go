@@ -0,0 +1,100 @@
+package onvif
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/clbanning/mxj"
+)
+
+func TestNewIPAddressFilter(t *testing.T) {
+	filter, err := NewIPAddressFilter(IPAddressFilterAllow, "10.20.0.0/16", "192.168.1.7", "fd00::/8", "::ffff:10.0.0.0/104")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := IPAddressFilter{
+		Type: IPAddressFilterAllow,
+		IPv4Address: []PrefixedIPAdress{
+			{Address: "10.20.0.0", PrefixLength: 16},
+			{Address: "192.168.1.7", PrefixLength: 32},
+			{Address: "10.0.0.0", PrefixLength: 8},
+		},
+		IPv6Address: []PrefixedIPAdress{
+			{Address: "fd00::", PrefixLength: 8},
+		},
+	}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, filter)
+	}
+
+	if _, err := NewIPAddressFilter(IPAddressFilterDeny, "10.20.0.0/33"); err == nil {
+		t.Fatal("expected an error for an invalid range")
+	}
+}
+
+func TestGetIPAddressFilter(t *testing.T) {
+	server := newSOAPServer(t, `<tds:GetIPAddressFilterResponse><tds:IPAddressFilter>
+		<tt:Type>Allow</tt:Type>
+		<tt:IPv4Address><tt:Address>10.20.0.0</tt:Address><tt:PrefixLength>16</tt:PrefixLength></tt:IPv4Address>
+		<tt:IPv4Address><tt:Address>10.30.0.0</tt:Address><tt:PrefixLength>24</tt:PrefixLength></tt:IPv4Address>
+		<tt:IPv6Address><tt:Address>fd00::</tt:Address><tt:PrefixLength>8</tt:PrefixLength></tt:IPv6Address>
+	</tds:IPAddressFilter></tds:GetIPAddressFilterResponse>`, nil)
+
+	filter, err := Device{XAddr: server.URL}.GetIPAddressFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := IPAddressFilter{
+		Type: IPAddressFilterAllow,
+		IPv4Address: []PrefixedIPAdress{
+			{Address: "10.20.0.0", PrefixLength: 16},
+			{Address: "10.30.0.0", PrefixLength: 24},
+		},
+		IPv6Address: []PrefixedIPAdress{
+			{Address: "fd00::", PrefixLength: 8},
+		},
+	}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, filter)
+	}
+}
+
+func TestSetIPAddressFilter(t *testing.T) {
+	var request string
+	server := newSOAPServer(t, `<tds:SetIPAddressFilterResponse/>`, &request)
+
+	filter, _ := NewIPAddressFilter(IPAddressFilterAllow, "10.20.0.0/16", "10.30.0.0/24")
+	if err := (Device{XAddr: server.URL}).SetIPAddressFilter(filter); err != nil {
+		t.Fatal(err)
+	}
+	if value := requestValue(t, request, "Envelope.Body.SetIPAddressFilter.IPAddressFilter.Type"); value != "Allow" {
+		t.Fatalf("expected an Allow filter, got %v", value)
+	}
+
+	mapXML, _ := mxj.NewMapXml([]byte(request))
+	addresses, _ := mapXML.ValuesForPath("Envelope.Body.SetIPAddressFilter.IPAddressFilter.IPv4Address.Address")
+	if len(addresses) != 2 || addresses[1] != "10.30.0.0" {
+		t.Fatalf("unexpected addresses %v", addresses)
+	}
+}
+
+func TestAddAndRemoveIPAddressFilter(t *testing.T) {
+	filter, _ := NewIPAddressFilter(IPAddressFilterDeny, "2001:db8::/32")
+
+	var request string
+	server := newSOAPServer(t, `<tds:AddIPAddressFilterResponse/>`, &request)
+	if err := (Device{XAddr: server.URL}).AddIPAddressFilter(filter); err != nil {
+		t.Fatal(err)
+	}
+	if value := requestValue(t, request, "Envelope.Body.AddIPAddressFilter.IPAddressFilter.IPv6Address.PrefixLength"); value != "32" {
+		t.Fatalf("expected a /32 prefix, got %v", value)
+	}
+
+	server = newSOAPServer(t, `<tds:RemoveIPAddressFilterResponse/>`, &request)
+	if err := (Device{XAddr: server.URL}).RemoveIPAddressFilter(filter); err != nil {
+		t.Fatal(err)
+	}
+	if value := requestValue(t, request, "Envelope.Body.RemoveIPAddressFilter.IPAddressFilter.IPv6Address.Address"); value != "2001:db8::" {
+		t.Fatalf("expected 2001:db8::, got %v", value)
+	}
+}
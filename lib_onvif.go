@@ -2,7 +2,7 @@ package onvif
 
 import (
 	"encoding/json"
-	"github.com/golang/glog"
+	"errors"
 	"net"
 	"time"
 )
@@ -94,7 +94,7 @@ func GetMediaInformation(host, username, password string) string {
 	caps, err := od.GetCapabilities()
 	if err != nil {
 		profile.LastError = "profile.onvif.getcapabilities.error"
-		glog.Warning("Get capabilities error")
+		logAt(nil, LogWarn, "get capabilities failed", "xaddr", redact(host), "error", err)
 
 		result.Error = "res.error.getcapabilities"
 		result.Data = profile
@@ -119,7 +119,7 @@ func GetMediaInformation(host, username, password string) string {
 
 	if err != nil {
 		profile.LastError = "profile.onvif.getprofiles.error"
-		glog.Warning("Get profiles error")
+		logAt(nil, LogWarn, "get profiles failed", "xaddr", redact(odm.XAddr), "error", err)
 		result.Error = "res.error.getprofiles"
 		result.Data = profile
 		str, _ := json.Marshal(result)
@@ -127,12 +127,12 @@ func GetMediaInformation(host, username, password string) string {
 	}
 
 	for _, ovfprofile := range profiles {
-		glog.Infof("Get profile %s", ovfprofile.Token)
+		logAt(nil, LogDebug, "get profile", "xaddr", redact(odm.XAddr), "profile", ovfprofile.Token)
 		// Get streaming uri
 		uri, err := odm.GetStreamURI(ovfprofile.Token, "RTSP")
 
 		if err != nil {
-			glog.Warning("Get streaming error")
+			logAt(nil, LogWarn, "get stream uri failed", "xaddr", redact(odm.XAddr), "profile", ovfprofile.Token, "error", err)
 			continue
 		}
 
@@ -145,7 +145,7 @@ func GetMediaInformation(host, username, password string) string {
 
 		if err != nil {
 			profile.LastError = "profile.onvif.getsnapshot.error"
-			glog.Warningf("Get snapshot for %s error %v", ovfprofile.Token, err)
+			logAt(nil, LogWarn, "get snapshot uri failed", "xaddr", redact(odm.XAddr), "profile", ovfprofile.Token, "error", err)
 		}
 
 		profile.Streams = append(profile.Streams, Stream{
@@ -161,7 +161,7 @@ func GetMediaInformation(host, username, password string) string {
 			VideoSourceToken: ovfprofile.VideoSourceConfig.Token,
 		})
 
-		glog.Infof("Get profile %s done", ovfprofile.Token)
+		logAt(nil, LogDebug, "get profile done", "xaddr", redact(odm.XAddr), "profile", ovfprofile.Token)
 	}
 
 	profile.Authorize = true
@@ -205,10 +205,10 @@ func PtzStart(host, username, password string, x, y, z float64) string {
 	ptzXAddr := mapPtzXAddr[od.XAddr]
 	mediaXAddr := mapMediaXAddr[od.XAddr]
 	if ptzXAddr == "" || mediaXAddr == "" {
-		glog.Info("Find PTZ And Media Address")
+		logAt(nil, LogDebug, "find ptz and media address", "xaddr", redact(od.XAddr))
 		caps, err := GetXAddress(od)
 		if err != nil {
-			if CheckAuthorizedError(err.Error()) {
+			if errors.Is(err, ErrNotAuthorized) {
 				result.Error = "res.error.unauthorized"
 			} else {
 				result.Error = "res.error.getptzxaddr"
@@ -222,7 +222,7 @@ func PtzStart(host, username, password string, x, y, z float64) string {
 	// get profile
 	profileToken := mapProfile[od.XAddr]
 	if profileToken == "" {
-		glog.Info("Find Profile")
+		logAt(nil, LogDebug, "find profile", "xaddr", redact(mediaXAddr))
 		// Media device control
 		odMedia := Device{
 			XAddr:    mediaXAddr,
@@ -231,8 +231,8 @@ func PtzStart(host, username, password string, x, y, z float64) string {
 		}
 		profiles, err := odMedia.GetProfiles()
 		if err != nil {
-			glog.Info(err)
-			if CheckAuthorizedError(err.Error()) {
+			logAt(nil, LogWarn, "get profiles failed", "xaddr", redact(mediaXAddr), "error", err)
+			if errors.Is(err, ErrNotAuthorized) {
 				result.Error = "res.error.unauthorized"
 			} else {
 				result.Error = "res.error.getprofile"
@@ -243,8 +243,7 @@ func PtzStart(host, username, password string, x, y, z float64) string {
 		mapProfile[od.XAddr] = profiles[0].Token
 		profileToken = mapProfile[od.XAddr]
 	}
-	glog.Info("PTZ XAddr: ", ptzXAddr)
-	glog.Info("Profile Token: ", profileToken)
+	logAt(nil, LogDebug, "ptz address found", "xaddr", redact(ptzXAddr), "profile", profileToken)
 	// PTZ device control
 	odPtz := Device{
 		XAddr:    ptzXAddr,
@@ -261,8 +260,8 @@ func PtzStart(host, username, password string, x, y, z float64) string {
 		},
 	})
 	if err != nil {
-		glog.Warning("PTZ Start Error: ", err.Error())
-		if CheckAuthorizedError(err.Error()) {
+		logAt(nil, LogWarn, "ptz start failed", "xaddr", redact(ptzXAddr), "error", err)
+		if errors.Is(err, ErrNotAuthorized) {
 			result.Error = "res.error.unauthorized"
 		} else {
 			result.Error = "res.error.ptzstart"
@@ -287,11 +286,11 @@ func PtzStop(host, username, password string) string {
 	ptzXAddr := mapPtzXAddr[od.XAddr]
 	mediaXAddr := mapMediaXAddr[od.XAddr]
 	if ptzXAddr == "" || mediaXAddr == "" {
-		glog.Info("Find PTZ And Media Address")
+		logAt(nil, LogDebug, "find ptz and media address", "xaddr", redact(od.XAddr))
 
 		caps, err := GetXAddress(od)
 		if err != nil {
-			if CheckAuthorizedError(err.Error()) {
+			if errors.Is(err, ErrNotAuthorized) {
 				result.Error = "res.error.unauthorized"
 			} else {
 				result.Error = "res.error.getptzxaddr"
@@ -306,7 +305,7 @@ func PtzStop(host, username, password string) string {
 	// get profile
 	profileToken := mapProfile[od.XAddr]
 	if profileToken == "" {
-		glog.Info("Find Profile")
+		logAt(nil, LogDebug, "find profile", "xaddr", redact(mediaXAddr))
 		// Media device control
 		odMedia := Device{
 			XAddr:    mediaXAddr,
@@ -315,8 +314,8 @@ func PtzStop(host, username, password string) string {
 		}
 		profiles, err := odMedia.GetProfiles()
 		if err != nil {
-			glog.Info(err)
-			if CheckAuthorizedError(err.Error()) {
+			logAt(nil, LogWarn, "get profiles failed", "xaddr", redact(mediaXAddr), "error", err)
+			if errors.Is(err, ErrNotAuthorized) {
 				result.Error = "res.error.unauthorized"
 			} else {
 				result.Error = "res.error.getprofile"
@@ -327,8 +326,7 @@ func PtzStop(host, username, password string) string {
 		mapProfile[od.XAddr] = profiles[0].Token
 		profileToken = mapProfile[od.XAddr]
 	}
-	glog.Info("PTZ XAddr: ", ptzXAddr)
-	glog.Info("Profile Token: ", profileToken)
+	logAt(nil, LogDebug, "ptz address found", "xaddr", redact(ptzXAddr), "profile", profileToken)
 	// PTZ device control
 	odPtz := Device{
 		XAddr:    ptzXAddr,
@@ -337,8 +335,8 @@ func PtzStop(host, username, password string) string {
 	}
 	err := odPtz.Stop(profileToken)
 	if err != nil {
-		glog.Warning("PTZ Stop Error: ", err.Error())
-		if CheckAuthorizedError(err.Error()) {
+		logAt(nil, LogWarn, "ptz stop failed", "xaddr", redact(ptzXAddr), "error", err)
+		if errors.Is(err, ErrNotAuthorized) {
 			result.Error = "res.error.unauthorized"
 		} else {
 			result.Error = "res.error.ptzstop"
@@ -363,11 +361,11 @@ func PtzGoToHome(host, username, password string) string {
 	ptzXAddr := mapPtzXAddr[od.XAddr]
 	mediaXAddr := mapMediaXAddr[od.XAddr]
 	if ptzXAddr == "" || mediaXAddr == "" {
-		glog.Info("Find PTZ And Media Address")
+		logAt(nil, LogDebug, "find ptz and media address", "xaddr", redact(od.XAddr))
 
 		caps, err := GetXAddress(od)
 		if err != nil {
-			if CheckAuthorizedError(err.Error()) {
+			if errors.Is(err, ErrNotAuthorized) {
 				result.Error = "res.error.unauthorized"
 			} else {
 				result.Error = "res.error.getptzxaddr"
@@ -382,7 +380,7 @@ func PtzGoToHome(host, username, password string) string {
 	// get profile
 	profileToken := mapProfile[od.XAddr]
 	if profileToken == "" {
-		glog.Info("Find Profile")
+		logAt(nil, LogDebug, "find profile", "xaddr", redact(mediaXAddr))
 		// Media device control
 		odMedia := Device{
 			XAddr:    mediaXAddr,
@@ -391,8 +389,8 @@ func PtzGoToHome(host, username, password string) string {
 		}
 		profiles, err := odMedia.GetProfiles()
 		if err != nil {
-			glog.Info(err)
-			if CheckAuthorizedError(err.Error()) {
+			logAt(nil, LogWarn, "get profiles failed", "xaddr", redact(mediaXAddr), "error", err)
+			if errors.Is(err, ErrNotAuthorized) {
 				result.Error = "res.error.unauthorized"
 			} else {
 				result.Error = "res.error.getprofile"
@@ -403,8 +401,7 @@ func PtzGoToHome(host, username, password string) string {
 		mapProfile[od.XAddr] = profiles[0].Token
 		profileToken = mapProfile[od.XAddr]
 	}
-	glog.Info("PTZ XAddr: ", ptzXAddr)
-	glog.Info("Profile Token: ", profileToken)
+	logAt(nil, LogDebug, "ptz address found", "xaddr", redact(ptzXAddr), "profile", profileToken)
 	// PTZ device control
 	odPtz := Device{
 		XAddr:    ptzXAddr,
@@ -413,8 +410,8 @@ func PtzGoToHome(host, username, password string) string {
 	}
 	err := odPtz.GotoHomePosition(profileToken)
 	if err != nil {
-		glog.Warning("PTZ Stop Error: ", err.Error())
-		if CheckAuthorizedError(err.Error()) {
+		logAt(nil, LogWarn, "ptz go to home failed", "xaddr", redact(ptzXAddr), "error", err)
+		if errors.Is(err, ErrNotAuthorized) {
 			result.Error = "res.error.unauthorized"
 		} else {
 			result.Error = "res.error.ptzstop"
@@ -0,0 +1,156 @@
+package onvif
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"sync"
+
+	"github.com/clbanning/mxj"
+)
+
+// DiscoveryEvent is a DeviceAppeared or a DeviceLeft event.
+type DiscoveryEvent interface {
+	discoveryEvent()
+}
+
+// DeviceAppeared is sent when a device announces itself with Hello, or
+// multicasts a ProbeMatch that answers someone else's probe.
+type DeviceAppeared struct {
+	DiscoveredDevice
+}
+
+// DeviceLeft is sent when a device says Bye. Devices only have to give
+// their ID, the other fields are set when the Bye carries them.
+type DeviceLeft struct {
+	DiscoveredDevice
+}
+
+func (DeviceAppeared) discoveryEvent() {}
+func (DeviceLeft) discoveryEvent()     {}
+
+// ListenOptions configures ListenDiscovery.
+type ListenOptions struct {
+	// Interface is the name of the network interface to listen on. The
+	// system's default multicast interface is used when empty.
+	Interface string
+}
+
+// ListenDiscovery joins the WS-Discovery multicast groups and emits a typed
+// event for every Hello, Bye or unsolicited ProbeMatch, so devices can be
+// tracked as they come and go without probing. IPv6 is listened to as well
+// when the interface supports it. The channel is closed when ctx ends.
+func ListenDiscovery(ctx context.Context, opts ListenOptions) (<-chan DiscoveryEvent, error) {
+	var itf *net.Interface
+	if opts.Interface != "" {
+		var err error
+		itf, err = net.InterfaceByName(opts.Interface)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", itf, &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 3702})
+	if err != nil {
+		return nil, err
+	}
+	conns := []*net.UDPConn{conn}
+
+	conn, err = net.ListenMulticastUDP("udp6", itf, &net.UDPAddr{IP: net.ParseIP("ff02::c"), Port: 3702})
+	if err != nil {
+		logAt(nil, LogWarn, "cannot listen for IPv6 discovery", "interface", opts.Interface, "error", err)
+	} else {
+		conns = append(conns, conn)
+	}
+
+	events := make(chan DiscoveryEvent)
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *net.UDPConn) {
+			defer wg.Done()
+			listenDiscoveryEvents(ctx, conn, events)
+		}(conn)
+	}
+
+	go func() {
+		<-ctx.Done()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	return events, nil
+}
+
+// listenDiscoveryEvents reads conn until it is closed and sends the events it
+// carries.
+func listenDiscoveryEvents(ctx context.Context, conn *net.UDPConn, events chan<- DiscoveryEvent) {
+	buffer := make([]byte, 10*1024)
+	for {
+		n, source, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+
+		for _, event := range readDiscoveryEvents(buffer[:n], source) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// readDiscoveryEvents parses a multicast WS-Discovery message. Probes and
+// messages we can't parse have no events.
+func readDiscoveryEvents(buffer []byte, source net.Addr) []DiscoveryEvent {
+	operation := discoveryOperation(buffer)
+	if level := operationLogLevel(operation); level != LogOff {
+		logAt(nil, level, "discovery message", "operation", operation, "source", source.String(), "body", redact(string(buffer)))
+	}
+
+	mapXML, err := mxj.NewMapXml(buffer)
+	if err != nil {
+		logAt(nil, LogDebug, "discovery message is not valid XML", "source", source.String(), "error", err)
+		return nil
+	}
+
+	var events []DiscoveryEvent
+	if hello, err := mapXML.ValueForPath("Envelope.Body.Hello"); err == nil {
+		if mapHello, ok := hello.(map[string]interface{}); ok {
+			events = append(events, DeviceAppeared{readDiscoveredDevice(mapHello, source)})
+		}
+	}
+
+	if bye, err := mapXML.ValueForPath("Envelope.Body.Bye"); err == nil {
+		if mapBye, ok := bye.(map[string]interface{}); ok {
+			events = append(events, DeviceLeft{readDiscoveredDevice(mapBye, source)})
+		}
+	}
+
+	probeMatches, _ := mapXML.ValuesForPath("Envelope.Body.ProbeMatches.ProbeMatch")
+	for _, probeMatch := range probeMatches {
+		if mapProbeMatch, ok := probeMatch.(map[string]interface{}); ok {
+			events = append(events, DeviceAppeared{readDiscoveredDevice(mapProbeMatch, source)})
+		}
+	}
+
+	return events
+}
+
+var discoveryBodyRegexp = regexp.MustCompile(`<(?:[\w.-]+:)?Body(?:\s[^>]*)?>\s*<(?:[\w.-]+:)?([\w.-]+)`)
+
+// discoveryOperation returns the name of the message in a discovery
+// envelope, such as Hello or Bye, so it is logged at its operation's level.
+func discoveryOperation(buffer []byte) string {
+	if match := discoveryBodyRegexp.FindSubmatch(buffer); match != nil {
+		return string(match[1])
+	}
+	return ""
+}
@@ -0,0 +1,144 @@
+package onvif
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testHello = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl" xmlns:tds="http://www.onvif.org/ver10/device/wsdl">
+	<s:Header><a:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/Hello</a:Action></s:Header>
+	<s:Body><d:Hello>
+		<a:EndpointReference><a:Address>urn:uuid:2419d68a-2dd2-21b2-a205-ec3c2d3b9f41</a:Address></a:EndpointReference>
+		<d:Types>dn:NetworkVideoTransmitter tds:Device</d:Types>
+		<d:Scopes MatchBy="http://schemas.xmlsoap.org/ws/2005/04/discovery/rfc3986">onvif://www.onvif.org/name/Front_Door onvif://www.onvif.org/Profile/Streaming</d:Scopes>
+		<d:XAddrs>http://192.168.1.20/onvif/device_service http://[fd00::20]/onvif/device_service</d:XAddrs>
+		<d:MetadataVersion>3</d:MetadataVersion>
+	</d:Hello></s:Body>
+</s:Envelope>`
+
+const testBye = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+	<s:Header><a:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/Bye</a:Action></s:Header>
+	<s:Body><d:Bye><a:EndpointReference><a:Address>urn:uuid:2419d68a-2dd2-21b2-a205-ec3c2d3b9f41</a:Address></a:EndpointReference></d:Bye></s:Body>
+</s:Envelope>`
+
+func TestReadDiscoveryEvents(t *testing.T) {
+	source := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: 3702}
+
+	events := readDiscoveryEvents([]byte(testHello), source)
+	expected := DeviceAppeared{DiscoveredDevice{
+		ID:              "2419d68a-2dd2-21b2-a205-ec3c2d3b9f41",
+		XAddrs:          []string{"http://192.168.1.20/onvif/device_service", "http://[fd00::20]/onvif/device_service"},
+		Scopes:          []string{"onvif://www.onvif.org/name/Front_Door", "onvif://www.onvif.org/Profile/Streaming"},
+		Types:           []string{"dn:NetworkVideoTransmitter", "tds:Device"},
+		MetadataVersion: 3,
+		Source:          source,
+		Name:            "Front Door",
+		Profiles:        []string{"Streaming"},
+	}}
+	if len(events) != 1 || !reflect.DeepEqual(events[0], expected) {
+		t.Fatalf("unexpected Hello events %+v", events)
+	}
+
+	events = readDiscoveryEvents([]byte(testBye), source)
+	if len(events) != 1 {
+		t.Fatalf("unexpected Bye events %+v", events)
+	}
+	if left, ok := events[0].(DeviceLeft); !ok || left.ID != "2419d68a-2dd2-21b2-a205-ec3c2d3b9f41" || left.Source != source || len(left.XAddrs) != 0 {
+		t.Fatalf("unexpected Bye events %+v", events)
+	}
+
+	// A Bye may carry the same fields as a Hello
+	bye := strings.Replace(strings.Replace(testHello, "Hello", "Bye", -1), "<d:MetadataVersion>3</d:MetadataVersion>", "<d:MetadataVersion>4</d:MetadataVersion>", 1)
+	events = readDiscoveryEvents([]byte(bye), source)
+	left := DeviceLeft{expected.DiscoveredDevice}
+	left.MetadataVersion = 4
+	if len(events) != 1 || !reflect.DeepEqual(events[0], left) {
+		t.Fatalf("unexpected Bye events %+v", events)
+	}
+
+	events = readDiscoveryEvents([]byte(testProbeMatches), source)
+	if len(events) != 1 {
+		t.Fatalf("unexpected ProbeMatch events %+v", events)
+	}
+	if appeared, ok := events[0].(DeviceAppeared); !ok || appeared.MetadataVersion != 1 {
+		t.Fatalf("unexpected ProbeMatch events %+v", events)
+	}
+
+	if events := readDiscoveryEvents([]byte("not xml"), source); len(events) != 0 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestListenDiscovery(t *testing.T) {
+	itf := multicastInterface(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := ListenDiscovery(ctx, ListenOptions{Interface: itf.Name})
+	if err != nil {
+		t.Skipf("cannot join the multicast group: %v", err)
+	}
+
+	// Announce a device from the interface's address
+	addrs, _ := interfaceAddrs(*itf)
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.ParseIP(addrs[0])})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 3702}
+	for _, message := range []string{testHello, testBye} {
+		if _, err := conn.WriteToUDP([]byte(message), group); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var received []DiscoveryEvent
+	timeout := time.After(2 * time.Second)
+	for len(received) < 2 {
+		select {
+		case event := <-events:
+			received = append(received, event)
+		case <-timeout:
+			t.Fatalf("expected Hello and Bye, got %+v", received)
+		}
+	}
+	if appeared, ok := received[0].(DeviceAppeared); !ok || !strings.HasPrefix(appeared.Source.String(), addrs[0]) {
+		t.Fatalf("unexpected first event %+v", received[0])
+	}
+	if _, ok := received[1].(DeviceLeft); !ok {
+		t.Fatalf("unexpected second event %+v", received[1])
+	}
+
+	cancel()
+	select {
+	case <-drainEvents(events):
+	case <-time.After(2 * time.Second):
+		t.Fatal("events not closed after the context was cancelled")
+	}
+}
+
+// drainEvents reads events until they are closed.
+func drainEvents(events <-chan DiscoveryEvent) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for range events {
+		}
+		close(done)
+	}()
+	return done
+}
+
+func TestDiscoveryOperation(t *testing.T) {
+	for message, expected := range map[string]string{testHello: "Hello", testBye: "Bye", testProbeMatches: "ProbeMatches", "not xml": ""} {
+		if operation := discoveryOperation([]byte(message)); operation != expected {
+			t.Errorf("expected %q, got %q", expected, operation)
+		}
+	}
+}
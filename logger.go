@@ -0,0 +1,135 @@
+package onvif
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// Logger receives the library's log output. Args are alternating key and
+// value pairs, such as "xaddr", "operation", "latency" and "fault", so a
+// *slog.Logger can be used as is.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// LogLevel is the level a message is logged at.
+type LogLevel int
+
+const (
+	// LogDebug is the level SOAP requests and responses are logged at by
+	// default.
+	LogDebug LogLevel = iota
+	// LogInfo logs at info level.
+	LogInfo
+	// LogWarn logs at warning level.
+	LogWarn
+	// LogError logs at error level.
+	LogError
+	// LogOff disables logging.
+	LogOff
+)
+
+// redacted replaces credentials in log output.
+const redacted = "[REDACTED]"
+
+var (
+	loggerMu        sync.RWMutex
+	logger          Logger = nopLogger{}
+	operationLevels        = make(map[string]LogLevel) // key: operation name
+)
+
+// SetLogger makes the library log through l, unless a Device has its own
+// Logger. Nothing is logged by default; passing nil disables logging again.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	logger = l
+}
+
+// SetOperationLogLevel sets the level the requests and responses of an
+// operation, such as "GetSystemDateAndTime", are logged at. Use LogOff to
+// silence a noisy operation.
+func SetOperationLogLevel(operation string, level LogLevel) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	operationLevels[operation] = level
+}
+
+// operationLogLevel returns the level the exchanges of operation are logged
+// at.
+func operationLogLevel(operation string) LogLevel {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	if level, ok := operationLevels[operation]; ok {
+		return level
+	}
+	return LogDebug
+}
+
+// logAt logs msg at level through l, or through the package logger when l is
+// nil.
+func logAt(l Logger, level LogLevel, msg string, args ...interface{}) {
+	if l == nil {
+		loggerMu.RLock()
+		l = logger
+		loggerMu.RUnlock()
+	}
+
+	switch level {
+	case LogDebug:
+		l.Debug(msg, args...)
+	case LogInfo:
+		l.Info(msg, args...)
+	case LogWarn:
+		l.Warn(msg, args...)
+	case LogError:
+		l.Error(msg, args...)
+	}
+}
+
+var (
+	operationRegexp  = regexp.MustCompile(`^\s*<(?:[\w.-]+:)?([\w.-]+)`)
+	credentialRegexp = regexp.MustCompile(`(<(?:[\w.-]+:)?(?:Username|Password|Nonce)(?:\s[^>]*)?>)[^<]*(<)`)
+	userinfoRegexp   = regexp.MustCompile(`([a-zA-Z][\w+.-]*://)[^/@\s<>"']+@`)
+	base64Regexp     = regexp.MustCompile(`[A-Za-z0-9+/\r\n]{256,}={0,2}`)
+)
+
+// operationName returns the name of the operation a SOAP body calls, the
+// local name of its root element.
+func operationName(body string) string {
+	if match := operationRegexp.FindStringSubmatch(body); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// redact hides usernames, passwords, nonces and URL userinfo in a SOAP
+// message or URL before it is logged.
+func redact(message string) string {
+	message = credentialRegexp.ReplaceAllString(message, "${1}"+redacted+"${2}")
+	return userinfoRegexp.ReplaceAllString(message, "${1}"+redacted+"@")
+}
+
+// elideBase64 replaces long base64 content in a SOAP message, such as a
+// backup file or a log, with its size before it is logged.
+func elideBase64(message string) string {
+	return base64Regexp.ReplaceAllStringFunc(message, func(data string) string {
+		return fmt.Sprintf("[%d bytes of base64]", len(data))
+	})
+}
+
+// nopLogger discards everything.
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
@@ -0,0 +1,209 @@
+package onvif
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// The kinds of factory reset of SetSystemFactoryDefault.
+const (
+	// FactoryDefaultSoft keeps the network settings.
+	FactoryDefaultSoft = "Soft"
+	// FactoryDefaultHard resets everything, including the IP address.
+	FactoryDefaultHard = "Hard"
+)
+
+// The logs of GetSystemLog.
+const (
+	SystemLogSystem = "System"
+	SystemLogAccess = "Access"
+)
+
+// SetSystemFactoryDefault resets an ONVIF camera to its factory settings,
+// with FactoryDefaultSoft or FactoryDefaultHard
+func (device Device) SetSystemFactoryDefault(factoryDefault string) error {
+	return device.SetSystemFactoryDefaultContext(context.Background(), factoryDefault)
+}
+
+// SetSystemFactoryDefaultContext is like SetSystemFactoryDefault but sends the request with ctx.
+func (device Device) SetSystemFactoryDefaultContext(ctx context.Context, factoryDefault string) error {
+	// create SOAP
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body: `<SetSystemFactoryDefault xmlns="http://www.onvif.org/ver10/device/wsdl">
+			<FactoryDefault>` + escapeXML(factoryDefault) + `</FactoryDefault>
+		</SetSystemFactoryDefault>`,
+	}
+
+	// send request
+	_, err := device.sendRequest(ctx, soap, device.XAddr)
+	return err
+}
+
+// GetSystemLog fetch a log of an ONVIF camera, SystemLogSystem or
+// SystemLogAccess
+func (device Device) GetSystemLog(logType string) (SystemLog, error) {
+	return device.GetSystemLogContext(context.Background(), logType)
+}
+
+// GetSystemLogContext is like GetSystemLog but sends the request with ctx.
+func (device Device) GetSystemLogContext(ctx context.Context, logType string) (SystemLog, error) {
+	// create SOAP
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body: `<GetSystemLog xmlns="http://www.onvif.org/ver10/device/wsdl">
+			<LogType>` + escapeXML(logType) + `</LogType>
+		</GetSystemLog>`,
+	}
+
+	result := SystemLog{}
+
+	// send request
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
+	if err != nil {
+		return result, err
+	}
+
+	// parse response into interface
+	ifaceSystemLog, err := response.ValueForPath("Envelope.Body.GetSystemLogResponse.SystemLog")
+	if err != nil {
+		return result, err
+	}
+
+	// parse interface into struct
+	if mapSystemLog, ok := ifaceSystemLog.(map[string]interface{}); ok {
+		result.String = interfaceToString(mapSystemLog["String"])
+		if ifaceBinary, ok := mapSystemLog["Binary"]; ok {
+			result.Binary, err = attachmentData(ifaceBinary)
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// GetSystemSupportInformation fetch the information an ONVIF camera gives its
+// vendor's support
+func (device Device) GetSystemSupportInformation() (SupportInformation, error) {
+	return device.GetSystemSupportInformationContext(context.Background())
+}
+
+// GetSystemSupportInformationContext is like GetSystemSupportInformation but sends the request with ctx.
+func (device Device) GetSystemSupportInformationContext(ctx context.Context) (SupportInformation, error) {
+	// create SOAP
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body:     `<GetSystemSupportInformation xmlns="http://www.onvif.org/ver10/device/wsdl"/>`,
+	}
+
+	result := SupportInformation{}
+
+	// send request
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
+	if err != nil {
+		return result, err
+	}
+
+	// parse response into interface
+	ifaceSupportInfo, err := response.ValueForPath("Envelope.Body.GetSystemSupportInformationResponse.SupportInformation")
+	if err != nil {
+		return result, err
+	}
+
+	// parse interface into struct
+	if mapSupportInfo, ok := ifaceSupportInfo.(map[string]interface{}); ok {
+		result.String = interfaceToString(mapSupportInfo["String"])
+		if ifaceBinary, ok := mapSupportInfo["Binary"]; ok {
+			result.Binary, err = attachmentData(ifaceBinary)
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// GetSystemUris fetch where to download the logs, support information and
+// backup of an ONVIF camera, which Download fetches
+func (device Device) GetSystemUris() (SystemURIs, error) {
+	return device.GetSystemUrisContext(context.Background())
+}
+
+// GetSystemUrisContext is like GetSystemUris but sends the request with ctx.
+func (device Device) GetSystemUrisContext(ctx context.Context) (SystemURIs, error) {
+	// create SOAP
+	soap := SOAP{
+		XMLNs:    deviceXMLNs,
+		User:     device.User,
+		Password: device.Password,
+		Body:     `<GetSystemUris xmlns="http://www.onvif.org/ver10/device/wsdl"/>`,
+	}
+
+	result := SystemURIs{}
+
+	// send request
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
+	if err != nil {
+		return result, err
+	}
+
+	// parse response into interface
+	ifaceURIs, err := response.ValueForPath("Envelope.Body.GetSystemUrisResponse")
+	if err != nil {
+		return result, err
+	}
+
+	// parse interface into struct
+	if mapURIs, ok := ifaceURIs.(map[string]interface{}); ok {
+		result.SupportInfoURI = strings.TrimSpace(interfaceToString(mapURIs["SupportInfoUri"]))
+		result.SystemBackupURI = strings.TrimSpace(interfaceToString(mapURIs["SystemBackupUri"]))
+	}
+
+	ifaceSystemLogs, _ := response.ValuesForPath("Envelope.Body.GetSystemUrisResponse.SystemLogUris.SystemLog")
+	for _, ifaceSystemLog := range ifaceSystemLogs {
+		if mapSystemLog, ok := ifaceSystemLog.(map[string]interface{}); ok {
+			result.SystemLogURIs = append(result.SystemLogURIs, SystemLogURI{
+				Type: interfaceToString(mapSystemLog["Type"]),
+				URI:  strings.TrimSpace(interfaceToString(mapSystemLog["Uri"])),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// Download fetches a file the device serves over HTTP, such as a URI of
+// GetSystemUris, with the device's credentials and TLS settings.
+func (device Device) Download(ctx context.Context, uri string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	logAt(device.Logger, LogDebug, "onvif download", "uri", redact(uri))
+	resp, err := device.sendHTTP(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, &SOAPFault{StatusCode: resp.StatusCode}
+	}
+	return data, nil
+}
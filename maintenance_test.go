@@ -0,0 +1,124 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetSystemFactoryDefault(t *testing.T) {
+	var request string
+	server := newSOAPServer(t, `<tds:SetSystemFactoryDefaultResponse/>`, &request)
+
+	if err := (Device{XAddr: server.URL}).SetSystemFactoryDefault(FactoryDefaultHard); err != nil {
+		t.Fatal(err)
+	}
+	if value := requestValue(t, request, "Envelope.Body.SetSystemFactoryDefault.FactoryDefault"); value != "Hard" {
+		t.Fatalf("expected a Hard reset, got %v", value)
+	}
+}
+
+func TestGetSystemLog(t *testing.T) {
+	var request string
+	server := newSOAPServer(t, `<tds:GetSystemLogResponse><tds:SystemLog><tt:String>boot ok</tt:String></tds:SystemLog></tds:GetSystemLogResponse>`, &request)
+
+	systemLog, err := Device{XAddr: server.URL}.GetSystemLog(SystemLogAccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if systemLog.String != "boot ok" || systemLog.Binary != nil {
+		t.Fatalf("unexpected log %+v", systemLog)
+	}
+	if value := requestValue(t, request, "Envelope.Body.GetSystemLog.LogType"); value != "Access" {
+		t.Fatalf("expected the access log, got %v", value)
+	}
+}
+
+func TestGetSystemLogAttachment(t *testing.T) {
+	server := newSOAPServer(t, `<tds:GetSystemLogResponse><tds:SystemLog>`+
+		`<tt:Binary xmime:contentType="application/gzip" xmlns:xmime="http://www.w3.org/2005/05/xmlmime"><xop:Include href="cid:log"/></tt:Binary>`+
+		`</tds:SystemLog></tds:GetSystemLogResponse>`, nil, withAttachments(map[string][]byte{"log": []byte("\x1f\x8bgzip")}))
+
+	systemLog, err := Device{XAddr: server.URL}.GetSystemLog(SystemLogSystem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(systemLog.Binary) != "\x1f\x8bgzip" {
+		t.Fatalf("unexpected log %+v", systemLog)
+	}
+}
+
+func TestGetSystemSupportInformation(t *testing.T) {
+	server := newSOAPServer(t, `<tds:GetSystemSupportInformationResponse><tds:SupportInformation>`+
+		`<tt:Binary><xop:Include href="cid:support"/></tt:Binary>`+
+		`</tds:SupportInformation></tds:GetSystemSupportInformationResponse>`, nil, withAttachments(map[string][]byte{"support": []byte("dump")}))
+
+	supportInfo, err := Device{XAddr: server.URL}.GetSystemSupportInformation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(supportInfo.Binary) != "dump" {
+		t.Fatalf("unexpected support information %+v", supportInfo)
+	}
+}
+
+func TestGetSystemUrisAndDownload(t *testing.T) {
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "Digest ") || !strings.Contains(authorization, `username="admin"`) {
+			w.Header().Set("WWW-Authenticate", `Digest realm="camera", nonce="abc", qop="auth"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("contents of " + r.URL.Path))
+	}))
+	defer files.Close()
+
+	soapServer := newSOAPServer(t, `<tds:GetSystemUrisResponse>
+		<tds:SystemLogUris>
+			<tt:SystemLog><tt:Type>System</tt:Type><tt:Uri>`+files.URL+`/system.log</tt:Uri></tt:SystemLog>
+			<tt:SystemLog><tt:Type>Access</tt:Type><tt:Uri>`+files.URL+`/access.log</tt:Uri></tt:SystemLog>
+		</tds:SystemLogUris>
+		<tds:SupportInfoUri>`+files.URL+`/support</tds:SupportInfoUri>
+		<tds:SystemBackupUri>`+files.URL+`/backup</tds:SystemBackupUri>
+	</tds:GetSystemUrisResponse>`, nil)
+
+	device := Device{XAddr: soapServer.URL, User: "admin", Password: "secret", AuthMode: AuthWSUsernameTokenDigest}
+	uris, err := device.GetSystemUris()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := SystemURIs{
+		SystemLogURIs: []SystemLogURI{
+			{Type: "System", URI: files.URL + "/system.log"},
+			{Type: "Access", URI: files.URL + "/access.log"},
+		},
+		SupportInfoURI:  files.URL + "/support",
+		SystemBackupURI: files.URL + "/backup",
+	}
+	if !reflect.DeepEqual(uris, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, uris)
+	}
+
+	data, err := device.Download(context.Background(), uris.SystemBackupURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "contents of /backup" {
+		t.Fatalf("unexpected download %q", data)
+	}
+
+	if _, err := (Device{XAddr: soapServer.URL}).Download(context.Background(), uris.SupportInfoURI); !isStatus(err, http.StatusUnauthorized) {
+		t.Fatalf("expected a 401 without credentials, got %v", err)
+	}
+}
+
+// isStatus reports whether err is an HTTP error with the status code.
+func isStatus(err error, statusCode int) bool {
+	var fault *SOAPFault
+	return errors.As(err, &fault) && fault.StatusCode == statusCode
+}
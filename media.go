@@ -1,8 +1,7 @@
 package onvif
 
 import (
-	"fmt"
-	"github.com/golang/glog"
+	"context"
 )
 
 var mediaXMLNs = []string{
@@ -12,6 +11,11 @@ var mediaXMLNs = []string{
 
 // GetProfiles fetch available media profiles of ONVIF camera
 func (device Device) GetProfiles() ([]MediaProfile, error) {
+	return device.GetProfilesContext(context.Background())
+}
+
+// GetProfilesContext is like GetProfiles but sends the request with ctx.
+func (device Device) GetProfilesContext(ctx context.Context) ([]MediaProfile, error) {
 	// Create SOAP
 	soap := SOAP{
 		Body:     "<trt:GetProfiles/>",
@@ -21,7 +25,7 @@ func (device Device) GetProfiles() ([]MediaProfile, error) {
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return []MediaProfile{}, err
 	}
@@ -131,22 +135,27 @@ func (device Device) GetProfiles() ([]MediaProfile, error) {
 // GetStreamURI fetch stream URI of a media profile.
 // Possible protocol is UDP, HTTP or RTSP
 func (device Device) GetStreamURI(profileToken, protocol string) (MediaURI, error) {
+	return device.GetStreamURIContext(context.Background(), profileToken, protocol)
+}
+
+// GetStreamURIContext is like GetStreamURI but sends the request with ctx.
+func (device Device) GetStreamURIContext(ctx context.Context, profileToken, protocol string) (MediaURI, error) {
 	// Create SOAP
 	soap := SOAP{
 		XMLNs: mediaXMLNs,
 		Body: `<trt:GetStreamUri>
 			<trt:StreamSetup>
 				<tt:Stream>RTP-Unicast</tt:Stream>
-				<tt:Transport><tt:Protocol>` + protocol + `</tt:Protocol></tt:Transport>
+				<tt:Transport><tt:Protocol>` + escapeXML(protocol) + `</tt:Protocol></tt:Transport>
 			</trt:StreamSetup>
-			<trt:ProfileToken>` + profileToken + `</trt:ProfileToken>
+			<trt:ProfileToken>` + escapeXML(profileToken) + `</trt:ProfileToken>
 		</trt:GetStreamUri>`,
 		User:     device.User,
 		Password: device.Password,
 	}
 
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return MediaURI{}, err
 	}
@@ -171,15 +180,20 @@ func (device Device) GetStreamURI(profileToken, protocol string) (MediaURI, erro
 
 // GetSnapshot fetch snapshot URI of a media profile.
 func (device Device) GetSnapshot(profileToken string) (string, error) {
+	return device.GetSnapshotContext(context.Background(), profileToken)
+}
+
+// GetSnapshotContext is like GetSnapshot but sends the request with ctx.
+func (device Device) GetSnapshotContext(ctx context.Context, profileToken string) (string, error) {
 	soap := SOAP{
 		XMLNs:    mediaXMLNs,
 		User:     device.User,
 		Password: device.Password,
 		Body: `<trt:GetSnapshotUri>
-				<trt:ProfileToken>` + profileToken + `</trt:ProfileToken>
+				<trt:ProfileToken>` + escapeXML(profileToken) + `</trt:ProfileToken>
 			 </trt:GetSnapshotUri>`,
 	}
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return "", err
 	}
@@ -196,13 +210,18 @@ func (device Device) GetSnapshot(profileToken string) (string, error) {
 }
 
 func (device Device) GetVideoEncoderConfigurations() ([]VideoEncoderConfig, error) {
+	return device.GetVideoEncoderConfigurationsContext(context.Background())
+}
+
+// GetVideoEncoderConfigurationsContext is like GetVideoEncoderConfigurations but sends the request with ctx.
+func (device Device) GetVideoEncoderConfigurationsContext(ctx context.Context) ([]VideoEncoderConfig, error) {
 	soap := SOAP{
 		Body:     `<GetVideoEncoderConfigurations xmlns="http://www.onvif.org/ver10/media/wsdl"/>`,
 		User:     device.User,
 		Password: device.Password,
 	}
 	result := []VideoEncoderConfig{}
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -270,20 +289,25 @@ func (device Device) GetVideoEncoderConfigurations() ([]VideoEncoderConfig, erro
 		}
 	}
 
-	glog.Info(result)
+	logAt(device.Logger, LogDebug, "parsed response", "xaddr", redact(device.XAddr), "operation", "GetVideoEncoderConfigurations", "result", result)
 	return result, nil
 }
 
 func (device Device) SetVideoEncoderConfiguration(videoEncoderConfig VideoEncoderConfig) error {
+	return device.SetVideoEncoderConfigurationContext(context.Background(), videoEncoderConfig)
+}
+
+// SetVideoEncoderConfigurationContext is like SetVideoEncoderConfiguration but sends the request with ctx.
+func (device Device) SetVideoEncoderConfigurationContext(ctx context.Context, videoEncoderConfig VideoEncoderConfig) error {
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Action:   "http://www.onvif.org/ver10/media/wsdl/SetVideoEncoderConfiguration",
 		Body: `<SetVideoEncoderConfiguration xmlns="http://www.onvif.org/ver10/media/wsdl">
-					<Configuration token="` + videoEncoderConfig.Token + `">
-						<Name xmlns="http://www.onvif.org/ver10/schema">` + videoEncoderConfig.Name + `</Name>
+					<Configuration token="` + escapeXML(videoEncoderConfig.Token) + `">
+						<Name xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(videoEncoderConfig.Name) + `</Name>
 						<UseCount xmlns="http://www.onvif.org/ver10/schema">` + intToString(videoEncoderConfig.UseCount) + `</UseCount>
-						<Encoding xmlns="http://www.onvif.org/ver10/schema">` + videoEncoderConfig.Encoding + `</Encoding>
+						<Encoding xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(videoEncoderConfig.Encoding) + `</Encoding>
 						<Resolution xmlns="http://www.onvif.org/ver10/schema">
 							<Width>` + intToString(videoEncoderConfig.Resolution.Width) + `</Width>
 							<Height>` + intToString(videoEncoderConfig.Resolution.Height) + `</Height>
@@ -296,24 +320,24 @@ func (device Device) SetVideoEncoderConfiguration(videoEncoderConfig VideoEncode
 						</RateControl>
 						<H264 xmlns="http://www.onvif.org/ver10/schema">
 							<GovLength>` + intToString(videoEncoderConfig.H264.GovLength) + `</GovLength>
-							<H264Profile>` + videoEncoderConfig.H264.H264Profile + `</H264Profile>
+							<H264Profile>` + escapeXML(videoEncoderConfig.H264.H264Profile) + `</H264Profile>
 						</H264>
 						<Multicast xmlns="http://www.onvif.org/ver10/schema">
 							<Address>
-								<Type>` + videoEncoderConfig.Multicast.Address.Type + `</Type>
-								<IPv4Address>` + videoEncoderConfig.Multicast.Address.IPv4Address + `</IPv4Address>
+								<Type>` + escapeXML(videoEncoderConfig.Multicast.Address.Type) + `</Type>
+								<IPv4Address>` + escapeXML(videoEncoderConfig.Multicast.Address.IPv4Address) + `</IPv4Address>
 							</Address>
 							<Port>` + intToString(videoEncoderConfig.Multicast.Port) + `</Port>
 							<TTL>` + intToString(videoEncoderConfig.Multicast.TTL) + `</TTL>
 							<AutoStart>` + boolToString(videoEncoderConfig.Multicast.AutoStart) + `</AutoStart>
 						</Multicast>
-						<SessionTimeout xmlns="http://www.onvif.org/ver10/schema">` + videoEncoderConfig.SessionTimeout + `</SessionTimeout>
+						<SessionTimeout xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(videoEncoderConfig.SessionTimeout) + `</SessionTimeout>
 					</Configuration>
 					<ForcePersistence>true</ForcePersistence>
 				</SetVideoEncoderConfiguration>`,
 	}
 
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -325,24 +349,29 @@ func (device Device) SetVideoEncoderConfiguration(videoEncoderConfig VideoEncode
 }
 
 func (device Device) SetVideoSourceConfiguration(videoSourceConfig VideoSourceConfiguration) error {
+	return device.SetVideoSourceConfigurationContext(context.Background(), videoSourceConfig)
+}
+
+// SetVideoSourceConfigurationContext is like SetVideoSourceConfiguration but sends the request with ctx.
+func (device Device) SetVideoSourceConfigurationContext(ctx context.Context, videoSourceConfig VideoSourceConfiguration) error {
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Action:   "http://www.onvif.org/ver10/media/wsdl/SetVideoEncoderConfiguration",
 		Body: `<SetVideoSourceConfiguration xmlns="http://www.onvif.org/ver10/media/wsdl">
-					<Configuration token="` + videoSourceConfig.Token + `">
-						<Name xmlns="http://www.onvif.org/ver10/schema">` + videoSourceConfig.Name + `</Name>
+					<Configuration token="` + escapeXML(videoSourceConfig.Token) + `">
+						<Name xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(videoSourceConfig.Name) + `</Name>
 						<Bounds xmlns="http://www.onvif.org/ver10/schema" 
 								x="` + intToString(videoSourceConfig.Bounds.X) + `" 
 								y="` + intToString(videoSourceConfig.Bounds.Y) + `"
 								width="` + intToString(videoSourceConfig.Bounds.Width) + `"
 								height="` + intToString(videoSourceConfig.Bounds.Height) + `"/>
-						<SourceToken xmlns="http://www.onvif.org/ver10/schema">` + videoSourceConfig.SourceToken + `</SourceToken>
+						<SourceToken xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(videoSourceConfig.SourceToken) + `</SourceToken>
 					</Configuration>
 				</SetVideoSourceConfiguration>`,
 	}
 
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -354,14 +383,19 @@ func (device Device) SetVideoSourceConfiguration(videoSourceConfig VideoSourceCo
 }
 
 func (device Device) GetCompatibleVideoEncoderConfigurations(profileToken string) ([]VideoEncoderConfig, error) {
+	return device.GetCompatibleVideoEncoderConfigurationsContext(context.Background(), profileToken)
+}
+
+// GetCompatibleVideoEncoderConfigurationsContext is like GetCompatibleVideoEncoderConfigurations but sends the request with ctx.
+func (device Device) GetCompatibleVideoEncoderConfigurationsContext(ctx context.Context, profileToken string) ([]VideoEncoderConfig, error) {
 	soap := SOAP{
 		Body: `<GetCompatibleVideoEncoderConfigurations xmlns="http://www.onvif.org/ver10/media/wsdl">
-					<ProfileToken xmlns="http://www.onvif.org/ver10/schema">` + profileToken + `</ProfileToken></GetCompatibleVideoEncoderConfigurations>`,
+					<ProfileToken xmlns="http://www.onvif.org/ver10/schema">` + escapeXML(profileToken) + `</ProfileToken></GetCompatibleVideoEncoderConfigurations>`,
 		User:     device.User,
 		Password: device.Password,
 	}
 	result := []VideoEncoderConfig{}
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -411,12 +445,17 @@ func (device Device) GetCompatibleVideoEncoderConfigurations(profileToken string
 
 // truyen vao mot trong 2 tham so
 func (device Device) GetVideoEncoderConfigurationOptions(configurationToken string, profileToken string) (VideoEncoderConfigurationOptions, error) {
+	return device.GetVideoEncoderConfigurationOptionsContext(context.Background(), configurationToken, profileToken)
+}
+
+// GetVideoEncoderConfigurationOptionsContext is like GetVideoEncoderConfigurationOptions but sends the request with ctx.
+func (device Device) GetVideoEncoderConfigurationOptionsContext(ctx context.Context, configurationToken string, profileToken string) (VideoEncoderConfigurationOptions, error) {
 	// create token body
 	tokenBody := ``
 	if configurationToken != "" {
-		tokenBody = `<ConfigurationToken>` + configurationToken + `</ConfigurationToken>`
+		tokenBody = `<ConfigurationToken>` + escapeXML(configurationToken) + `</ConfigurationToken>`
 	} else {
-		tokenBody = `<ProfileToken>` + profileToken + `</ProfileToken>`
+		tokenBody = `<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>`
 	}
 
 	// create soap
@@ -429,7 +468,7 @@ func (device Device) GetVideoEncoderConfigurationOptions(configurationToken stri
 	result := VideoEncoderConfigurationOptions{}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -511,19 +550,24 @@ func (device Device) GetVideoEncoderConfigurationOptions(configurationToken stri
 }
 
 func (device Device) GetGuaranteedNumberOfVideoEncoderInstances(configurationToken string) (GuaranteedNumberOfVideoEncoderInstances, error) {
+	return device.GetGuaranteedNumberOfVideoEncoderInstancesContext(context.Background(), configurationToken)
+}
+
+// GetGuaranteedNumberOfVideoEncoderInstancesContext is like GetGuaranteedNumberOfVideoEncoderInstances but sends the request with ctx.
+func (device Device) GetGuaranteedNumberOfVideoEncoderInstancesContext(ctx context.Context, configurationToken string) (GuaranteedNumberOfVideoEncoderInstances, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetGuaranteedNumberOfVideoEncoderInstances xmlns="http://www.onvif.org/ver10/media/wsdl">
-					<ConfigurationToken>` + configurationToken + `</ConfigurationToken>
+					<ConfigurationToken>` + escapeXML(configurationToken) + `</ConfigurationToken>
 				</GetGuaranteedNumberOfVideoEncoderInstances>`,
 	}
 
 	result := GuaranteedNumberOfVideoEncoderInstances{}
 
 	//send reuest
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -544,10 +588,15 @@ func (device Device) GetGuaranteedNumberOfVideoEncoderInstances(configurationTok
 }
 
 func (device Device) GetProfileMedia(profileToken string) (MediaProfile, error) {
+	return device.GetProfileMediaContext(context.Background(), profileToken)
+}
+
+// GetProfileMediaContext is like GetProfileMedia but sends the request with ctx.
+func (device Device) GetProfileMediaContext(ctx context.Context, profileToken string) (MediaProfile, error) {
 	// Create SOAP
 	soap := SOAP{
 		Body: `<GetProfile xmlns="http://www.onvif.org/ver10/media/wsdl">
-						<ProfileToken>` + profileToken + `</ProfileToken>
+						<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
 					</GetProfile>`,
 		User:     device.User,
 		Password: device.Password,
@@ -555,7 +604,7 @@ func (device Device) GetProfileMedia(profileToken string) (MediaProfile, error)
 
 	result := MediaProfile{}
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -655,19 +704,24 @@ func (device Device) GetProfileMedia(profileToken string) (MediaProfile, error)
 }
 
 func (device Device) CreateProfile(profileName string, profileToken string) (MediaProfile, error) {
+	return device.CreateProfileContext(context.Background(), profileName, profileToken)
+}
+
+// CreateProfileContext is like CreateProfile but sends the request with ctx.
+func (device Device) CreateProfileContext(ctx context.Context, profileName string, profileToken string) (MediaProfile, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<CreateProfile xmlns="http://www.onvif.org/ver10/media/wsdl">
-					<Name>` + profileName + `</Name>
-					<Token>` + profileToken + `</Token>
+					<Name>` + escapeXML(profileName) + `</Name>
+					<Token>` + escapeXML(profileToken) + `</Token>
 				</CreateProfile>`,
 	}
 
 	result := MediaProfile{}
 	// Send SOAP request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -765,17 +819,22 @@ func (device Device) CreateProfile(profileName string, profileToken string) (Med
 }
 
 func (device Device) DeleteProfile(profileToken string) error {
+	return device.DeleteProfileContext(context.Background(), profileToken)
+}
+
+// DeleteProfileContext is like DeleteProfile but sends the request with ctx.
+func (device Device) DeleteProfileContext(ctx context.Context, profileToken string) error {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<DeleteProfile xmlns="http://www.onvif.org/ver10/media/wsdl">
-					<ProfileToken>` + profileToken + `</ProfileToken>
+					<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
 				</DeleteProfile>`,
 	}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -789,6 +848,11 @@ func (device Device) DeleteProfile(profileToken string) error {
 }
 
 func (device Device) GetVideoSources() ([]VideoSource, error) {
+	return device.GetVideoSourcesContext(context.Background())
+}
+
+// GetVideoSourcesContext is like GetVideoSources but sends the request with ctx.
+func (device Device) GetVideoSourcesContext(ctx context.Context) ([]VideoSource, error) {
 	//create soap
 	soap := SOAP{
 		User:     device.User,
@@ -799,7 +863,7 @@ func (device Device) GetVideoSources() ([]VideoSource, error) {
 	result := []VideoSource{}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -909,19 +973,24 @@ func (device Device) GetVideoSources() ([]VideoSource, error) {
 }
 
 func (device Device) GetVideoSourceConfiguration(configurationToken string) (VideoSourceConfiguration, error) {
+	return device.GetVideoSourceConfigurationContext(context.Background(), configurationToken)
+}
+
+// GetVideoSourceConfigurationContext is like GetVideoSourceConfiguration but sends the request with ctx.
+func (device Device) GetVideoSourceConfigurationContext(ctx context.Context, configurationToken string) (VideoSourceConfiguration, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetVideoSourceConfiguration xmlns="http://www.onvif.org/ver10/media/wsdl">
-					<ConfigurationToken>` + configurationToken + `</ConfigurationToken>
+					<ConfigurationToken>` + escapeXML(configurationToken) + `</ConfigurationToken>
 				</GetVideoSourceConfiguration>`,
 	}
 
 	result := VideoSourceConfiguration{}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -954,6 +1023,11 @@ func (device Device) GetVideoSourceConfiguration(configurationToken string) (Vid
 }
 
 func (device Device) GetVideoSourceConfigurations() ([]VideoSourceConfiguration, error) {
+	return device.GetVideoSourceConfigurationsContext(context.Background())
+}
+
+// GetVideoSourceConfigurationsContext is like GetVideoSourceConfigurations but sends the request with ctx.
+func (device Device) GetVideoSourceConfigurationsContext(ctx context.Context) ([]VideoSourceConfiguration, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -964,7 +1038,7 @@ func (device Device) GetVideoSourceConfigurations() ([]VideoSourceConfiguration,
 	result := []VideoSourceConfiguration{}
 
 	// send soap request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1004,18 +1078,23 @@ func (device Device) GetVideoSourceConfigurations() ([]VideoSourceConfiguration,
 }
 
 func (device Device) GetCompatibleVideoSourceConfigurations(profileToken string) ([]VideoSourceConfiguration, error) {
+	return device.GetCompatibleVideoSourceConfigurationsContext(context.Background(), profileToken)
+}
+
+// GetCompatibleVideoSourceConfigurationsContext is like GetCompatibleVideoSourceConfigurations but sends the request with ctx.
+func (device Device) GetCompatibleVideoSourceConfigurationsContext(ctx context.Context, profileToken string) ([]VideoSourceConfiguration, error) {
 	//create soap request
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetCompatibleVideoSourceConfigurations xmlns="http://www.onvif.org/ver10/media/wsdl">
-					<ProfileToken>` + profileToken + `</ProfileToken>
+					<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
 				</GetCompatibleVideoSourceConfigurations>`,
 	}
 	result := []VideoSourceConfiguration{}
 
 	// send soap request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1056,12 +1135,17 @@ func (device Device) GetCompatibleVideoSourceConfigurations(profileToken string)
 
 // truyen vao mot trong 2 tham so
 func (device Device) GetVideoSourceConfigurationOptions(configurationToken string, profileToken string) (VideoSourceConfigurationOption, error) {
+	return device.GetVideoSourceConfigurationOptionsContext(context.Background(), configurationToken, profileToken)
+}
+
+// GetVideoSourceConfigurationOptionsContext is like GetVideoSourceConfigurationOptions but sends the request with ctx.
+func (device Device) GetVideoSourceConfigurationOptionsContext(ctx context.Context, configurationToken string, profileToken string) (VideoSourceConfigurationOption, error) {
 	// create token body
 	tokenBody := ``
 	if configurationToken != "" {
-		tokenBody = `<ConfigurationToken>` + configurationToken + `</ConfigurationToken>`
+		tokenBody = `<ConfigurationToken>` + escapeXML(configurationToken) + `</ConfigurationToken>`
 	} else {
-		tokenBody = `<ProfileToken>` + profileToken + `</ProfileToken>`
+		tokenBody = `<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>`
 	}
 
 	//create soap
@@ -1073,7 +1157,7 @@ func (device Device) GetVideoSourceConfigurationOptions(configurationToken strin
 
 	result := VideoSourceConfigurationOption{}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1119,18 +1203,23 @@ func (device Device) GetVideoSourceConfigurationOptions(configurationToken strin
 }
 
 func (device Device) GetMetadataConfiguration(configurationToken string) (MetadataConfiguration, error) {
+	return device.GetMetadataConfigurationContext(context.Background(), configurationToken)
+}
+
+// GetMetadataConfigurationContext is like GetMetadataConfiguration but sends the request with ctx.
+func (device Device) GetMetadataConfigurationContext(ctx context.Context, configurationToken string) (MetadataConfiguration, error) {
 	//send soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetMetadataConfiguration xmlns="http://www.onvif.org/ver10/media/wsdl">
-					<ConfigurationToken>` + configurationToken + `</ConfigurationToken>
+					<ConfigurationToken>` + escapeXML(configurationToken) + `</ConfigurationToken>
 				</GetMetadataConfiguration>`,
 	}
 
 	result := MetadataConfiguration{}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1167,6 +1256,11 @@ func (device Device) GetMetadataConfiguration(configurationToken string) (Metada
 }
 
 func (device Device) GetMetadataConfigurations() ([]MetadataConfiguration, error) {
+	return device.GetMetadataConfigurationsContext(context.Background())
+}
+
+// GetMetadataConfigurationsContext is like GetMetadataConfigurations but sends the request with ctx.
+func (device Device) GetMetadataConfigurationsContext(ctx context.Context) ([]MetadataConfiguration, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -1177,7 +1271,7 @@ func (device Device) GetMetadataConfigurations() ([]MetadataConfiguration, error
 	result := []MetadataConfiguration{}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1221,19 +1315,24 @@ func (device Device) GetMetadataConfigurations() ([]MetadataConfiguration, error
 }
 
 func (device Device) GetCompatibleMetadataConfigurations(profileToken string) ([]MetadataConfiguration, error) {
+	return device.GetCompatibleMetadataConfigurationsContext(context.Background(), profileToken)
+}
+
+// GetCompatibleMetadataConfigurationsContext is like GetCompatibleMetadataConfigurations but sends the request with ctx.
+func (device Device) GetCompatibleMetadataConfigurationsContext(ctx context.Context, profileToken string) ([]MetadataConfiguration, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetCompatibleMetadataConfigurations xmlns="http://www.onvif.org/ver10/media/wsdl">
-					<ProfileToken>` + profileToken + `</ProfileToken>
+					<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
 				</GetCompatibleMetadataConfigurations>`,
 	}
 
 	result := []MetadataConfiguration{}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1278,12 +1377,17 @@ func (device Device) GetCompatibleMetadataConfigurations(profileToken string) ([
 
 // truyen vao mot trong 2 tham so
 func (device Device) GetMetadataConfigurationOptions(configurationToken string, profileToken string) (MetadataConfigurationOptions, error) {
+	return device.GetMetadataConfigurationOptionsContext(context.Background(), configurationToken, profileToken)
+}
+
+// GetMetadataConfigurationOptionsContext is like GetMetadataConfigurationOptions but sends the request with ctx.
+func (device Device) GetMetadataConfigurationOptionsContext(ctx context.Context, configurationToken string, profileToken string) (MetadataConfigurationOptions, error) {
 	// create token body
 	tokenBody := ``
 	if configurationToken != "" {
-		tokenBody = `<ConfigurationToken>` + configurationToken + `</ConfigurationToken>`
+		tokenBody = `<ConfigurationToken>` + escapeXML(configurationToken) + `</ConfigurationToken>`
 	} else {
-		tokenBody = `<ProfileToken>` + profileToken + `</ProfileToken>`
+		tokenBody = `<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>`
 	}
 
 	// create soap request
@@ -1294,7 +1398,7 @@ func (device Device) GetMetadataConfigurationOptions(configurationToken string,
 	}
 	result := MetadataConfigurationOptions{}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1323,6 +1427,11 @@ func (device Device) GetMetadataConfigurationOptions(configurationToken string,
 }
 
 func (device Device) GetAudioSources() ([]AudioSource, error) {
+	return device.GetAudioSourcesContext(context.Background())
+}
+
+// GetAudioSourcesContext is like GetAudioSources but sends the request with ctx.
+func (device Device) GetAudioSourcesContext(ctx context.Context) ([]AudioSource, error) {
 	// create soap request
 	soap := SOAP{
 		User:     device.User,
@@ -1333,7 +1442,7 @@ func (device Device) GetAudioSources() ([]AudioSource, error) {
 	result := []AudioSource{}
 
 	//send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1361,19 +1470,24 @@ func (device Device) GetAudioSources() ([]AudioSource, error) {
 }
 
 func (device Device) GetAudioSourceConfiguration(configurationToken string) (AudioSourceConfiguration, error) {
+	return device.GetAudioSourceConfigurationContext(context.Background(), configurationToken)
+}
+
+// GetAudioSourceConfigurationContext is like GetAudioSourceConfiguration but sends the request with ctx.
+func (device Device) GetAudioSourceConfigurationContext(ctx context.Context, configurationToken string) (AudioSourceConfiguration, error) {
 	// create soap request
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetAudioSourceConfiguration xmlns="http://www.onvif.org/ver10/media/wsdl">
-					<ConfigurationToken>` + configurationToken + `</ConfigurationToken>
+					<ConfigurationToken>` + escapeXML(configurationToken) + `</ConfigurationToken>
 				</GetAudioSourceConfiguration>`,
 	}
 
 	result := AudioSourceConfiguration{}
 
 	//send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1395,6 +1509,11 @@ func (device Device) GetAudioSourceConfiguration(configurationToken string) (Aud
 }
 
 func (device Device) GetAudioSourceConfigurations() ([]AudioSourceConfiguration, error) {
+	return device.GetAudioSourceConfigurationsContext(context.Background())
+}
+
+// GetAudioSourceConfigurationsContext is like GetAudioSourceConfigurations but sends the request with ctx.
+func (device Device) GetAudioSourceConfigurationsContext(ctx context.Context) ([]AudioSourceConfiguration, error) {
 	// create soap request
 	soap := SOAP{
 		User:     device.User,
@@ -1405,7 +1524,7 @@ func (device Device) GetAudioSourceConfigurations() ([]AudioSourceConfiguration,
 	result := []AudioSourceConfiguration{}
 
 	//send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1430,24 +1549,29 @@ func (device Device) GetAudioSourceConfigurations() ([]AudioSourceConfiguration,
 		}
 	}
 
-	glog.Info(result)
+	logAt(device.Logger, LogDebug, "parsed response", "xaddr", redact(device.XAddr), "operation", "GetAudioSourceConfigurations", "result", result)
 	return result, nil
 }
 
 func (device Device) GetCompatibleAudioSourceConfigurations(profileToken string) ([]AudioSourceConfiguration, error) {
+	return device.GetCompatibleAudioSourceConfigurationsContext(context.Background(), profileToken)
+}
+
+// GetCompatibleAudioSourceConfigurationsContext is like GetCompatibleAudioSourceConfigurations but sends the request with ctx.
+func (device Device) GetCompatibleAudioSourceConfigurationsContext(ctx context.Context, profileToken string) ([]AudioSourceConfiguration, error) {
 	// create soap request
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetCompatibleAudioSourceConfigurations xmlns="http://www.onvif.org/ver10/media/wsdl">
-					<ProfileToken>` + profileToken + `</ProfileToken>
+					<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
 				</GetCompatibleAudioSourceConfigurations>`,
 	}
 
 	result := []AudioSourceConfiguration{}
 
 	//send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1478,12 +1602,17 @@ func (device Device) GetCompatibleAudioSourceConfigurations(profileToken string)
 // fetch input tokens available
 // truyen vao mot trong 2 tham so
 func (device Device) GetAudioSourceConfigurationOptions(configurationToken string, profileToken string) (string, error) {
+	return device.GetAudioSourceConfigurationOptionsContext(context.Background(), configurationToken, profileToken)
+}
+
+// GetAudioSourceConfigurationOptionsContext is like GetAudioSourceConfigurationOptions but sends the request with ctx.
+func (device Device) GetAudioSourceConfigurationOptionsContext(ctx context.Context, configurationToken string, profileToken string) (string, error) {
 	// create token body
 	tokenBody := ``
 	if configurationToken != "" {
-		tokenBody = `<ConfigurationToken>` + configurationToken + `</ConfigurationToken>`
+		tokenBody = `<ConfigurationToken>` + escapeXML(configurationToken) + `</ConfigurationToken>`
 	} else {
-		tokenBody = `<ProfileToken>` + profileToken + `</ProfileToken>`
+		tokenBody = `<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>`
 	}
 
 	// create soap request
@@ -1495,7 +1624,7 @@ func (device Device) GetAudioSourceConfigurationOptions(configurationToken strin
 
 	var result string
 	//send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1511,23 +1640,28 @@ func (device Device) GetAudioSourceConfigurationOptions(configurationToken strin
 		result = interfaceToString(mapAudioSourceConfigurationOption["InputTokensAvailable"])
 	}
 
-	glog.Info(result)
+	logAt(device.Logger, LogDebug, "parsed response", "xaddr", redact(device.XAddr), "operation", "GetAudioSourceConfigurationOptions", "result", result)
 	return result, nil
 }
 
 func (device Device) GetAudioEncoderConfiguration(configurationToken string) (AudioEncoderConfig, error) {
+	return device.GetAudioEncoderConfigurationContext(context.Background(), configurationToken)
+}
+
+// GetAudioEncoderConfigurationContext is like GetAudioEncoderConfiguration but sends the request with ctx.
+func (device Device) GetAudioEncoderConfigurationContext(ctx context.Context, configurationToken string) (AudioEncoderConfig, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetAudioEncoderConfiguration xmlns="http://www.onvif.org/ver10/media/wsdl">
-					<ConfigurationToken>` + configurationToken + `</ConfigurationToken>
+					<ConfigurationToken>` + escapeXML(configurationToken) + `</ConfigurationToken>
 				</GetAudioEncoderConfiguration>`,
 	}
 
 	result := AudioEncoderConfig{}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1552,6 +1686,11 @@ func (device Device) GetAudioEncoderConfiguration(configurationToken string) (Au
 }
 
 func (device Device) GetAudioEncoderConfigurations() ([]AudioEncoderConfig, error) {
+	return device.GetAudioEncoderConfigurationsContext(context.Background())
+}
+
+// GetAudioEncoderConfigurationsContext is like GetAudioEncoderConfigurations but sends the request with ctx.
+func (device Device) GetAudioEncoderConfigurationsContext(ctx context.Context) ([]AudioEncoderConfig, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -1561,7 +1700,7 @@ func (device Device) GetAudioEncoderConfigurations() ([]AudioEncoderConfig, erro
 
 	result := []AudioEncoderConfig{}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1593,18 +1732,23 @@ func (device Device) GetAudioEncoderConfigurations() ([]AudioEncoderConfig, erro
 }
 
 func (device Device) GetCompatibleAudioEncoderConfigurations(profileToken string) ([]AudioEncoderConfig, error) {
+	return device.GetCompatibleAudioEncoderConfigurationsContext(context.Background(), profileToken)
+}
+
+// GetCompatibleAudioEncoderConfigurationsContext is like GetCompatibleAudioEncoderConfigurations but sends the request with ctx.
+func (device Device) GetCompatibleAudioEncoderConfigurationsContext(ctx context.Context, profileToken string) ([]AudioEncoderConfig, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetCompatibleAudioEncoderConfigurations xmlns="http://www.onvif.org/ver10/media/wsdl">
-					<ProfileToken>` + profileToken + `</ProfileToken>
+					<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
 				</GetCompatibleAudioEncoderConfigurations>`,
 	}
 
 	result := []AudioEncoderConfig{}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1636,12 +1780,17 @@ func (device Device) GetCompatibleAudioEncoderConfigurations(profileToken string
 
 // truyen vao mot trong 2 tham so
 func (device Device) GetAudioEncoderConfigurationOptions(configurationToken string, profileToken string) ([]AudioEncoderConfigurationOption, error) {
+	return device.GetAudioEncoderConfigurationOptionsContext(context.Background(), configurationToken, profileToken)
+}
+
+// GetAudioEncoderConfigurationOptionsContext is like GetAudioEncoderConfigurationOptions but sends the request with ctx.
+func (device Device) GetAudioEncoderConfigurationOptionsContext(ctx context.Context, configurationToken string, profileToken string) ([]AudioEncoderConfigurationOption, error) {
 	// create token body
 	tokenBody := ``
 	if configurationToken != "" {
-		tokenBody = `<ConfigurationToken>` + configurationToken + `</ConfigurationToken>`
+		tokenBody = `<ConfigurationToken>` + escapeXML(configurationToken) + `</ConfigurationToken>`
 	} else {
-		tokenBody = `<ProfileToken>` + profileToken + `</ProfileToken>`
+		tokenBody = `<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>`
 	}
 
 	// create soap
@@ -1654,7 +1803,7 @@ func (device Device) GetAudioEncoderConfigurationOptions(configurationToken stri
 	result := []AudioEncoderConfigurationOption{}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1678,11 +1827,16 @@ func (device Device) GetAudioEncoderConfigurationOptions(configurationToken stri
 		}
 	}
 
-	glog.Info(result)
+	logAt(device.Logger, LogDebug, "parsed response", "xaddr", redact(device.XAddr), "operation", "GetAudioEncoderConfigurationOptions", "result", result)
 	return result, nil
 }
 
 func (device Device) GetMasks(configurationToken string) ([]Mask, error) {
+	return device.GetMasksContext(context.Background(), configurationToken)
+}
+
+// GetMasksContext is like GetMasks but sends the request with ctx.
+func (device Device) GetMasksContext(ctx context.Context, configurationToken string) ([]Mask, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -1691,14 +1845,14 @@ func (device Device) GetMasks(configurationToken string) ([]Mask, error) {
 			`xmlns:tr2="http://www.onvif.org/ver20/media/wsdl"`,
 		},
 		Body: `<GetMasks xmlns="http://www.onvif.org/ver20/media/wsdl">
-						<ConfigurationToken>` + configurationToken + `</ConfigurationToken>
+						<ConfigurationToken>` + escapeXML(configurationToken) + `</ConfigurationToken>
 					</GetMasks>`,
 	}
 
 	result := make([]Mask, 0)
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1740,6 +1894,11 @@ func (device Device) GetMasks(configurationToken string) ([]Mask, error) {
 }
 
 func (device Device) CreateMask(configurationToken string, pointStart, pointEnd Point) (string, error) {
+	return device.CreateMaskContext(context.Background(), configurationToken, pointStart, pointEnd)
+}
+
+// CreateMaskContext is like CreateMask but sends the request with ctx.
+func (device Device) CreateMaskContext(ctx context.Context, configurationToken string, pointStart, pointEnd Point) (string, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -1751,7 +1910,7 @@ func (device Device) CreateMask(configurationToken string, pointStart, pointEnd
 		Action: "http://www.onvif.org/ver20/media/wsdl/CreateMask",
 		Body: `<tr2:CreateMask xmlns="http://www.onvif.org/ver20/media/wsdl">
 						<tr2:Mask>
-							<tr2:ConfigurationToken>` + configurationToken + `</tr2:ConfigurationToken>
+							<tr2:ConfigurationToken>` + escapeXML(configurationToken) + `</tr2:ConfigurationToken>
 							<tr2:Polygon>
 								<Point xmlns="http://www.onvif.org/ver10/schema" y="` + intToString(pointStart.Y) + `" x="` + intToString(pointStart.X) + `"></Point>
 								<Point xmlns="http://www.onvif.org/ver10/schema" y="` + intToString(pointEnd.Y) + `" x="` + intToString(pointEnd.X) + `"></Point>
@@ -1765,7 +1924,7 @@ func (device Device) CreateMask(configurationToken string, pointStart, pointEnd
 	}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return "", err
 	}
@@ -1776,11 +1935,15 @@ func (device Device) CreateMask(configurationToken string, pointStart, pointEnd
 		return "", err
 	}
 
-	fmt.Printf("Data %v\n", interfaceToString(ifOSDsResponse))
 	return interfaceToString(ifOSDsResponse), nil
 }
 
 func (device Device) UpdateMask(maskToken, configurationToken string, pointStart, pointEnd Point, enable bool) error {
+	return device.UpdateMaskContext(context.Background(), maskToken, configurationToken, pointStart, pointEnd, enable)
+}
+
+// UpdateMaskContext is like UpdateMask but sends the request with ctx.
+func (device Device) UpdateMaskContext(ctx context.Context, maskToken, configurationToken string, pointStart, pointEnd Point, enable bool) error {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -1791,8 +1954,8 @@ func (device Device) UpdateMask(maskToken, configurationToken string, pointStart
 		},
 		Action: "http://www.onvif.org/ver20/media/wsdl/SetMask",
 		Body: `<tr2:SetMask xmlns="http://www.onvif.org/ver20/media/wsdl">
-						<tr2:Mask token="` + maskToken + `">
-							<tr2:ConfigurationToken>` + configurationToken + `</tr2:ConfigurationToken>
+						<tr2:Mask token="` + escapeXML(maskToken) + `">
+							<tr2:ConfigurationToken>` + escapeXML(configurationToken) + `</tr2:ConfigurationToken>
 							<tr2:Polygon>
 								<Point xmlns="http://www.onvif.org/ver10/schema" y="` + intToString(pointStart.Y) + `" x="` + intToString(pointStart.X) + `"></Point>
 								<Point xmlns="http://www.onvif.org/ver10/schema" y="` + intToString(pointEnd.Y) + `" x="` + intToString(pointEnd.X) + `"></Point>
@@ -1805,7 +1968,7 @@ func (device Device) UpdateMask(maskToken, configurationToken string, pointStart
 					</tr2:SetMask>`,
 	}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -1820,6 +1983,11 @@ func (device Device) UpdateMask(maskToken, configurationToken string, pointStart
 }
 
 func (device Device) DeleteMask(maskToken string) error {
+	return device.DeleteMaskContext(context.Background(), maskToken)
+}
+
+// DeleteMaskContext is like DeleteMask but sends the request with ctx.
+func (device Device) DeleteMaskContext(ctx context.Context, maskToken string) error {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -1830,11 +1998,11 @@ func (device Device) DeleteMask(maskToken string) error {
 		},
 		Action: "http://www.onvif.org/ver20/media/wsdl/DeleteMask",
 		Body: `<tr2:DeleteMask xmlns="http://www.onvif.org/ver20/media/wsdl">
-					<Token>` + maskToken + `</Token>
+					<Token>` + escapeXML(maskToken) + `</Token>
 			   </tr2:DeleteMask>`,
 	}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
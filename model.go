@@ -1,12 +1,24 @@
 package onvif
 
-// Device contains data of ONVIF camera
+import "time"
+
+// Device contains data of ONVIF camera. Bare Device values share what is
+// learned about a camera, its clock skew and the mode AuthAuto settled on,
+// with every Device for the same host. Up to 1024 hosts are remembered, the
+// least recently used being forgotten first. The key trusted on first use is
+// never forgotten. A Client keeps its own state for as long as it lives.
 type Device struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	XAddr    string `json:"xAddr"`
-	User     string `json:"user"`
-	Password string `json:"password"`
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	XAddr    string       `json:"xAddr"`
+	User     string       `json:"user"`
+	Password string       `json:"password"`
+	AuthMode AuthMode     `json:"authMode,omitempty"`
+	TLS      *TLSConfig   `json:"-"`
+	Logger   Logger       `json:"-"`
+	Retry    *RetryPolicy `json:"-"`
+
+	client *Client
 }
 
 // DeviceInformation contains information of ONVIF camera
@@ -18,6 +30,105 @@ type DeviceInformation struct {
 	SerialNumber    string
 }
 
+// FirmwareUpgrade tells where and when to upload a firmware image, as
+// returned by StartFirmwareUpgrade
+type FirmwareUpgrade struct {
+	UploadURI        string
+	UploadDelay      time.Duration // wait before uploading
+	ExpectedDownTime time.Duration // how long the device is down after the upload
+}
+
+// BackupFile is a file of the configuration backup of ONVIF camera
+type BackupFile struct {
+	Name string
+	Data []byte
+}
+
+// SystemLog is a log of ONVIF camera, as text or as a file
+type SystemLog struct {
+	Binary []byte
+	String string
+}
+
+// SupportInformation is what ONVIF camera tells its vendor's support, as
+// text or as a file
+type SupportInformation struct {
+	Binary []byte
+	String string
+}
+
+// SystemLogURI is where to download a log of ONVIF camera
+type SystemLogURI struct {
+	Type string // System or Access
+	URI  string
+}
+
+// SystemURIs are where to download the logs, support information and backup
+// of ONVIF camera
+type SystemURIs struct {
+	SystemLogURIs   []SystemLogURI
+	SupportInfoURI  string
+	SystemBackupURI string
+}
+
+// SystemRestore tells where to upload a backup file, as returned by
+// StartSystemRestore
+type SystemRestore struct {
+	UploadURI        string
+	ExpectedDownTime time.Duration // how long the device is down after the upload
+}
+
+// Certificate is a certificate of ONVIF camera, DER encoded
+type Certificate struct {
+	CertificateID string
+	Certificate   []byte
+}
+
+// CertificateStatus tells whether a certificate of ONVIF camera is used by
+// its HTTPS server
+type CertificateStatus struct {
+	CertificateID string
+	Status        bool
+}
+
+// DistinguishedName is the subject of a certification request, empty fields
+// are left out
+type DistinguishedName struct {
+	Country             string
+	StateOrProvinceName string
+	Locality            string
+	Organization        string
+	OrganizationalUnit  string
+	CommonName          string
+}
+
+// KeyAttribute describes a key pair in the keystore of ONVIF camera
+type KeyAttribute struct {
+	KeyID               string
+	Alias               string
+	HasPrivateKey       bool
+	KeyStatus           string // ok, generating or corrupt
+	ExternallyGenerated bool
+	SecurelyStored      bool
+}
+
+// SecurityCertificate is a certificate in the keystore of ONVIF camera, DER
+// encoded
+type SecurityCertificate struct {
+	CertificateID string
+	KeyID         string
+	Alias         string
+	Certificate   []byte
+}
+
+// CertificationPath is a chain of certificates in the keystore of ONVIF
+// camera, from the end entity certificate to the root
+type CertificationPath struct {
+	CertificationPathID string
+	Alias               string
+	CertificateIDs      []string
+}
+
 // NetworkCapabilities contains networking capabilities of ONVIF camera
 type NetworkCapabilities struct {
 	DynDNS     bool
@@ -222,6 +333,14 @@ type PrefixedIPAdress struct {
 	PrefixLength int
 }
 
+// IPAddressFilter lists the addresses allowed, or denied, to reach ONVIF
+// camera
+type IPAddressFilter struct {
+	Type        string // Allow or Deny
+	IPv4Address []PrefixedIPAdress
+	IPv6Address []PrefixedIPAdress
+}
+
 type IPv4Configuration struct {
 	Manual    PrefixedIPAdress
 	LinkLocal PrefixedIPAdress
@@ -305,12 +424,16 @@ type DeviceSecurityCapabilitiesService struct {
 }
 
 type DeviceSystemCapabilitiesService struct {
-	DiscoveryBye     bool
-	DiscoveryResolve bool
-	FirmwareUpgrade  bool
-	SystemLogging    bool
-	SystemBackup     bool
-	RemoteDiscovery  bool
+	DiscoveryBye           bool
+	DiscoveryResolve       bool
+	FirmwareUpgrade        bool
+	SystemLogging          bool
+	SystemBackup           bool
+	RemoteDiscovery        bool
+	HttpFirmwareUpgrade    bool
+	HttpSystemBackup       bool
+	HttpSystemLogging      bool
+	HttpSupportInformation bool
 }
 
 type DeviceNetworkCapabilitiesService struct {
@@ -0,0 +1,115 @@
+package onvif
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// mtomRootID is the Content-ID of the SOAP envelope in an MTOM message.
+const mtomRootID = "<root>"
+
+// xopIncludeRegexp matches the xop:Include elements that stand for an MTOM
+// attachment, capturing its cid: URL.
+var xopIncludeRegexp = regexp.MustCompile(`<(?:[\w.-]+:)?Include\s[^>]*?href="cid:([^"]+)"[^>]*?(?:/>|>\s*</(?:[\w.-]+:)?Include>)`)
+
+// mtomRequest packs a SOAP envelope and its attachments, by Content-ID, into
+// a multipart/related MTOM message, and returns it with its Content-Type.
+func mtomRequest(envelope string, attachments map[string][]byte) ([]byte, string) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	part, _ := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {`application/xop+xml; charset=UTF-8; type="application/soap+xml"`},
+		"Content-Transfer-Encoding": {"8bit"},
+		"Content-Id":                {mtomRootID},
+	})
+	part.Write([]byte(envelope))
+
+	ids := make([]string, 0, len(attachments))
+	for id := range attachments {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		part, _ = writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"application/octet-stream"},
+			"Content-Transfer-Encoding": {"binary"},
+			"Content-Id":                {"<" + id + ">"},
+		})
+		part.Write(attachments[id])
+	}
+	writer.Close()
+
+	contentType := mime.FormatMediaType("multipart/related", map[string]string{
+		"type":       "application/xop+xml",
+		"start":      mtomRootID,
+		"start-info": "application/soap+xml",
+		"boundary":   writer.Boundary(),
+	})
+	return body.Bytes(), contentType
+}
+
+// mtomParts returns the parts of an MTOM response by Content-ID, with the
+// SOAP envelope under "". A response that is not multipart is the envelope.
+func mtomParts(contentType string, body []byte) map[string][]byte {
+	parts := map[string][]byte{"": body}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/related" {
+		return parts
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for first := true; ; first = false {
+		part, err := reader.NextPart()
+		if err != nil {
+			return parts
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			return parts
+		}
+
+		id := part.Header.Get("Content-Id")
+		if id == params["start"] || (first && params["start"] == "") {
+			parts[""] = content
+		} else {
+			parts[id] = content
+		}
+	}
+}
+
+// mtomEnvelope returns the SOAP envelope of a response from its parts, which
+// devices may send as an MTOM message. Attachments are put back in place of
+// the xop:Include elements that refer to them, base64 encoded, as if the
+// device had sent them inline.
+func mtomEnvelope(parts map[string][]byte) []byte {
+	if len(parts) == 1 {
+		return parts[""]
+	}
+
+	return xopIncludeRegexp.ReplaceAllFunc(parts[""], func(include []byte) []byte {
+		cid := string(xopIncludeRegexp.FindSubmatch(include)[1])
+		if unescaped, err := url.PathUnescape(cid); err == nil {
+			cid = unescaped
+		}
+		attachment, ok := parts["<"+cid+">"]
+		if !ok {
+			return include
+		}
+		return []byte(base64.StdEncoding.EncodeToString(attachment))
+	})
+}
+
+// attachmentData decodes an AttachmentData element, whose attachment
+// mtomEnvelope put inline as base64.
+func attachmentData(src interface{}) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(textOf(src)), ""))
+}
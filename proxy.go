@@ -0,0 +1,116 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/clbanning/mxj"
+	"github.com/google/uuid"
+)
+
+// TypeDiscoveryProxy is the type a WS-Discovery proxy announces itself with,
+// in a Hello or in a ProbeMatch that answers a multicast probe.
+var TypeDiscoveryProxy = DeviceType{"http://schemas.xmlsoap.org/ws/2005/04/discovery", "DiscoveryProxy"}
+
+// DiscoveryProxy is a WS-Discovery proxy. In managed mode probes and
+// resolves are sent to the proxy over HTTP instead of being multicast, and
+// the proxy answers for the devices it knows, including those on networks
+// multicast does not reach.
+type DiscoveryProxy struct {
+	// XAddr is the address of the proxy, such as
+	// "http://10.1.0.5:5357/discovery".
+	XAddr string
+	// HTTPClient sends the requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// Probe asks the proxy for the devices matching opts. Interface and Duration
+// are not used; the request ends with ctx.
+func (proxy DiscoveryProxy) Probe(ctx context.Context, opts DiscoveryOptions) ([]DiscoveredDevice, error) {
+	devices, err := proxy.send(ctx, "Probe", opts.probeBody())
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []DiscoveredDevice
+	for _, device := range devices {
+		if opts.matches(device) {
+			matches = append(matches, device)
+		}
+	}
+	return matches, nil
+}
+
+// Resolve asks the proxy for the current XAddrs of the device with endpoint
+// UUID id, or returns ErrDeviceNotFound when the proxy does not know it.
+func (proxy DiscoveryProxy) Resolve(ctx context.Context, id string) (DiscoveredDevice, error) {
+	devices, err := proxy.send(ctx, "Resolve", resolveBody(id))
+	if err != nil {
+		return DiscoveredDevice{}, err
+	}
+
+	for _, device := range devices {
+		if strings.EqualFold(device.ID, endpointID(id)) {
+			return device, nil
+		}
+	}
+	return DiscoveredDevice{}, ErrDeviceNotFound
+}
+
+// send posts a WS-Discovery action to the proxy and reads the matches it
+// answers with.
+func (proxy DiscoveryProxy) send(ctx context.Context, action, body string) ([]DiscoveredDevice, error) {
+	urlXAddr, err := url.Parse(proxy.XAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	requestID := "uuid:" + uuid.New().String()
+	request := discoveryRequest(requestID, proxy.XAddr, action, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", urlXAddr.String(), bytes.NewBufferString(request))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
+
+	httpClient := proxy.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// The proxy answers with a fault, or with the matches
+	mapXML, err := mxj.NewMapXml(responseBody)
+	if err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return nil, &SOAPFault{StatusCode: resp.StatusCode}
+		}
+		return nil, err
+	}
+	if fault := parseSOAPFault(mapXML, resp.StatusCode); fault != nil {
+		return nil, fault
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, &SOAPFault{StatusCode: resp.StatusCode}
+	}
+
+	var source net.Addr
+	if ip := net.ParseIP(urlXAddr.Hostname()); ip != nil {
+		source = &net.TCPAddr{IP: ip}
+	}
+	return readDiscoveryResponse(requestID, responseBody, source)
+}
@@ -1,5 +1,7 @@
 package onvif
 
+import "context"
+
 var ptzXMLNs = []string{
 	`xmlns:i="http://www.w3.org/2001/XMLSchema-instance"`,
 	`xmlns:d="http://www.w3.org/2001/XMLSchema"`,
@@ -7,6 +9,11 @@ var ptzXMLNs = []string{
 }
 
 func (device Device) GetNodes() ([]PTZNode, error) {
+	return device.GetNodesContext(context.Background())
+}
+
+// GetNodesContext is like GetNodes but sends the request with ctx.
+func (device Device) GetNodesContext(ctx context.Context) ([]PTZNode, error) {
 	//create soap
 	soap := SOAP{
 		User:     device.User,
@@ -16,7 +23,7 @@ func (device Device) GetNodes() ([]PTZNode, error) {
 	result := []PTZNode{}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -182,19 +189,24 @@ func (device Device) GetNodes() ([]PTZNode, error) {
 }
 
 func (device Device) GetNode(nodeToken string) (PTZNode, error) {
+	return device.GetNodeContext(context.Background(), nodeToken)
+}
+
+// GetNodeContext is like GetNode but sends the request with ctx.
+func (device Device) GetNodeContext(ctx context.Context, nodeToken string) (PTZNode, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetNode xmlns="http://www.onvif.org/ver20/ptz/wsdl">
-					<NodeToken>` + nodeToken + `</NodeToken>
+					<NodeToken>` + escapeXML(nodeToken) + `</NodeToken>
 				</GetNode>`,
 	}
 
 	result := PTZNode{}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -352,6 +364,11 @@ func (device Device) GetNode(nodeToken string) (PTZNode, error) {
 }
 
 func (device Device) GetConfigurations() ([]PTZConfiguration, error) {
+	return device.GetConfigurationsContext(context.Background())
+}
+
+// GetConfigurationsContext is like GetConfigurations but sends the request with ctx.
+func (device Device) GetConfigurationsContext(ctx context.Context) ([]PTZConfiguration, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -362,7 +379,7 @@ func (device Device) GetConfigurations() ([]PTZConfiguration, error) {
 	result := []PTZConfiguration{}
 
 	//send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -455,19 +472,24 @@ func (device Device) GetConfigurations() ([]PTZConfiguration, error) {
 }
 
 func (device Device) GetConfiguration(ptzConfigurationToken string) (PTZConfiguration, error) {
+	return device.GetConfigurationContext(context.Background(), ptzConfigurationToken)
+}
+
+// GetConfigurationContext is like GetConfiguration but sends the request with ctx.
+func (device Device) GetConfigurationContext(ctx context.Context, ptzConfigurationToken string) (PTZConfiguration, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetConfiguration xmlns="http://www.onvif.org/ver20/ptz/wsdl">
-					<PTZConfigurationToken>` + ptzConfigurationToken + `</PTZConfigurationToken>
+					<PTZConfigurationToken>` + escapeXML(ptzConfigurationToken) + `</PTZConfigurationToken>
 				</GetConfiguration>`,
 	}
 
 	result := PTZConfiguration{}
 
 	// send response
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -554,19 +576,24 @@ func (device Device) GetConfiguration(ptzConfigurationToken string) (PTZConfigur
 }
 
 func (device Device) GetConfigurationOptions(configurationToken string) (PTZConfigurationOptions, error) {
+	return device.GetConfigurationOptionsContext(context.Background(), configurationToken)
+}
+
+// GetConfigurationOptionsContext is like GetConfigurationOptions but sends the request with ctx.
+func (device Device) GetConfigurationOptionsContext(ctx context.Context, configurationToken string) (PTZConfigurationOptions, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetConfigurationOptions xmlns="http://www.onvif.org/ver20/ptz/wsdl">
-					<ConfigurationToken>` + configurationToken + `</ConfigurationToken>
+					<ConfigurationToken>` + escapeXML(configurationToken) + `</ConfigurationToken>
 				</GetConfigurationOptions>`,
 	}
 
 	result := PTZConfigurationOptions{}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -737,19 +764,24 @@ func (device Device) GetConfigurationOptions(configurationToken string) (PTZConf
 }
 
 func (device Device) GetStatus(profileToken string) (PTZStatus, error) {
+	return device.GetStatusContext(context.Background(), profileToken)
+}
+
+// GetStatusContext is like GetStatus but sends the request with ctx.
+func (device Device) GetStatusContext(ctx context.Context, profileToken string) (PTZStatus, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetStatus xmlns="http://www.onvif.org/ver20/ptz/wsdl">
-					<ProfileToken>` + profileToken + `</ProfileToken>
+					<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
 				</GetStatus>`,
 	}
 
 	result := PTZStatus{}
 
 	//send soap
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -793,12 +825,17 @@ func (device Device) GetStatus(profileToken string) (PTZStatus, error) {
 }
 
 func (device Device) ContinuousMove(profileToken string, velocity PTZVector) error {
+	return device.ContinuousMoveContext(context.Background(), profileToken, velocity)
+}
+
+// ContinuousMoveContext is like ContinuousMove but sends the request with ctx.
+func (device Device) ContinuousMoveContext(ctx context.Context, profileToken string, velocity PTZVector) error {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<ContinuousMove xmlns="http://www.onvif.org/ver20/ptz/wsdl">
-					<ProfileToken>` + profileToken + `</ProfileToken>
+					<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
 					<Velocity>
 						<PanTilt xmlns="http://www.onvif.org/ver10/schema" x="` + float64ToString(velocity.PanTilt.X) + `" y="` + float64ToString(velocity.PanTilt.Y) + `"/>
 						<Zoom xmlns="http://www.onvif.org/ver10/schema" x="` + float64ToString(velocity.Zoom.X) + `"/>
@@ -809,7 +846,7 @@ func (device Device) ContinuousMove(profileToken string, velocity PTZVector) err
 	}
 
 	//send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -823,12 +860,17 @@ func (device Device) ContinuousMove(profileToken string, velocity PTZVector) err
 }
 
 func (device Device) AbsoluteMove(profileToken string, position PTZVector) error {
+	return device.AbsoluteMoveContext(context.Background(), profileToken, position)
+}
+
+// AbsoluteMoveContext is like AbsoluteMove but sends the request with ctx.
+func (device Device) AbsoluteMoveContext(ctx context.Context, profileToken string, position PTZVector) error {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<AbsoluteMove xmlns="http://www.onvif.org/ver20/ptz/wsdl">
-					<ProfileToken>` + profileToken + `</ProfileToken>
+					<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
 					<Position>
 						<PanTilt xmlns="http://www.onvif.org/ver10/schema" x="` + float64ToString(position.PanTilt.X) + `" y="` + float64ToString(position.PanTilt.Y) + `"/>
 						<Zoom x="` + float64ToString(position.Zoom.X) + `"/>
@@ -839,7 +881,7 @@ func (device Device) AbsoluteMove(profileToken string, position PTZVector) error
 	}
 
 	//send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -857,12 +899,17 @@ func (device Device) AbsoluteMove(profileToken string, position PTZVector) error
 // y: positive => go to up || negative => go to down
 // z: positive => zoom in || negative => zoom out
 func (device Device) RelativeMove(profileToken string, translation PTZVector) error {
+	return device.RelativeMoveContext(context.Background(), profileToken, translation)
+}
+
+// RelativeMoveContext is like RelativeMove but sends the request with ctx.
+func (device Device) RelativeMoveContext(ctx context.Context, profileToken string, translation PTZVector) error {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<RelativeMove xmlns="http://www.onvif.org/ver20/ptz/wsdl">
-					<ProfileToken>` + profileToken + `</ProfileToken>
+					<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
 					<Translation>
 						<PanTilt xmlns="http://www.onvif.org/ver10/schema" x="` + float64ToString(translation.PanTilt.X) + `" y="` + float64ToString(translation.PanTilt.Y) + `"/>
 						<Zoom x="` + float64ToString(translation.Zoom.X) + `"/>
@@ -873,7 +920,7 @@ func (device Device) RelativeMove(profileToken string, translation PTZVector) er
 	}
 
 	//send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -887,12 +934,17 @@ func (device Device) RelativeMove(profileToken string, translation PTZVector) er
 }
 
 func (device Device) Stop(profileToken string) error {
+	return device.StopContext(context.Background(), profileToken)
+}
+
+// StopContext is like Stop but sends the request with ctx.
+func (device Device) StopContext(ctx context.Context, profileToken string) error {
 	//create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<Stop xmlns="http://www.onvif.org/ver20/ptz/wsdl">
-				<ProfileToken>` + profileToken + `</ProfileToken>
+				<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
 				<PanTilt>true</PanTilt><Zoom>true</Zoom>
 			  </Stop>`,
 		XMLNs:  ptzXMLNs,
@@ -900,7 +952,7 @@ func (device Device) Stop(profileToken string) error {
 	}
 
 	//send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -914,19 +966,24 @@ func (device Device) Stop(profileToken string) error {
 }
 
 func (device Device) GotoHomePosition(profileToken string) error {
+	return device.GotoHomePositionContext(context.Background(), profileToken)
+}
+
+// GotoHomePositionContext is like GotoHomePosition but sends the request with ctx.
+func (device Device) GotoHomePositionContext(ctx context.Context, profileToken string) error {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GotoHomePosition xmlns="http://www.onvif.org/ver20/ptz/wsdl">
-					<ProfileToken>` + profileToken + `</ProfileToken>
+					<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
 				</GotoHomePosition>`,
 		XMLNs:  ptzXMLNs,
 		Action: "http://www.onvif.org/ver20/ptz/wsdl/GotoHomePosition",
 	}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -940,17 +997,22 @@ func (device Device) GotoHomePosition(profileToken string) error {
 }
 
 func (device Device) SetHomePosition(profileToken string) error {
+	return device.SetHomePositionContext(context.Background(), profileToken)
+}
+
+// SetHomePositionContext is like SetHomePosition but sends the request with ctx.
+func (device Device) SetHomePositionContext(ctx context.Context, profileToken string) error {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<SetHomePosition xmlns="http://www.onvif.org/ver20/ptz/wsdl">
-					<ProfileToken>` + profileToken + `</ProfileToken>
+					<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
 				</SetHomePosition>`,
 	}
 
 	//send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -965,18 +1027,23 @@ func (device Device) SetHomePosition(profileToken string) error {
 
 // return preset token of new preset
 func (device Device) SetPreset(profileToken string, presetName string) (string, error) {
+	return device.SetPresetContext(context.Background(), profileToken, presetName)
+}
+
+// SetPresetContext is like SetPreset but sends the request with ctx.
+func (device Device) SetPresetContext(ctx context.Context, profileToken string, presetName string) (string, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<SetPreset xmlns="http://www.onvif.org/ver20/ptz/wsdl">
-					<ProfileToken>` + profileToken + `</ProfileToken>
-					<PresetName>` + presetName + `</PresetName>
+					<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
+					<PresetName>` + escapeXML(presetName) + `</PresetName>
 				</SetPreset>`,
 	}
 	var result string
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -995,18 +1062,23 @@ func (device Device) SetPreset(profileToken string, presetName string) (string,
 }
 
 func (device Device) GetPresets(profileToken string) ([]PTZPreset, error) {
+	return device.GetPresetsContext(context.Background(), profileToken)
+}
+
+// GetPresetsContext is like GetPresets but sends the request with ctx.
+func (device Device) GetPresetsContext(ctx context.Context, profileToken string) ([]PTZPreset, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetPresets xmlns="http://www.onvif.org/ver20/ptz/wsdl">
-					<ProfileToken>` + profileToken + `</ProfileToken>
+					<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
 				</GetPresets>`,
 	}
 	result := []PTZPreset{}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -1049,18 +1121,23 @@ func (device Device) GetPresets(profileToken string) ([]PTZPreset, error) {
 }
 
 func (device Device) GotoPreset(profileToken string, presetToken string) error {
+	return device.GotoPresetContext(context.Background(), profileToken, presetToken)
+}
+
+// GotoPresetContext is like GotoPreset but sends the request with ctx.
+func (device Device) GotoPresetContext(ctx context.Context, profileToken string, presetToken string) error {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GotoPreset xmlns="http://www.onvif.org/ver20/ptz/wsdl">
-					<ProfileToken>` + profileToken + `</ProfileToken>
-					<PresetToken>` + presetToken + `</PresetToken>
+					<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
+					<PresetToken>` + escapeXML(presetToken) + `</PresetToken>
 				</GotoPreset>`,
 	}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -1074,18 +1151,23 @@ func (device Device) GotoPreset(profileToken string, presetToken string) error {
 }
 
 func (device Device) RemovePreset(profileToken string, presetToken string) error {
+	return device.RemovePresetContext(context.Background(), profileToken, presetToken)
+}
+
+// RemovePresetContext is like RemovePreset but sends the request with ctx.
+func (device Device) RemovePresetContext(ctx context.Context, profileToken string, presetToken string) error {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<RemovePreset xmlns="http://www.onvif.org/ver20/ptz/wsdl">
-					<ProfileToken>` + profileToken + `</ProfileToken>
-					<PresetToken>` + presetToken + `</PresetToken>
+					<ProfileToken>` + escapeXML(profileToken) + `</ProfileToken>
+					<PresetToken>` + escapeXML(presetToken) + `</PresetToken>
 				</RemovePreset>`,
 	}
 
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return err
 	}
@@ -1,20 +1,27 @@
 package onvif
 
-import "github.com/golang/glog"
+import (
+	"context"
+)
 
 func (device Device) GetRecordingConfiguration(recordingToken string) (interface{}, error) {
+	return device.GetRecordingConfigurationContext(context.Background(), recordingToken)
+}
+
+// GetRecordingConfigurationContext is like GetRecordingConfiguration but sends the request with ctx.
+func (device Device) GetRecordingConfigurationContext(ctx context.Context, recordingToken string) (interface{}, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetRecordingConfiguration xmlns="http://www.onvif.org/ver10/recording/wsdl">
-						<RecordingToken>` + recordingToken + `</RecordingToken>
+						<RecordingToken>` + escapeXML(recordingToken) + `</RecordingToken>
 					</GetRecordingConfiguration>`,
 	}
 
 	var result interface{}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -24,6 +31,6 @@ func (device Device) GetRecordingConfiguration(recordingToken string) (interface
 	if err != nil {
 		return result, err
 	}
-	glog.Infof("Data %v", data)
+	logAt(device.Logger, LogDebug, "recording configuration", "xaddr", redact(device.XAddr), "operation", "GetRecordingConfiguration", "data", data)
 	return result, nil
 }
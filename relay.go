@@ -1,8 +1,15 @@
 package onvif
 
-import "github.com/golang/glog"
+import (
+	"context"
+)
 
 func (device Device) GetReplayConfiguration() (interface{}, error) {
+	return device.GetReplayConfigurationContext(context.Background())
+}
+
+// GetReplayConfigurationContext is like GetReplayConfiguration but sends the request with ctx.
+func (device Device) GetReplayConfigurationContext(ctx context.Context) (interface{}, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -12,7 +19,7 @@ func (device Device) GetReplayConfiguration() (interface{}, error) {
 
 	var result interface{}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -22,11 +29,16 @@ func (device Device) GetReplayConfiguration() (interface{}, error) {
 	if err != nil {
 		return result, err
 	}
-	glog.Infof("Data %v", data)
+	logAt(device.Logger, LogDebug, "replay configuration", "xaddr", redact(device.XAddr), "operation", "GetReplayConfiguration", "data", data)
 	return result, nil
 }
 
 func (device Device) GetReplayServiceCapabilities() (interface{}, error) {
+	return device.GetReplayServiceCapabilitiesContext(context.Background())
+}
+
+// GetReplayServiceCapabilitiesContext is like GetReplayServiceCapabilities but sends the request with ctx.
+func (device Device) GetReplayServiceCapabilitiesContext(ctx context.Context) (interface{}, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -36,7 +48,7 @@ func (device Device) GetReplayServiceCapabilities() (interface{}, error) {
 
 	var result interface{}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -46,17 +58,22 @@ func (device Device) GetReplayServiceCapabilities() (interface{}, error) {
 	if err != nil {
 		return result, err
 	}
-	glog.Infof("Data %v", data)
+	logAt(device.Logger, LogDebug, "replay service capabilities", "xaddr", redact(device.XAddr), "operation", "GetServiceCapabilities", "data", data)
 	return result, nil
 }
 
 func (device Device) GetReplayUri(recordingToken string) (string, error) {
+	return device.GetReplayUriContext(context.Background(), recordingToken)
+}
+
+// GetReplayUriContext is like GetReplayUri but sends the request with ctx.
+func (device Device) GetReplayUriContext(ctx context.Context, recordingToken string) (string, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetReplayUri xmlns="http://www.onvif.org/ver10/replay/wsdl">
-						<RecordingToken>` + recordingToken + `</RecordingToken>		
+						<RecordingToken>` + escapeXML(recordingToken) + `</RecordingToken>		
 						<StreamSetup>
 							<Stream xmlns="http://www.onvif.org/ver10/schema">RTP-Unicast</Stream>
 							<Transport xmlns="http://www.onvif.org/ver10/schema">
@@ -68,7 +85,7 @@ func (device Device) GetReplayUri(recordingToken string) (string, error) {
 
 	var result = ""
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
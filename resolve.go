@@ -0,0 +1,84 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrDeviceNotFound is returned by Resolve when no device answers for the
+// endpoint.
+var ErrDeviceNotFound = errors.New("onvif: device not found")
+
+// Resolve finds the current XAddrs of a device known by its endpoint UUID,
+// such as a camera whose IP address DHCP changed. The UUID may have the
+// urn:uuid: prefix or not. A WS-Discovery Resolve is multicast from every
+// interface, and ErrDeviceNotFound is returned when no device answers within
+// 3 seconds, or before ctx ends.
+func Resolve(ctx context.Context, id string) (DiscoveredDevice, error) {
+	ipAddrs, err := discoveryAddrs("")
+	if err != nil {
+		return DiscoveredDevice{}, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var once sync.Once
+	var result DiscoveredDevice
+	found := func(device DiscoveredDevice) {
+		if !strings.EqualFold(device.ID, endpointID(id)) {
+			return
+		}
+		once.Do(func() {
+			result = device
+			cancel()
+		})
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(ipAddrs))
+	for i, ipAddr := range ipAddrs {
+		wg.Add(1)
+		go func(i int, ipAddr string) {
+			defer wg.Done()
+			network, local, multicast, err := multicastAddrs(ipAddr)
+			if err == nil {
+				err = sendDiscoveryMessage(ctx, network, local, multicast, defaultDiscoveryDuration, "Resolve", resolveBody(id), found)
+			}
+			if err != nil && ctx.Err() == nil {
+				logAt(nil, LogDebug, "resolve failed", "address", ipAddr, "error", err)
+				errs[i] = err
+			}
+		}(i, ipAddr)
+	}
+	wg.Wait()
+
+	if result.ID != "" {
+		return result, nil
+	}
+	for i, ipAddr := range ipAddrs {
+		if errs[i] != nil && !isIPv6(ipAddr) {
+			return DiscoveredDevice{}, errs[i]
+		}
+	}
+	return DiscoveredDevice{}, ErrDeviceNotFound
+}
+
+// resolveBody returns the Resolve element for the endpoint id.
+func resolveBody(id string) string {
+	return `<Resolve xmlns="http://schemas.xmlsoap.org/ws/2005/04/discovery">` +
+		`<a:EndpointReference><a:Address>urn:uuid:` + escapeXML(endpointID(id)) + `</a:Address></a:EndpointReference>` +
+		`</Resolve>`
+}
+
+// endpointID returns id without its urn:uuid: prefix, as DiscoveredDevice
+// has it.
+func endpointID(id string) string {
+	id = strings.TrimSpace(id)
+	if strings.HasPrefix(strings.ToLower(id), "urn:uuid:") {
+		return id[len("urn:uuid:"):]
+	}
+	return id
+}
@@ -0,0 +1,124 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clbanning/mxj"
+)
+
+var testResolveMatches = strings.NewReplacer(
+	"ProbeMatches>", "ResolveMatches>",
+	"ProbeMatch>", "ResolveMatch>",
+).Replace(testProbeMatches)
+
+func TestReadDiscoveryResponseResolveMatches(t *testing.T) {
+	devices, err := readDiscoveryResponse("uuid:probe", []byte(testResolveMatches), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].ID != "2419d68a-2dd2-21b2-a205-ec3c2d3b9f41" || len(devices[0].XAddrs) != 2 {
+		t.Fatalf("unexpected devices %+v", devices)
+	}
+}
+
+func TestResolveBody(t *testing.T) {
+	for _, id := range []string{"2419d68a-2dd2", "urn:uuid:2419d68a-2dd2", " URN:UUID:2419d68a-2dd2"} {
+		body := resolveBody(id)
+		if !strings.Contains(body, "<a:Address>urn:uuid:2419d68a-2dd2</a:Address>") {
+			t.Errorf("%q: unexpected body %s", id, body)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	itf := multicastInterface(t)
+	newFakeDiscoveryDevice(t, itf, "other-device", "2419D68A-2dd2-21b2-a205-ec3c2d3b9f41")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+
+	device, err := Resolve(ctx, "urn:uuid:2419d68a-2dd2-21b2-a205-ec3c2d3b9f41")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(device.XAddrs) != 2 || device.XAddrs[0] != "http://192.168.1.20/onvif/device_service" {
+		t.Fatalf("unexpected device %+v", device)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("resolve waited %v after the device answered", elapsed)
+	}
+}
+
+func TestResolveNotFound(t *testing.T) {
+	itf := multicastInterface(t)
+	newFakeDiscoveryDevice(t, itf, "other-device")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	if _, err := Resolve(ctx, "2419d68a-2dd2-21b2-a205-ec3c2d3b9f41"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("expected ErrDeviceNotFound, got %v", err)
+	}
+}
+
+// discoveryProxy answers probes with testProbeMatches and resolves with
+// testResolveMatches, as a managed-mode discovery proxy does.
+func discoveryProxy(t *testing.T) soapServerOption {
+	return withHandler(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		mapXML, err := mxj.NewMapXml(body)
+		if err != nil {
+			t.Error(err)
+			return true
+		}
+		messageID, _ := mapXML.ValueForPathString("Envelope.Header.MessageID")
+		to, _ := mapXML.ValueForPathString("Envelope.Header.To.#text")
+		action, _ := mapXML.ValueForPathString("Envelope.Header.Action.#text")
+		if to != "http://"+r.Host+"/discovery" {
+			t.Errorf("unexpected To %q", to)
+		}
+
+		response := testProbeMatches
+		if strings.HasSuffix(action, "/Resolve") {
+			response = testResolveMatches
+		}
+		w.Header().Set("Content-Type", "application/soap+xml")
+		w.Write([]byte(strings.Replace(response, "uuid:probe", messageID, 1)))
+		return true
+	})
+}
+
+func TestDiscoveryProxy(t *testing.T) {
+	server := newSOAPServer(t, "", nil, discoveryProxy(t))
+	proxy := DiscoveryProxy{XAddr: server.URL + "/discovery"}
+
+	devices, err := proxy.Probe(context.Background(), DiscoveryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].Device().XAddr != "http://192.168.1.20/onvif/device_service" {
+		t.Fatalf("unexpected devices %+v", devices)
+	}
+
+	devices, err = proxy.Probe(context.Background(), DiscoveryOptions{Scopes: []string{"onvif://www.onvif.org/name/Back_Door"}})
+	if err != nil || len(devices) != 0 {
+		t.Fatalf("expected no devices matching the scope, got %+v, %v", devices, err)
+	}
+
+	device, err := proxy.Resolve(context.Background(), "urn:uuid:2419d68a-2dd2-21b2-a205-ec3c2d3b9f41")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.ID != "2419d68a-2dd2-21b2-a205-ec3c2d3b9f41" {
+		t.Fatalf("unexpected device %+v", device)
+	}
+
+	if _, err := proxy.Resolve(context.Background(), "other-device"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("expected ErrDeviceNotFound, got %v", err)
+	}
+}
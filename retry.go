@@ -0,0 +1,134 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/clbanning/mxj"
+)
+
+// RetryPolicy controls how requests that failed transiently are retried.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a request is sent at most, including
+	// the first attempt. Requests are not retried when it is 1 or less.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry. It doubles for
+	// every following retry, up to MaxBackoff.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between retries. Zero means no cap.
+	MaxBackoff time.Duration
+	// Jitter is the fraction, between 0 and 1, of each wait that is
+	// randomized, so devices are not retried in lockstep.
+	Jitter float64
+	// Retryable reports whether a request that failed with err may be sent
+	// again. If nil, IsTransientError is used.
+	Retryable func(err error) bool
+	// RetryOperation reports whether requests of an operation, such as
+	// "GetProfiles", may be retried. If nil, only the idempotent Get*
+	// operations are retried; state-changing ones like SystemReboot or
+	// CreateUsers are never sent twice.
+	RetryOperation func(operation string) bool
+}
+
+// DefaultRetryPolicy returns a policy that sends Get* requests up to three
+// times, waiting about 200ms and 400ms between attempts.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Jitter:         0.2,
+	}
+}
+
+// IsTransientError reports whether err is a failure worth retrying: the
+// connection was dropped or timed out, or the device answered with a 5xx
+// status and no SOAP fault, as busy devices do.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var fault *SOAPFault
+	if errors.As(err, &fault) {
+		return fault.Code == "" && fault.StatusCode >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// retries reports whether a request of operation that failed with err may be
+// sent again.
+func (policy *RetryPolicy) retries(operation string, err error) bool {
+	if policy.RetryOperation != nil {
+		if !policy.RetryOperation(operation) {
+			return false
+		}
+	} else if !strings.HasPrefix(operation, "Get") {
+		return false
+	}
+
+	if policy.Retryable != nil {
+		return policy.Retryable(err)
+	}
+	return IsTransientError(err)
+}
+
+// backoff returns the wait before the retry-th retry, counting from 0.
+func (policy *RetryPolicy) backoff(retry int) time.Duration {
+	wait := policy.InitialBackoff
+	for i := 0; i < retry && (policy.MaxBackoff == 0 || wait < policy.MaxBackoff); i++ {
+		wait *= 2
+	}
+	if policy.MaxBackoff > 0 && wait > policy.MaxBackoff {
+		wait = policy.MaxBackoff
+	}
+
+	if policy.Jitter > 0 {
+		jitter := time.Duration(policy.Jitter * float64(wait))
+		wait += time.Duration(rand.Int63n(int64(jitter)+1)) - jitter/2
+	}
+	return wait
+}
+
+// sendRequestWithRetry sends soap to xaddr, retrying as the device's
+// RetryPolicy allows.
+func (device Device) sendRequestWithRetry(ctx context.Context, soap SOAP, xaddr string) (mxj.Map, error) {
+	response, err := soap.SendRequestContext(ctx, xaddr)
+	policy := device.Retry
+	if policy == nil {
+		return response, err
+	}
+
+	operation := operationName(soap.Body)
+	for attempt := 1; attempt < policy.MaxAttempts && policy.retries(operation, err); attempt++ {
+		wait := policy.backoff(attempt - 1)
+		logAt(device.Logger, LogDebug, "onvif retry", "xaddr", redact(xaddr), "operation", operation, "attempt", attempt+1, "backoff", wait, "error", err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return response, err
+		case <-timer.C:
+		}
+
+		response, err = soap.SendRequestContext(ctx, xaddr)
+	}
+	return response, err
+}
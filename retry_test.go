@@ -0,0 +1,129 @@
+package onvif
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failFirst answers as a device that fails the first failures requests with
+// fail, and counts every request it receives.
+func failFirst(failures int32, fail func(w http.ResponseWriter)) (soapServerOption, *int32) {
+	var requests int32
+	return withHandler(func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			fail(w)
+			return true
+		}
+		return false
+	}), &requests
+}
+
+func serverError(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+func dropConnection(w http.ResponseWriter) {
+	conn, _, _ := w.(http.Hijacker).Hijack()
+	conn.Close()
+}
+
+func testRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	for name, fail := range map[string]func(http.ResponseWriter){"500": serverError, "dropped": dropConnection} {
+		flaky, requests := failFirst(2, fail)
+		server := newSOAPServer(t, testInformationResponse, nil, withRawResponse(), flaky)
+		device := Device{XAddr: server.URL, Retry: testRetryPolicy()}
+
+		info, err := device.GetInformation()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if info.Manufacturer != "Acme" || atomic.LoadInt32(requests) != 3 {
+			t.Fatalf("%s: expected success on the third attempt, got %d requests", name, atomic.LoadInt32(requests))
+		}
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	flaky, requests := failFirst(10, serverError)
+	server := newSOAPServer(t, testInformationResponse, nil, withRawResponse(), flaky)
+	device := Device{XAddr: server.URL, Retry: testRetryPolicy()}
+
+	if _, err := device.GetInformation(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if n := atomic.LoadInt32(requests); n != 3 {
+		t.Fatalf("expected 3 attempts, got %d", n)
+	}
+}
+
+func TestRetrySkipsStateChangingOperations(t *testing.T) {
+	flaky, requests := failFirst(1, serverError)
+	server := newSOAPServer(t, testInformationResponse, nil, withRawResponse(), flaky)
+	device := Device{XAddr: server.URL, Retry: testRetryPolicy()}
+
+	if _, err := device.SystemReboot(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if n := atomic.LoadInt32(requests); n != 1 {
+		t.Fatalf("expected SystemReboot to be sent once, got %d requests", n)
+	}
+
+	device.Retry.RetryOperation = func(operation string) bool { return operation == "SystemReboot" }
+	device.SystemReboot()
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Fatalf("expected an opted-in SystemReboot to be sent once more, got %d requests", n)
+	}
+}
+
+func TestRetrySkipsSOAPFaults(t *testing.T) {
+	fault, requests := failFirst(1, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(notAuthorizedFault))
+	})
+	server := newSOAPServer(t, testInformationResponse, nil, withRawResponse(), fault)
+
+	device := Device{XAddr: server.URL, Retry: testRetryPolicy()}
+	device.GetInformation()
+	if n := atomic.LoadInt32(requests); n != 1 {
+		t.Fatalf("expected a SOAP fault not to be retried, got %d requests", n)
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	cases := map[error]bool{
+		io.ErrUnexpectedEOF:                             true,
+		&SOAPFault{StatusCode: 503}:                     true,
+		&SOAPFault{StatusCode: 400}:                     false,
+		&SOAPFault{Code: "s:Receiver", StatusCode: 500}: false,
+		errors.New("invalid URL"):                       false,
+	}
+	for err, expected := range cases {
+		if transient := IsTransientError(err); transient != expected {
+			t.Errorf("IsTransientError(%v) = %v, expected %v", err, transient, expected)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	for retry, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond} {
+		if wait := policy.backoff(retry); wait != expected {
+			t.Errorf("backoff(%d) = %v, expected %v", retry, wait, expected)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if wait := policy.backoff(0); wait < 75*time.Millisecond || wait > 125*time.Millisecond {
+			t.Fatalf("jittered backoff %v out of range", wait)
+		}
+	}
+}
@@ -1,6 +1,13 @@
 package onvif
 
+import "context"
+
 func (device Device) GetRecordingSummary() ([]RecordingSummary, error) {
+	return device.GetRecordingSummaryContext(context.Background())
+}
+
+// GetRecordingSummaryContext is like GetRecordingSummary but sends the request with ctx.
+func (device Device) GetRecordingSummaryContext(ctx context.Context) ([]RecordingSummary, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -10,7 +17,7 @@ func (device Device) GetRecordingSummary() ([]RecordingSummary, error) {
 
 	result := make([]RecordingSummary, 0)
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -35,18 +42,23 @@ func (device Device) GetRecordingSummary() ([]RecordingSummary, error) {
 }
 
 func (device Device) GetMediaAttributes(time string) ([]MediaAttributes, error) {
+	return device.GetMediaAttributesContext(context.Background(), time)
+}
+
+// GetMediaAttributesContext is like GetMediaAttributes but sends the request with ctx.
+func (device Device) GetMediaAttributesContext(ctx context.Context, time string) ([]MediaAttributes, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetMediaAttributes xmlns="http://www.onvif.org/ver10/search/wsdl">
-					<Time>` + time + `</Time>					
+					<Time>` + escapeXML(time) + `</Time>					
 			   </GetMediaAttributes>`,
 	}
 
 	result := make([]MediaAttributes, 0)
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -69,6 +81,11 @@ func (device Device) GetMediaAttributes(time string) ([]MediaAttributes, error)
 }
 
 func (device Device) FindRecordings() (string, error) {
+	return device.FindRecordingsContext(context.Background())
+}
+
+// FindRecordingsContext is like FindRecordings but sends the request with ctx.
+func (device Device) FindRecordingsContext(ctx context.Context) (string, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
@@ -79,7 +96,7 @@ func (device Device) FindRecordings() (string, error) {
 
 	var result = ""
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -93,18 +110,23 @@ func (device Device) FindRecordings() (string, error) {
 }
 
 func (device Device) GetRecordingSearchResults(searchToken string) (ResultList, error) {
+	return device.GetRecordingSearchResultsContext(context.Background(), searchToken)
+}
+
+// GetRecordingSearchResultsContext is like GetRecordingSearchResults but sends the request with ctx.
+func (device Device) GetRecordingSearchResultsContext(ctx context.Context, searchToken string) (ResultList, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetRecordingSearchResults xmlns="http://www.onvif.org/ver10/search/wsdl">
-					<SearchToken>` + searchToken + `</SearchToken>
+					<SearchToken>` + escapeXML(searchToken) + `</SearchToken>
 				</GetRecordingSearchResults>`,
 	}
 
 	result := ResultList{}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -155,18 +177,23 @@ func (device Device) GetRecordingSearchResults(searchToken string) (ResultList,
 }
 
 func (device Device) FindEvents(startPoint string) (string, error) {
+	return device.FindEventsContext(context.Background(), startPoint)
+}
+
+// FindEventsContext is like FindEvents but sends the request with ctx.
+func (device Device) FindEventsContext(ctx context.Context, startPoint string) (string, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<FindEvents xmlns="http://www.onvif.org/ver10/search/wsdl">
-					<StartPoint>` + startPoint + `</StartPoint>
+					<StartPoint>` + escapeXML(startPoint) + `</StartPoint>
 			   </FindEvents>`,
 	}
 
 	var result = ""
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
@@ -180,18 +207,23 @@ func (device Device) FindEvents(startPoint string) (string, error) {
 }
 
 func (device Device) GetEventSearchResults(searchToken string) (ResultList, error) {
+	return device.GetEventSearchResultsContext(context.Background(), searchToken)
+}
+
+// GetEventSearchResultsContext is like GetEventSearchResults but sends the request with ctx.
+func (device Device) GetEventSearchResultsContext(ctx context.Context, searchToken string) (ResultList, error) {
 	// create soap
 	soap := SOAP{
 		User:     device.User,
 		Password: device.Password,
 		Body: `<GetEventSearchResults xmlns="http://www.onvif.org/ver10/search/wsdl">
-					<SearchToken>` + searchToken + `</SearchToken>
+					<SearchToken>` + escapeXML(searchToken) + `</SearchToken>
 				</GetEventSearchResults>`,
 	}
 
 	result := ResultList{}
 	// send request
-	response, err := soap.SendRequest(device.XAddr)
+	response, err := device.sendRequest(ctx, soap, device.XAddr)
 	if err != nil {
 		return result, err
 	}
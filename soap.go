@@ -2,7 +2,9 @@ package onvif
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
+	"crypto/tls"
 	"encoding/base64"
 	"errors"
 	"github.com/quocson95/go-onvif/digest"
@@ -13,7 +15,6 @@ import (
 	"time"
 
 	"github.com/clbanning/mxj"
-	"github.com/golang/glog"
 	"github.com/google/uuid"
 )
 
@@ -26,36 +27,91 @@ type SOAP struct {
 	TokenAge time.Duration
 	Action   string
 	NoDebug  bool
+
+	// ClockOffset is how far the device's clock is ahead of ours, added to
+	// the WS-UsernameToken timestamp so skewed devices accept it.
+	ClockOffset time.Duration
+	// AuthMode selects how User and Password are sent.
+	AuthMode AuthMode
+
+	// attachments are sent with MTOM, each referenced from Body as cid:
+	// followed by its key.
+	attachments map[string][]byte
+
+	client    *Client
+	tlsConfig *tls.Config
+	logger    Logger
 }
 
-// SendRequest sends SOAP request to xAddr with digest authenticate
+// SendRequest sends SOAP request to xAddr, authenticated as AuthMode selects
 func (soap SOAP) SendRequest(xaddr string) (mxj.Map, error) {
+	return soap.SendRequestContext(context.Background(), xaddr)
+}
+
+// SendRequestContext is like SendRequest but binds the HTTP exchange to ctx,
+// so the call is aborted as soon as ctx is cancelled or its deadline expires.
+func (soap SOAP) SendRequestContext(ctx context.Context, xaddr string) (mxj.Map, error) {
+	operation := operationName(soap.Body)
+	level := operationLogLevel(operation)
+	if soap.NoDebug {
+		level = LogOff
+	}
+	fields := []interface{}{"xaddr", redact(xaddr), "operation", operation}
+
+	start := time.Now()
+	response, err := soap.exchange(ctx, xaddr, level, fields)
+	if level == LogOff {
+		return response, err
+	}
+
+	fields = append(fields, "latency", time.Since(start))
+	var fault *SOAPFault
+	switch {
+	case errors.As(err, &fault):
+		logAt(soap.logger, level, "onvif fault", append(fields, "fault", fault.code(), "status", fault.StatusCode)...)
+	case err != nil:
+		logAt(soap.logger, level, "onvif request failed", append(fields, "error", err)...)
+	default:
+		logAt(soap.logger, level, "onvif request done", fields...)
+	}
+	return response, err
+}
+
+// exchange sends the request to xaddr and parses the response, logging both
+// at level.
+func (soap SOAP) exchange(ctx context.Context, xaddr string, level LogLevel, fields []interface{}) (mxj.Map, error) {
 	// Create SOAP request
 	request := soap.createRequest()
-	// Make sure URL valid and add authentication in xAddr
+	// Make sure URL valid
 	urlXAddr, err := url.Parse(xaddr)
 	if err != nil {
 		return nil, err
 	}
 
-	if soap.User != "" {
-		urlXAddr.User = url.UserPassword(soap.User, soap.Password)
-	}
-	if !soap.NoDebug {
-		glog.Info(request)
+	if level != LogOff {
+		logAt(soap.logger, level, "onvif request", append(fields, "body", redact(request))...)
 	}
+
 	// Create HTTP request
-	buffer := bytes.NewBuffer([]byte(request))
-	req, err := http.NewRequest("POST", urlXAddr.String(), buffer)
+	body, contentType := []byte(request), "application/soap+xml"
+	if len(soap.attachments) > 0 {
+		body, contentType = mtomRequest(request, soap.attachments)
+	}
+	buffer := bytes.NewBuffer(body)
+	req, err := http.NewRequestWithContext(ctx, "POST", urlXAddr.String(), buffer)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/soap+xml")
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("Charset", "utf-8")
+	if soap.User != "" && soap.AuthMode == AuthHTTPBasic {
+		req.SetBasicAuth(soap.User, soap.Password)
+	}
 
 	// Send request
-	var httpDigestClient = digest.NewTransport(soap.User, soap.Password)
-	resp, err := httpDigestClient.RoundTrip(req)
+	httpClient, release := soap.httpClient()
+	defer release()
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -67,30 +123,61 @@ func (soap SOAP) SendRequest(xaddr string) (mxj.Map, error) {
 		return nil, err
 	}
 
-	if !soap.NoDebug {
-		glog.Infof("Onvif response: %s", string(responseBody))
+	// Log the envelope before attachments are put inline, and without
+	// binary content sent as base64, so files are not dumped in the logs
+	parts := mtomParts(resp.Header.Get("Content-Type"), responseBody)
+	if level != LogOff {
+		logAt(soap.logger, level, "onvif response", append(fields, "status", resp.StatusCode, "body", elideBase64(redact(string(parts[""]))))...)
 	}
+	responseBody = mtomEnvelope(parts)
 
 	// Parse XML to map
 	mapXML, err := mxj.NewMapXml(responseBody)
 	if err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return nil, &SOAPFault{StatusCode: resp.StatusCode}
+		}
 		return nil, err
 	}
 
 	// Check if SOAP returns fault
-	fault, _ := mapXML.ValueForPathString("Envelope.Body.Fault.Reason.Text.#text")
-	if fault != "" {
-		return nil, errors.New(fault)
+	if fault := parseSOAPFault(mapXML, resp.StatusCode); fault != nil {
+		return nil, fault
 	}
-
-	fault, _ = mapXML.ValueForPathString("Envelope.Body.Fault.faultstring")
-	if fault != "" {
-		return nil, errors.New(fault)
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, &SOAPFault{StatusCode: resp.StatusCode}
 	}
 
 	return mapXML, nil
 }
 
+// httpClient returns the HTTP client to send the request with, through the
+// client's pooled transport when there is one, and a func to release it.
+func (soap SOAP) httpClient() (*http.Client, func()) {
+	digestAuth := soap.User != "" && soap.AuthMode.usesHTTPDigest()
+	if soap.client != nil {
+		if digestAuth {
+			return soap.client.httpClient, func() {}
+		}
+		return soap.client.plainClient, func() {}
+	}
+
+	tlsConfig := soap.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	transport := newHTTPTransport(tlsConfig)
+	httpClient := &http.Client{Transport: transport}
+	if digestAuth {
+		httpClient.Transport = &digest.Transport{
+			Username:  soap.User,
+			Password:  soap.Password,
+			Transport: transport,
+		}
+	}
+	return httpClient, transport.CloseIdleConnections
+}
+
 func (soap SOAP) createRequest() string {
 	// Create request envelope
 	request := `<?xml version="1.0" encoding="UTF-8"?>`
@@ -103,15 +190,16 @@ func (soap SOAP) createRequest() string {
 	request += ">"
 
 	// Set request header
-	if soap.Action != "" || soap.User != "" {
+	useToken := soap.User != "" && soap.AuthMode.usesUsernameToken()
+	if soap.Action != "" || useToken {
 		request += "<s:Header>"
 
 		if soap.Action != "" {
 			request += `<Action mustUnderstand="1"
-							   xmlns="http://www.w3.org/2005/08/addressing">` + soap.Action + `</Action>`
+							   xmlns="http://www.w3.org/2005/08/addressing">` + escapeXML(soap.Action) + `</Action>`
 		}
 
-		if soap.User != "" {
+		if useToken {
 			request += soap.createUserToken()
 		}
 
@@ -132,9 +220,18 @@ func (soap SOAP) createRequest() string {
 }
 
 func (soap SOAP) createUserToken() string {
+	if soap.AuthMode == AuthWSUsernameTokenText {
+		return `<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">
+			<UsernameToken>
+				<Username>` + escapeXML(soap.User) + `</Username>
+				<Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordText">` + escapeXML(soap.Password) + `</Password>
+			</UsernameToken>
+		</Security>`
+	}
+
 	nonce := uuid.New().String()
 	nonce64 := base64.StdEncoding.EncodeToString(([]byte)(nonce))
-	timestamp := time.Now().Add(soap.TokenAge).UTC().Format(time.RFC3339)
+	timestamp := time.Now().Add(soap.ClockOffset + soap.TokenAge).UTC().Format(time.RFC3339)
 	token := string(nonce) + timestamp + soap.Password
 
 	sha := sha1.New()
@@ -144,7 +241,7 @@ func (soap SOAP) createUserToken() string {
 
 	return `<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">
   		<UsernameToken>
-    		<Username>` + soap.User + `</Username>
+    		<Username>` + escapeXML(soap.User) + `</Username>
     		<Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">` + shaDigest64 + `</Password>
     		<Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">` + nonce64 + `</Nonce>
     		<Created xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">` + timestamp + `</Created>
@@ -0,0 +1,184 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// soapServer is how a test server started by newSOAPServer answers.
+type soapServer struct {
+	status      int
+	header      http.Header
+	raw         bool
+	tls         bool
+	attachments map[string][]byte
+	handler     func(w http.ResponseWriter, r *http.Request, body []byte) bool
+}
+
+// soapServerOption changes how a test server started by newSOAPServer
+// answers.
+type soapServerOption func(*soapServer)
+
+// withStatus answers with an HTTP status other than 200.
+func withStatus(status int) soapServerOption {
+	return func(server *soapServer) { server.status = status }
+}
+
+// withHeader adds a header to the response.
+func withHeader(key, value string) soapServerOption {
+	return func(server *soapServer) { server.header.Add(key, value) }
+}
+
+// withRawResponse sends the response body as is, rather than in a SOAP
+// envelope.
+func withRawResponse() soapServerOption {
+	return func(server *soapServer) { server.raw = true }
+}
+
+// withTLS serves over HTTPS with a self-signed certificate.
+func withTLS() soapServerOption {
+	return func(server *soapServer) { server.tls = true }
+}
+
+// withAttachments sends the response as an MTOM message with attachments.
+func withAttachments(attachments map[string][]byte) soapServerOption {
+	return func(server *soapServer) { server.attachments = attachments }
+}
+
+// withHandler lets handler answer a request first, given the body it was
+// sent. The server's own response is sent when handler returns false.
+func withHandler(handler func(w http.ResponseWriter, r *http.Request, body []byte) bool) soapServerOption {
+	return func(server *soapServer) { server.handler = handler }
+}
+
+// newSOAPServer starts a test server that answers every request with the
+// given SOAP body and records the last request envelope it received.
+func newSOAPServer(t *testing.T, responseBody string, lastRequest *string, opts ...soapServerOption) *httptest.Server {
+	config := soapServer{status: http.StatusOK, header: make(http.Header)}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if lastRequest != nil {
+			*lastRequest = string(body)
+		}
+		if config.handler != nil && config.handler(w, r, body) {
+			return
+		}
+
+		for key, values := range config.header {
+			w.Header()[key] = values
+		}
+		if config.raw {
+			w.WriteHeader(config.status)
+			w.Write([]byte(responseBody))
+			return
+		}
+		writeSOAPResponse(w, config.status, responseBody, config.attachments)
+	})
+
+	var server *httptest.Server
+	if config.tls {
+		server = httptest.NewTLSServer(handler)
+	} else {
+		server = httptest.NewServer(handler)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+// writeSOAPResponse writes responseBody in a SOAP envelope, as an MTOM
+// message when there are attachments.
+func writeSOAPResponse(w http.ResponseWriter, status int, responseBody string, attachments map[string][]byte) {
+	envelope := `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"` +
+		` xmlns:tds="http://www.onvif.org/ver10/device/wsdl"` +
+		` xmlns:tt="http://www.onvif.org/ver10/schema"` +
+		` xmlns:xop="http://www.w3.org/2004/08/xop/include">` +
+		`<s:Body>` + responseBody + `</s:Body></s:Envelope>`
+
+	body, contentType := []byte(envelope), "application/soap+xml"
+	if len(attachments) > 0 {
+		body, contentType = mtomRequest(envelope, attachments)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// newHangingServer starts a test server that never answers until the
+// client goes away or the test ends.
+func newHangingServer(t *testing.T) *httptest.Server {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(func() {
+		close(release)
+		server.Close()
+	})
+	return server
+}
+
+func TestSendRequestContextDeadline(t *testing.T) {
+	server := newHangingServer(t)
+
+	device := Device{XAddr: server.URL + "/onvif/device_service"}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := device.GetInformationContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("request was not aborted by the context, took %v", elapsed)
+	}
+}
+
+func TestSendRequestContextCancel(t *testing.T) {
+	server := newHangingServer(t)
+
+	device := Device{XAddr: server.URL + "/onvif/media_service"}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := device.GetProfilesContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+}
+
+func TestSendRequestContext(t *testing.T) {
+	server := newSOAPServer(t, `<tds:GetDeviceInformationResponse>
+		<tds:Manufacturer>Acme</tds:Manufacturer>
+		<tds:Model>C1</tds:Model>
+		<tds:FirmwareVersion>1.0</tds:FirmwareVersion>
+		<tds:SerialNumber>42</tds:SerialNumber>
+		<tds:HardwareId>hw</tds:HardwareId>
+	</tds:GetDeviceInformationResponse>`, nil)
+
+	device := Device{XAddr: server.URL + "/onvif/device_service"}
+	info, err := device.GetInformationContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Manufacturer != "Acme" || info.FirmwareVersion != "1.0" {
+		t.Fatalf("unexpected device information %+v", info)
+	}
+}
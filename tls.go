@@ -0,0 +1,148 @@
+package onvif
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// ErrCertificatePinMismatch is returned, wrapped in the request error, when an
+// HTTPS device presents a certificate whose key is not pinned.
+var ErrCertificatePinMismatch = errors.New("onvif: device certificate does not match the pinned key")
+
+// TLSConfig configures how HTTPS devices are verified. Without one, device
+// certificates are not verified at all.
+type TLSConfig struct {
+	// RootCAs verifies the device's certificate chain. When nil the system
+	// roots are used, unless the device is verified by its pinned key.
+	RootCAs *x509.CertPool
+	// Certificates are presented to devices that require mutual TLS.
+	Certificates []tls.Certificate
+	// PinnedSPKI lists the keys the device may present, as returned by
+	// SPKIHash. The chain is only verified as well when RootCAs is set.
+	PinnedSPKI []string
+	// TrustOnFirstUse pins the key the device presents on the first
+	// connection when PinnedSPKI is empty. A Client keeps the pin for as
+	// long as it lives; bare Devices share one per host for as long as the
+	// process runs.
+	TrustOnFirstUse bool
+}
+
+// SPKIHash returns the base64 SHA-256 hash of the certificate's public key,
+// the format of TLSConfig.PinnedSPKI.
+func SPKIHash(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// trustedKey is the key a device was trusted with on first use.
+type trustedKey struct {
+	mu   sync.Mutex
+	spki string
+}
+
+var (
+	trustedKeysMu sync.Mutex
+	trustedKeys   = make(map[string]*trustedKey) // key: device host
+)
+
+// trustedKeyFor returns where the key of the device serving xaddr is pinned.
+// Clients keep their own; bare Devices share one per host, kept apart from
+// the rest of their state so that it is never forgotten.
+func (device Device) trustedKeyFor(xaddr string) *trustedKey {
+	if device.client != nil {
+		return &device.client.trustedKey
+	}
+
+	host := xaddr
+	if urlXAddr, err := url.Parse(xaddr); err == nil {
+		host = urlXAddr.Host
+	}
+
+	trustedKeysMu.Lock()
+	defer trustedKeysMu.Unlock()
+	key, ok := trustedKeys[host]
+	if !ok {
+		key = &trustedKey{}
+		trustedKeys[host] = key
+	}
+	return key
+}
+
+// PinnedSPKI returns the key trusted on first use for the device, or an empty
+// string if none was pinned yet.
+func (device Device) PinnedSPKI() string {
+	key := device.trustedKeyFor(device.XAddr)
+	key.mu.Lock()
+	defer key.mu.Unlock()
+	return key.spki
+}
+
+// tlsClientConfig returns the TLS configuration for connections to the
+// device serving xaddr, pinning its key on first use.
+func (device Device) tlsClientConfig(xaddr string) *tls.Config {
+	config := device.TLS
+	if config == nil {
+		return &tls.Config{InsecureSkipVerify: true}
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs:      config.RootCAs,
+		Certificates: config.Certificates,
+	}
+	if len(config.PinnedSPKI) == 0 && !config.TrustOnFirstUse {
+		return tlsConfig
+	}
+
+	// Devices usually have self-signed certificates, which the pin
+	// verifies instead of the chain
+	var key *trustedKey
+	if len(config.PinnedSPKI) == 0 {
+		key = device.trustedKeyFor(xaddr)
+	}
+	tlsConfig.InsecureSkipVerify = config.RootCAs == nil
+	tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		return verifyPin(rawCerts, config.PinnedSPKI, key)
+	}
+	return tlsConfig
+}
+
+// verifyPin checks that one of the presented certificates has a pinned key,
+// or pins the leaf's key in key when no pins are given and none was trusted
+// yet.
+func verifyPin(rawCerts [][]byte, pinned []string, key *trustedKey) error {
+	var hashes []string
+	for _, rawCert := range rawCerts {
+		cert, err := x509.ParseCertificate(rawCert)
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, SPKIHash(cert))
+	}
+	if len(hashes) == 0 {
+		return ErrCertificatePinMismatch
+	}
+
+	if len(pinned) == 0 {
+		key.mu.Lock()
+		if key.spki == "" {
+			key.spki = hashes[0]
+		}
+		pinned = []string{key.spki}
+		key.mu.Unlock()
+	}
+
+	for _, hash := range hashes {
+		for _, pin := range pinned {
+			if hash == pin {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: got %s", ErrCertificatePinMismatch, hashes[0])
+}
@@ -0,0 +1,97 @@
+package onvif
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTLSRootCAs(t *testing.T) {
+	server := newSOAPServer(t, testInformationResponse, nil, withRawResponse(), withTLS())
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	client := NewClient(Device{XAddr: server.URL, TLS: &TLSConfig{RootCAs: roots}}, nil)
+	if _, err := client.GetInformation(); err != nil {
+		t.Fatal(err)
+	}
+
+	untrusted := NewClient(Device{XAddr: server.URL, TLS: &TLSConfig{RootCAs: x509.NewCertPool()}}, nil)
+	if _, err := untrusted.GetInformation(); err == nil {
+		t.Fatal("expected an untrusted certificate to be rejected")
+	}
+}
+
+func TestTLSClientWithoutTransport(t *testing.T) {
+	server := newSOAPServer(t, testInformationResponse, nil, withRawResponse(), withTLS())
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	device := Device{XAddr: server.URL, TLS: &TLSConfig{RootCAs: roots}}
+	if _, err := NewClient(device, &http.Client{Timeout: 5 * time.Second}).GetInformation(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSPinnedSPKI(t *testing.T) {
+	server := newSOAPServer(t, testInformationResponse, nil, withRawResponse(), withTLS())
+
+	pinned := Device{XAddr: server.URL, TLS: &TLSConfig{PinnedSPKI: []string{SPKIHash(server.Certificate())}}}
+	if _, err := NewClient(pinned, nil).GetInformation(); err != nil {
+		t.Fatal(err)
+	}
+
+	mismatch := Device{XAddr: server.URL, TLS: &TLSConfig{PinnedSPKI: []string{"AAAA"}}}
+	_, err := mismatch.GetInformation()
+	if !errors.Is(err, ErrCertificatePinMismatch) {
+		t.Fatalf("expected ErrCertificatePinMismatch, got %v", err)
+	}
+}
+
+func TestTLSTrustOnFirstUse(t *testing.T) {
+	server := newSOAPServer(t, testInformationResponse, nil, withRawResponse(), withTLS())
+	client := NewClient(Device{XAddr: server.URL, TLS: &TLSConfig{TrustOnFirstUse: true}}, nil)
+
+	if _, err := client.GetInformation(); err != nil {
+		t.Fatal(err)
+	}
+	if pin := client.PinnedSPKI(); pin != SPKIHash(server.Certificate()) {
+		t.Fatalf("expected the server key to be pinned, got %q", pin)
+	}
+
+	// httptest servers share one certificate, so pin another key instead
+	pinned := NewClient(Device{XAddr: server.URL, TLS: &TLSConfig{TrustOnFirstUse: true}}, nil)
+	pinned.trustedKey.spki = "AAAA"
+	_, err := pinned.GetInformation()
+	if !errors.Is(err, ErrCertificatePinMismatch) {
+		t.Fatalf("expected ErrCertificatePinMismatch, got %v", err)
+	}
+}
+
+func TestTLSTrustOnFirstUseOutlivesStateCache(t *testing.T) {
+	server := newSOAPServer(t, testInformationResponse, nil, withRawResponse(), withTLS())
+	device := Device{XAddr: server.URL, TLS: &TLSConfig{TrustOnFirstUse: true}}
+	if _, err := device.GetInformation(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Crowd the host out of the state bare Devices share
+	for i := 0; i < maxDeviceStates; i++ {
+		device.stateFor("http://192.0.2.1:" + strconv.Itoa(i+1))
+	}
+	urlServer, _ := url.Parse(server.URL)
+	deviceStatesMu.Lock()
+	_, remembered := deviceStates[urlServer.Host]
+	deviceStatesMu.Unlock()
+	if remembered {
+		t.Fatal("expected the host's state to be forgotten")
+	}
+
+	if pin := device.PinnedSPKI(); pin != SPKIHash(server.Certificate()) {
+		t.Fatalf("expected the pin to be kept, got %q", pin)
+	}
+}
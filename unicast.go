@@ -0,0 +1,236 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxUnicastHosts is the largest range DiscoverUnicast sweeps, a /16 for
+// IPv4.
+const maxUnicastHosts = 1 << 16
+
+// UnicastOptions configures DiscoverUnicast.
+type UnicastOptions struct {
+	// Types, Scopes and MatchBy filter devices as in DiscoveryOptions.
+	Types   []DeviceType
+	Scopes  []string
+	MatchBy string
+	// Port is the WS-Discovery port probes are sent to, 3702 if zero.
+	Port int
+	// Timeout is how long to wait for each host to answer, 1 second if
+	// zero.
+	Timeout time.Duration
+	// Concurrency is how many hosts are probed at once, 64 if zero.
+	Concurrency int
+	// Rate caps how many hosts are probed per second. Zero means no cap.
+	Rate int
+	// HTTPFallback sends GetSystemDateAndTime to /onvif/device_service of
+	// hosts that ignore the probe. Devices found this way only have an
+	// XAddr, so the fallback is skipped when Types or Scopes are set.
+	HTTPFallback bool
+	// HTTPFallbackPorts are the ports the fallback tries, 80 if empty.
+	HTTPFallbackPorts []int
+}
+
+// discoveryOptions returns the options each probe is sent with.
+func (opts UnicastOptions) discoveryOptions() DiscoveryOptions {
+	return DiscoveryOptions{
+		Duration: opts.Timeout,
+		Types:    opts.Types,
+		Scopes:   opts.Scopes,
+		MatchBy:  opts.MatchBy,
+	}
+}
+
+// DiscoverUnicast sends a WS-Discovery probe to each target directly, for
+// networks multicast does not reach, such as routed camera VLANs. Targets
+// are IP addresses or CIDR ranges like "10.1.20.0/24"; ranges larger than
+// 65536 addresses are rejected. Hosts that don't answer are not reported,
+// while invalid targets are sent as an Err result. The channel is closed once
+// every host was probed or ctx ends.
+func DiscoverUnicast(ctx context.Context, targets []string, opts UnicastOptions) <-chan DiscoveryResult {
+	if opts.Port == 0 {
+		opts.Port = 3702
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 64
+	}
+	if len(opts.HTTPFallbackPorts) == 0 {
+		opts.HTTPFallbackPorts = []int{80}
+	}
+
+	results := make(chan DiscoveryResult)
+	go func() {
+		defer close(results)
+
+		hosts := make(chan net.IP)
+		found := foundOnce(ctx, results)
+		var wg sync.WaitGroup
+		for i := 0; i < opts.Concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for host := range hosts {
+					probeUnicast(ctx, host, opts, found)
+				}
+			}()
+		}
+
+		var tick <-chan time.Time
+		if opts.Rate > 0 {
+			ticker := time.NewTicker(time.Second / time.Duration(opts.Rate))
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		unicastHosts(targets, func(host net.IP) bool {
+			if tick != nil {
+				select {
+				case <-tick:
+				case <-ctx.Done():
+					return false
+				}
+			}
+
+			select {
+			case hosts <- host:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}, func(err error) {
+			sendDiscoveryResult(ctx, results, DiscoveryResult{Err: err})
+		})
+
+		close(hosts)
+		wg.Wait()
+	}()
+
+	return results
+}
+
+// unicastHosts calls host for every address in targets, until it returns
+// false. Targets that can't be parsed are passed to invalid.
+func unicastHosts(targets []string, host func(net.IP) bool, invalid func(error)) {
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		if !strings.Contains(target, "/") {
+			ip := net.ParseIP(target)
+			if ip == nil {
+				invalid(fmt.Errorf("invalid discovery target %q", target))
+				continue
+			}
+			if !host(ip) {
+				return
+			}
+			continue
+		}
+
+		ip, ipNet, err := net.ParseCIDR(target)
+		if err != nil {
+			invalid(err)
+			continue
+		}
+		ones, bits := ipNet.Mask.Size()
+		if bits-ones > 16 {
+			invalid(fmt.Errorf("discovery range %s has more than %d addresses", target, maxUnicastHosts))
+			continue
+		}
+
+		// The network and broadcast addresses of IPv4 subnets are no hosts
+		first, last := 0, 1<<uint(bits-ones)
+		if ip.To4() != nil && bits-ones >= 2 {
+			first, last = 1, last-1
+		}
+		for i := first; i < last; i++ {
+			if !host(nthAddr(ipNet.IP, i)) {
+				return
+			}
+		}
+	}
+}
+
+// nthAddr returns the address n after base.
+func nthAddr(base net.IP, n int) net.IP {
+	ip := make(net.IP, len(base))
+	copy(ip, base)
+	for i := len(ip) - 1; i >= 0 && n > 0; i-- {
+		sum := int(ip[i]) + n&0xff
+		ip[i] = byte(sum)
+		n = n>>8 + sum>>8
+	}
+	return ip
+}
+
+// probeUnicast probes host, and tries the HTTP fallback when it does not
+// answer.
+func probeUnicast(ctx context.Context, host net.IP, opts UnicastOptions, found func(DiscoveredDevice)) {
+	network := "udp4"
+	if host.To4() == nil {
+		network = "udp6"
+	}
+
+	answered := false
+	destination := &net.UDPAddr{IP: host, Port: opts.Port}
+	err := sendProbe(ctx, network, nil, destination, opts.discoveryOptions(), func(device DiscoveredDevice) {
+		answered = true
+		found(device)
+	})
+	if err != nil {
+		logAt(nil, LogDebug, "unicast probe failed", "host", host.String(), "error", err)
+	}
+	if answered || !opts.HTTPFallback || len(opts.Types) > 0 || len(opts.Scopes) > 0 {
+		return
+	}
+
+	for _, port := range opts.HTTPFallbackPorts {
+		if ctx.Err() != nil {
+			return
+		}
+		if device, ok := probeDeviceService(ctx, host, port, opts.Timeout); ok {
+			found(device)
+			return
+		}
+	}
+}
+
+// probeDeviceService asks host:port for its time, which any ONVIF device
+// answers, possibly with a SOAP fault when it wants credentials. Other HTTP
+// servers may answer 400 or 401 too, but not with a SOAP fault. The probe is a plain SOAP POST, so sweeping a range leaves no
+// per-host state behind.
+func probeDeviceService(ctx context.Context, host net.IP, port int, timeout time.Duration) (DiscoveredDevice, bool) {
+	hostPort := host.String()
+	if port != 80 {
+		hostPort = net.JoinHostPort(hostPort, strconv.Itoa(port))
+	} else if host.To4() == nil {
+		hostPort = "[" + hostPort + "]"
+	}
+	xaddr := "http://" + hostPort + "/onvif/device_service"
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	soap := SOAP{
+		XMLNs: deviceXMLNs,
+		Body:  `<GetSystemDateAndTime xmlns="http://www.onvif.org/ver10/device/wsdl"/>`,
+	}
+	_, err := soap.SendRequestContext(ctx, xaddr)
+	var fault *SOAPFault
+	if err != nil && !(errors.As(err, &fault) && fault.Code != "") {
+		logAt(nil, LogDebug, "device service probe failed", "xaddr", xaddr, "error", err)
+		return DiscoveredDevice{}, false
+	}
+
+	return DiscoveredDevice{
+		XAddrs: []string{xaddr},
+		Source: &net.TCPAddr{IP: host, Port: port},
+	}, true
+}
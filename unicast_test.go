@@ -0,0 +1,194 @@
+package onvif
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clbanning/mxj"
+)
+
+// newUnicastDiscoveryDevice answers unicast probes on a loopback port with
+// testProbeMatches, or ignores them when silent, and returns the port.
+func newUnicastDiscoveryDevice(t *testing.T, silent bool) int {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buffer := make([]byte, 10*1024)
+		for {
+			n, addr, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			mapXML, err := mxj.NewMapXml(buffer[:n])
+			if err != nil || silent {
+				continue
+			}
+			messageID, _ := mapXML.ValueForPathString("Envelope.Header.MessageID")
+			conn.WriteToUDP([]byte(strings.Replace(testProbeMatches, "uuid:probe", messageID, 1)), addr)
+		}
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestUnicastHosts(t *testing.T) {
+	tests := []struct {
+		target  string
+		hosts   []string
+		invalid bool
+	}{
+		{target: "10.1.20.7", hosts: []string{"10.1.20.7"}},
+		{target: "10.1.20.0/30", hosts: []string{"10.1.20.1", "10.1.20.2"}},
+		{target: "10.1.20.4/31", hosts: []string{"10.1.20.4", "10.1.20.5"}},
+		{target: "10.1.20.9/32", hosts: []string{"10.1.20.9"}},
+		{target: "10.1.0.255/23", hosts: nil},
+		{target: "fd00::fe/127", hosts: []string{"fd00::fe", "fd00::ff"}},
+		{target: "10.0.0.0/8", invalid: true},
+		{target: "camera.local", invalid: true},
+	}
+
+	for _, test := range tests {
+		var hosts []string
+		invalid := false
+		unicastHosts([]string{test.target}, func(host net.IP) bool {
+			hosts = append(hosts, host.String())
+			return true
+		}, func(err error) {
+			invalid = true
+		})
+
+		if invalid != test.invalid {
+			t.Errorf("%s: expected invalid %v, got %v", test.target, test.invalid, invalid)
+		}
+		if test.target == "10.1.0.255/23" {
+			if len(hosts) != 510 || hosts[0] != "10.1.0.1" || hosts[509] != "10.1.1.254" {
+				t.Errorf("%s: unexpected sweep of %d hosts", test.target, len(hosts))
+			}
+			continue
+		}
+		if !reflect.DeepEqual(hosts, test.hosts) {
+			t.Errorf("%s: expected %v, got %v", test.target, test.hosts, hosts)
+		}
+	}
+}
+
+func TestDiscoverUnicast(t *testing.T) {
+	port := newUnicastDiscoveryDevice(t, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var devices []DiscoveredDevice
+	var errs []error
+	targets := []string{"127.0.0.1", "127.0.0.1/32", "not-an-ip"}
+	for result := range DiscoverUnicast(ctx, targets, UnicastOptions{Port: port, Timeout: 500 * time.Millisecond}) {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+			continue
+		}
+		devices = append(devices, result.Device)
+	}
+
+	if len(errs) != 1 {
+		t.Fatalf("expected an error for the invalid target, got %v", errs)
+	}
+	if len(devices) != 1 || devices[0].ID != "2419d68a-2dd2-21b2-a205-ec3c2d3b9f41" {
+		t.Fatalf("expected the device once, got %+v", devices)
+	}
+}
+
+func TestDiscoverUnicastHTTPFallback(t *testing.T) {
+	port := newUnicastDiscoveryDevice(t, true)
+	server := newSOAPServer(t, `<tds:GetSystemDateAndTimeResponse/>`, nil)
+	urlServer, _ := url.Parse(server.URL)
+	httpPort, _ := strconv.Atoi(urlServer.Port())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := UnicastOptions{
+		Port:              port,
+		Timeout:           200 * time.Millisecond,
+		HTTPFallback:      true,
+		HTTPFallbackPorts: []int{httpPort},
+	}
+	var devices []DiscoveredDevice
+	for result := range DiscoverUnicast(ctx, []string{"127.0.0.1"}, opts) {
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		devices = append(devices, result.Device)
+	}
+
+	if len(devices) != 1 || !reflect.DeepEqual(devices[0].XAddrs, []string{server.URL + "/onvif/device_service"}) {
+		t.Fatalf("expected the device service to be found, got %+v", devices)
+	}
+
+	// Devices that want credentials answer with a fault, and the sweep
+	// remembers nothing about the hosts it probed
+	locked := newSOAPServer(t, notAuthorizedFault, nil, withStatus(http.StatusUnauthorized), withRawResponse())
+	urlLocked, _ := url.Parse(locked.URL)
+	lockedPort, _ := strconv.Atoi(urlLocked.Port())
+	lockedOpts := opts
+	lockedOpts.HTTPFallbackPorts = []int{lockedPort}
+	devices = nil
+	for result := range DiscoverUnicast(ctx, []string{"127.0.0.1"}, lockedOpts) {
+		devices = append(devices, result.Device)
+	}
+	if len(devices) != 1 || !reflect.DeepEqual(devices[0].XAddrs, []string{locked.URL + "/onvif/device_service"}) {
+		t.Fatalf("expected the locked device service to be found, got %+v", devices)
+	}
+	deviceStatesMu.Lock()
+	_, remembered := deviceStates[urlLocked.Host]
+	deviceStatesMu.Unlock()
+	if remembered {
+		t.Fatal("expected the sweep not to keep state for the probed host")
+	}
+
+	// Other web servers refusing the request aren't devices
+	web := newSOAPServer(t, "<html><body>Bad Request</body></html>", nil, withStatus(http.StatusBadRequest), withRawResponse(), withHeader("Content-Type", "text/html"))
+	urlWeb, _ := url.Parse(web.URL)
+	webPort, _ := strconv.Atoi(urlWeb.Port())
+	webOpts := opts
+	webOpts.HTTPFallbackPorts = []int{webPort}
+	for result := range DiscoverUnicast(ctx, []string{"127.0.0.1"}, webOpts) {
+		if result.Err == nil {
+			t.Fatalf("expected a plain 400 not to be taken for a device, got %+v", result.Device)
+		}
+	}
+
+	// Devices found over HTTP can't be filtered, so they are left out
+	opts.Scopes = []string{"onvif://www.onvif.org/Profile/Streaming"}
+	for result := range DiscoverUnicast(ctx, []string{"127.0.0.1"}, opts) {
+		t.Fatalf("expected no results with a scope filter, got %+v", result)
+	}
+}
+
+func TestDiscoverUnicastRate(t *testing.T) {
+	port := newUnicastDiscoveryDevice(t, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+
+	opts := UnicastOptions{Port: port, Timeout: 10 * time.Millisecond, Rate: 10}
+	for result := range DiscoverUnicast(ctx, []string{"127.0.0.0/29"}, opts) {
+		t.Fatalf("expected no results, got %+v", result)
+	}
+
+	// 6 hosts at 10 per second
+	if elapsed := time.Since(start); elapsed < 550*time.Millisecond {
+		t.Fatalf("probed 6 hosts in %v", elapsed)
+	}
+}
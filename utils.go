@@ -1,10 +1,14 @@
 package onvif
 
 import (
+	"bytes"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var testDevice = Device{
@@ -40,6 +44,26 @@ func interfaceToFloat64(src interface{}) float64 {
 	return number
 }
 
+var durationRegexp = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// interfaceToDuration parses an xs:duration such as "PT30S" or "P1DT2H".
+// Years and months are taken as 365 and 30 days.
+func interfaceToDuration(src interface{}) time.Duration {
+	match := durationRegexp.FindStringSubmatch(strings.TrimSpace(interfaceToString(src)))
+	if match == nil {
+		return 0
+	}
+
+	var duration time.Duration
+	units := []time.Duration{365 * 24 * time.Hour, 30 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute}
+	for i, unit := range units {
+		number, _ := strconv.Atoi(match[i+1])
+		duration += time.Duration(number) * unit
+	}
+	seconds, _ := strconv.ParseFloat(match[6], 64)
+	return duration + time.Duration(seconds*float64(time.Second))
+}
+
 func intToString(src int) string {
 	strInt := strconv.Itoa(src)
 	return strInt
@@ -50,6 +74,25 @@ func float64ToString(src float64) string {
 	return strFloat64
 }
 
+// escapeXML escapes src for use as XML text or attribute value. Runs of
+// spaces are kept as character references, since createRequest collapses
+// the whitespace of the whole envelope.
+func escapeXML(src string) string {
+	var buffer bytes.Buffer
+	xml.EscapeText(&buffer, []byte(src))
+	escaped := buffer.String()
+
+	var result strings.Builder
+	for i := 0; i < len(escaped); i++ {
+		if escaped[i] == ' ' && (i == 0 || escaped[i-1] == ' ') {
+			result.WriteString("&#32;")
+			continue
+		}
+		result.WriteByte(escaped[i])
+	}
+	return result.String()
+}
+
 func boolToString(src bool) string {
 	if src {
 		return "true"
@@ -59,6 +102,9 @@ func boolToString(src bool) string {
 }
 
 // kiem tra co phai loi chung thuc hay khong
+//
+// Deprecated: use errors.Is(err, ErrNotAuthorized), which does not depend on
+// the wording of the device's fault reason.
 func CheckAuthorizedError(msg string) bool {
 	msg = strings.ToLower(msg)
 	return strings.Index(msg, "authorized") != -1
@@ -0,0 +1,129 @@
+package onvif
+
+import (
+	"testing"
+	"time"
+
+	"github.com/clbanning/mxj"
+)
+
+const trickyValue = `p&ss<w"o'>rd  x`
+
+func requestValue(t *testing.T, request, path string) interface{} {
+	mapXML, err := mxj.NewMapXml([]byte(request))
+	if err != nil {
+		t.Fatalf("request is not well-formed XML: %v\n%s", err, request)
+	}
+	value, err := mapXML.ValueForPath(path)
+	if err != nil {
+		t.Fatalf("%s not found in request: %v\n%s", path, err, request)
+	}
+	if mapValue, ok := value.(map[string]interface{}); ok {
+		if text, ok := mapValue["#text"]; ok {
+			return text
+		}
+	}
+	return value
+}
+
+// requestValues is like requestValue for an element that may be repeated.
+func requestValues(t *testing.T, request, path string) []interface{} {
+	mapXML, err := mxj.NewMapXml([]byte(request))
+	if err != nil {
+		t.Fatalf("request is not well-formed XML: %v\n%s", err, request)
+	}
+	values, err := mapXML.ValuesForPath(path)
+	if err != nil {
+		t.Fatalf("%s not found in request: %v\n%s", path, err, request)
+	}
+	return values
+}
+
+func TestEscapeXML(t *testing.T) {
+	cases := map[string]string{
+		"admin":     "admin",
+		"a&b":       "a&amp;b",
+		"<x>":       "&lt;x&gt;",
+		`"'`:        "&#34;&#39;",
+		"a  b":      "a &#32;b",
+		" ":         "&#32;",
+		"tab\there": "tab&#x9;here",
+	}
+	for src, expected := range cases {
+		if escaped := escapeXML(src); escaped != expected {
+			t.Errorf("escapeXML(%q) = %q, expected %q", src, escaped, expected)
+		}
+	}
+}
+
+func TestInterfaceToDuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"PT30S":     30 * time.Second,
+		"PT0.5S":    500 * time.Millisecond,
+		"PT2M":      2 * time.Minute,
+		"P1DT2H":    26 * time.Hour,
+		" PT1H1M1S": time.Hour + time.Minute + time.Second,
+		"P":         0,
+		"30":        0,
+		"":          0,
+	}
+	for src, expected := range cases {
+		if duration := interfaceToDuration(src); duration != expected {
+			t.Errorf("interfaceToDuration(%q) = %v, expected %v", src, duration, expected)
+		}
+	}
+}
+
+func TestCreateUsersEscapesValues(t *testing.T) {
+	var request string
+	server := newSOAPServer(t, `<tds:CreateUsersResponse/>`, &request)
+
+	device := Device{XAddr: server.URL, User: "ad<min>", Password: "secret"}
+	err := device.CreateUsers([]User{{Username: "op&erator", Password: trickyValue, UserLevel: "Operator"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if password := requestValue(t, request, "Envelope.Body.CreateUsers.User.Password"); password != trickyValue {
+		t.Errorf("password sent as %q, expected %q", password, trickyValue)
+	}
+	if username := requestValue(t, request, "Envelope.Body.CreateUsers.User.Username"); username != "op&erator" {
+		t.Errorf("username sent as %q", username)
+	}
+	if username := requestValue(t, request, "Envelope.Header.Security.UsernameToken.Username"); username != "ad<min>" {
+		t.Errorf("WS-Security username sent as %q", username)
+	}
+}
+
+func TestProfileTokenCannotInjectElements(t *testing.T) {
+	var request string
+	server := newSOAPServer(t, `<trt:GetStreamUriResponse xmlns:trt="http://www.onvif.org/ver10/media/wsdl"/>`, &request)
+
+	token := `main</trt:ProfileToken><trt:Injected>1</trt:Injected><trt:ProfileToken>`
+	Device{XAddr: server.URL}.GetStreamURI(token, "RTSP")
+
+	stream := requestValue(t, request, "Envelope.Body.GetStreamUri")
+	mapStream, ok := stream.(map[string]interface{})
+	if !ok {
+		t.Fatalf("unexpected GetStreamUri element %v", stream)
+	}
+	if _, injected := mapStream["Injected"]; injected {
+		t.Fatal("profile token injected an element into the request")
+	}
+	if mapStream["ProfileToken"] != token {
+		t.Fatalf("profile token sent as %q", mapStream["ProfileToken"])
+	}
+}
+
+func TestSetScopesEscapesValues(t *testing.T) {
+	var request string
+	server := newSOAPServer(t, `<tds:SetScopesResponse/>`, &request)
+
+	scope := "onvif://www.onvif.org/location/a&b<c>"
+	if err := (Device{XAddr: server.URL}).SetScopes([]string{scope}); err != nil {
+		t.Fatal(err)
+	}
+	if sent := requestValue(t, request, "Envelope.Body.SetScopes.Scopes"); sent != scope {
+		t.Fatalf("scope sent as %q", sent)
+	}
+}